@@ -0,0 +1,258 @@
+package blobdestination
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/destination"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+)
+
+/*
+Copy implements the Blacksmith destination.Action interface for the action
+"copy". It holds the complete job's structure to load into the destination.
+*/
+type Copy struct {
+	env     *Options
+	ctx     context.Context
+	bucket  *blob.Bucket
+	targets map[string]*blob.Bucket
+
+	// Filename is the key of the object to copy.
+	//
+	// Example: "exports/staging/myevent.json"
+	// Required.
+	Filename string `json:"filename"`
+
+	// Target is the key of the object to create.
+	//
+	// Example: "exports/production/myevent.json"
+	// Required.
+	Target string `json:"target"`
+
+	// TargetBucket is the blob URL of the bucket to copy the object into. When
+	// not set, the object is copied within the bucket of the destination. It must
+	// be listed in the destination's option TargetBuckets.
+	//
+	// Example: "s3://mybucket-b?region=eu-west-1"
+	TargetBucket string `json:"target_bucket,omitempty"`
+}
+
+/*
+String returns the string representation of the action Copy.
+*/
+func (a Copy) String() string {
+	return "copy"
+}
+
+/*
+Schedule allows the action to override the schedule options of its
+destination. Do not override.
+*/
+func (a Copy) Schedule() *destination.Schedule {
+	return nil
+}
+
+/*
+Marshal is the function being run when the action receives data into
+the Copy receiver. It allows to transform and enrich the data before
+saving it in the store adapter.
+*/
+func (a Copy) Marshal(tk *destination.Toolkit) (*destination.Job, error) {
+
+	// Ensure the object to copy and its target are valid.
+	if validations := validateTarget("Copy", a.Filename, a.Target, a.TargetBucket); len(validations) > 0 {
+		return nil, &errors.Error{
+			StatusCode:  400,
+			Message:     "Bad Request",
+			Validations: validations,
+		}
+	}
+
+	// Try to marshal the data passed directly to the receiver.
+	data, err := json.Marshal(&a)
+	if err != nil {
+		return nil, &errors.Error{
+			StatusCode: 400,
+			Message:    "Bad Request",
+		}
+	}
+
+	// Create a job with the data. Since the 'Context' key is not
+	// set, the one from the event will automatically be applied.
+	j := &destination.Job{
+		Data: data,
+	}
+
+	// Return the job including the marshaled data.
+	return j, nil
+}
+
+/*
+Load is the function being run by the scheduler to load the data into
+the destination. It is in charge of the "L" in the ETL process.
+*/
+func (a Copy) Load(tk *destination.Toolkit, queue *store.Queue, then chan<- destination.Then) {
+
+	// We can go through every events received from the queue and their
+	// related jobs. The queue can contain one or many events. The jobs
+	// present in the events are specific to this action only.
+	//
+	// This allows to parse everything needed and make a request to the
+	// destination for each event / job.
+	for _, event := range queue.Events {
+		for _, job := range event.Jobs {
+
+			// Unmarshal the `data` key of the job.
+			var payload Copy
+			err := json.Unmarshal(job.Data, &payload)
+			if err != nil {
+				then <- destination.Then{
+					Jobs:         []string{job.ID},
+					Error:        err,
+					ForceDiscard: true,
+				}
+
+				continue
+			}
+
+			// There is nothing to do if the target is the object itself.
+			if sameObject(payload.Filename, payload.Target, payload.TargetBucket) {
+				then <- destination.Then{
+					Jobs: []string{job.ID},
+				}
+
+				continue
+			}
+
+			// Discard the job if the target bucket is not allowed, since retrying
+			// it would not help.
+			if payload.TargetBucket != "" && a.targets[payload.TargetBucket] == nil {
+				then <- destination.Then{
+					Jobs:         []string{job.ID},
+					Error:        errTargetNotAllowed(payload.TargetBucket),
+					ForceDiscard: true,
+				}
+
+				continue
+			}
+
+			// Copy the object. If the object to copy does not exist there is no
+			// need to retry the job.
+			err = a.copy(payload)
+			then <- destination.Then{
+				Jobs:         []string{job.ID},
+				Error:        err,
+				ForceDiscard: gcerrors.Code(err) == gcerrors.NotFound,
+			}
+		}
+	}
+}
+
+/*
+copy copies the object of the payload to its target. Objects are copied
+server-side within the bucket of the destination, and are streamed from one
+bucket to the other otherwise.
+*/
+func (a Copy) copy(payload Copy) error {
+	if payload.TargetBucket == "" {
+		return a.bucket.Copy(a.ctx, payload.Target, payload.Filename, nil)
+	}
+
+	target := a.targets[payload.TargetBucket]
+	if target == nil {
+		return errTargetNotAllowed(payload.TargetBucket)
+	}
+
+	reader, err := a.bucket.NewReader(a.ctx, payload.Filename, nil)
+	if err != nil {
+		return err
+	}
+
+	defer reader.Close()
+
+	// Keep the metadata of the object, such as the encryption details of the
+	// objects encrypted by the destination.
+	attrs, err := a.bucket.Attributes(a.ctx, payload.Filename)
+	if err != nil {
+		return err
+	}
+
+	// Try to open a new writer with the target bucket. The context is canceled
+	// if the content can not be copied so the upload is aborted instead of
+	// committing a partial object.
+	ctx, cancel := context.WithCancel(a.ctx)
+	defer cancel()
+
+	writer, err := target.NewWriter(ctx, payload.Target, &blob.WriterOptions{
+		BufferSize:  a.env.BufferSize,
+		ContentType: reader.ContentType(),
+		Metadata:    attrs.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, reader)
+	if err != nil {
+		cancel()
+		writer.Close()
+		return err
+	}
+
+	return writer.Close()
+}
+
+/*
+validateTarget ensures the object to copy or move and its target are set, and
+that the target is not the object itself.
+*/
+func validateTarget(action string, filename string, target string, targetBucket string) []errors.Validation {
+	validations := []errors.Validation{}
+
+	if filename == "" {
+		validations = append(validations, errors.Validation{
+			Message: "Filename must be set",
+			Path:    []string{action, "Filename"},
+		})
+	}
+
+	if target == "" {
+		validations = append(validations, errors.Validation{
+			Message: "Target must be set",
+			Path:    []string{action, "Target"},
+		})
+	}
+
+	if filename != "" && sameObject(filename, target, targetBucket) {
+		validations = append(validations, errors.Validation{
+			Message: "Target must not be the same object as Filename",
+			Path:    []string{action, "Target"},
+		})
+	}
+
+	return validations
+}
+
+/*
+sameObject indicates if the target of a copy or move is the object itself.
+*/
+func sameObject(filename string, target string, targetBucket string) bool {
+	return targetBucket == "" && filename == target
+}
+
+/*
+errTargetNotAllowed returns the error to send when a target bucket is not
+listed in the destination's option TargetBuckets.
+*/
+func errTargetNotAllowed(target string) error {
+	return &errors.Error{
+		Message: fmt.Sprintf("blob: Target bucket '%s' not allowed", target),
+	}
+}
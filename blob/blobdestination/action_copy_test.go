@@ -0,0 +1,151 @@
+package blobdestination
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/destination"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/memblob"
+)
+
+var _ destination.Action = Copy{}
+
+func TestCopy_Load(t *testing.T) {
+	tests := []struct {
+		name         string
+		targetBucket string
+		wantErr      bool
+		wantDiscard  bool
+	}{
+		{
+			name:         "WithinBucket",
+			targetBucket: "",
+			wantErr:      false,
+		},
+		{
+			name:         "WithTargetBucket",
+			targetBucket: "mem://archives",
+			wantErr:      false,
+		},
+		{
+			name:         "WithTargetBucketNotAllowed",
+			targetBucket: "mem://forbidden",
+			wantErr:      true,
+			wantDiscard:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+
+			archives := memblob.OpenBucket(nil)
+			defer archives.Close()
+
+			err := bucket.WriteAll(ctx, "staging/hello.txt", []byte("Hello, World!"), &blob.WriterOptions{
+				ContentType: "text/plain",
+				Metadata: map[string]string{
+					"owner": "blacksmith",
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			a := Copy{
+				env:    &Options{},
+				ctx:    ctx,
+				bucket: bucket,
+				targets: map[string]*blob.Bucket{
+					"mem://archives": archives,
+				},
+			}
+
+			data, _ := json.Marshal(Copy{
+				Filename:     "staging/hello.txt",
+				Target:       "production/hello.txt",
+				TargetBucket: tt.targetBucket,
+			})
+
+			got := load(a, data)
+			if (got.Error != nil) != tt.wantErr {
+				t.Fatalf("Copy.Load() error = %v, wantErr %v", got.Error, tt.wantErr)
+			}
+			if got.ForceDiscard != tt.wantDiscard {
+				t.Errorf("Copy.Load() discard = %v, want %v", got.ForceDiscard, tt.wantDiscard)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			target := bucket
+			if tt.targetBucket != "" {
+				target = archives
+			}
+
+			content, err := target.ReadAll(ctx, "production/hello.txt")
+			if err != nil {
+				t.Fatalf("bucket.ReadAll() error = %v", err)
+			}
+			if string(content) != "Hello, World!" {
+				t.Errorf("bucket.ReadAll() = %s, want %s", content, "Hello, World!")
+			}
+
+			attrs, err := target.Attributes(ctx, "production/hello.txt")
+			if err != nil {
+				t.Fatalf("bucket.Attributes() error = %v", err)
+			}
+			if attrs.ContentType != "text/plain" {
+				t.Errorf("bucket.Attributes() content type = %s, want %s", attrs.ContentType, "text/plain")
+			}
+			if !reflect.DeepEqual(attrs.Metadata, map[string]string{"owner": "blacksmith"}) {
+				t.Errorf("bucket.Attributes() metadata = %v", attrs.Metadata)
+			}
+
+			if exists, _ := bucket.Exists(ctx, "staging/hello.txt"); !exists {
+				t.Errorf("Copy.Load() source does not exist anymore")
+			}
+		})
+	}
+}
+
+func TestCopy_Marshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  Copy
+		wantErr bool
+	}{
+		{
+			name:    "WithTarget",
+			action:  Copy{Filename: "staging/hello.txt", Target: "production/hello.txt"},
+			wantErr: false,
+		},
+		{
+			name:    "WithSameObject",
+			action:  Copy{Filename: "staging/hello.txt", Target: "staging/hello.txt"},
+			wantErr: true,
+		},
+		{
+			name:    "WithoutFilename",
+			action:  Copy{Target: "production/hello.txt"},
+			wantErr: true,
+		},
+		{
+			name:    "WithoutTarget",
+			action:  Copy{Filename: "staging/hello.txt"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.action.Marshal(&destination.Toolkit{}); (err != nil) != tt.wantErr {
+				t.Errorf("Copy.Marshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package blobdestination
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/destination"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+)
+
+/*
+Delete implements the Blacksmith destination.Action interface for the action
+"delete". It holds the complete job's structure to load into the destination.
+*/
+type Delete struct {
+	env    *Options
+	ctx    context.Context
+	bucket *blob.Bucket
+
+	// Filename is the key of the object to delete.
+	//
+	// Example: "exports/myevent.json"
+	// Required.
+	Filename string `json:"filename"`
+}
+
+/*
+String returns the string representation of the action Delete.
+*/
+func (a Delete) String() string {
+	return "delete"
+}
+
+/*
+Schedule allows the action to override the schedule options of its
+destination. Do not override.
+*/
+func (a Delete) Schedule() *destination.Schedule {
+	return nil
+}
+
+/*
+Marshal is the function being run when the action receives data into
+the Delete receiver. It allows to transform and enrich the data before
+saving it in the store adapter.
+*/
+func (a Delete) Marshal(tk *destination.Toolkit) (*destination.Job, error) {
+
+	// Ensure the object to delete is set.
+	if a.Filename == "" {
+		return nil, &errors.Error{
+			StatusCode: 400,
+			Message:    "Bad Request",
+			Validations: []errors.Validation{
+				{
+					Message: "Filename must be set",
+					Path:    []string{"Delete", "Filename"},
+				},
+			},
+		}
+	}
+
+	// Try to marshal the data passed directly to the receiver.
+	data, err := json.Marshal(&a)
+	if err != nil {
+		return nil, &errors.Error{
+			StatusCode: 400,
+			Message:    "Bad Request",
+		}
+	}
+
+	// Create a job with the data. Since the 'Context' key is not
+	// set, the one from the event will automatically be applied.
+	j := &destination.Job{
+		Data: data,
+	}
+
+	// Return the job including the marshaled data.
+	return j, nil
+}
+
+/*
+Load is the function being run by the scheduler to load the data into
+the destination. It is in charge of the "L" in the ETL process.
+*/
+func (a Delete) Load(tk *destination.Toolkit, queue *store.Queue, then chan<- destination.Then) {
+
+	// We can go through every events received from the queue and their
+	// related jobs. The queue can contain one or many events. The jobs
+	// present in the events are specific to this action only.
+	//
+	// This allows to parse everything needed and make a request to the
+	// destination for each event / job.
+	for _, event := range queue.Events {
+		for _, job := range event.Jobs {
+
+			// Unmarshal the `data` key of the job.
+			var payload Delete
+			err := json.Unmarshal(job.Data, &payload)
+			if err != nil {
+				then <- destination.Then{
+					Jobs:         []string{job.ID},
+					Error:        err,
+					ForceDiscard: true,
+				}
+
+				continue
+			}
+
+			// Delete the object. An object already missing is considered as
+			// successfully deleted.
+			err = a.bucket.Delete(a.ctx, payload.Filename)
+			if gcerrors.Code(err) == gcerrors.NotFound {
+				err = nil
+			}
+
+			then <- destination.Then{
+				Jobs:  []string{job.ID},
+				Error: err,
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package blobdestination
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/destination"
+
+	"gocloud.dev/blob/memblob"
+)
+
+var _ destination.Action = Delete{}
+
+func TestDelete_Marshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  Delete
+		wantErr bool
+	}{
+		{
+			name:    "WithFilename",
+			action:  Delete{Filename: "hello.txt"},
+			wantErr: false,
+		},
+		{
+			name:    "WithoutFilename",
+			action:  Delete{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.action.Marshal(&destination.Toolkit{}); (err != nil) != tt.wantErr {
+				t.Errorf("Delete.Marshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDelete_Load(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing bool
+	}{
+		{
+			name:     "WithExistingObject",
+			existing: true,
+		},
+		{
+			name:     "WithMissingObject",
+			existing: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+
+			if tt.existing {
+				bucket.WriteAll(ctx, "hello.txt", []byte("Hello, World!"), nil)
+			}
+
+			a := Delete{
+				env:    &Options{},
+				ctx:    ctx,
+				bucket: bucket,
+			}
+
+			data, _ := json.Marshal(Delete{
+				Filename: "hello.txt",
+			})
+
+			got := load(a, data)
+			if got.Error != nil {
+				t.Fatalf("Delete.Load() error = %v", got.Error)
+			}
+
+			exists, _ := bucket.Exists(ctx, "hello.txt")
+			if exists {
+				t.Errorf("Delete.Load() object still exists")
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package blobdestination
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/destination"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+)
+
+/*
+Move implements the Blacksmith destination.Action interface for the action
+"move". It holds the complete job's structure to load into the destination.
+*/
+type Move struct {
+	env     *Options
+	ctx     context.Context
+	bucket  *blob.Bucket
+	targets map[string]*blob.Bucket
+
+	// Filename is the key of the object to move.
+	//
+	// Example: "exports/staging/myevent.json"
+	// Required.
+	Filename string `json:"filename"`
+
+	// Target is the key of the object once moved.
+	//
+	// Example: "exports/production/myevent.json"
+	// Required.
+	Target string `json:"target"`
+
+	// TargetBucket is the blob URL of the bucket to move the object into. When
+	// not set, the object is moved within the bucket of the destination. It must
+	// be listed in the destination's option TargetBuckets.
+	//
+	// Example: "s3://mybucket-b?region=eu-west-1"
+	TargetBucket string `json:"target_bucket,omitempty"`
+}
+
+/*
+String returns the string representation of the action Move.
+*/
+func (a Move) String() string {
+	return "move"
+}
+
+/*
+Schedule allows the action to override the schedule options of its
+destination. Do not override.
+*/
+func (a Move) Schedule() *destination.Schedule {
+	return nil
+}
+
+/*
+Marshal is the function being run when the action receives data into
+the Move receiver. It allows to transform and enrich the data before
+saving it in the store adapter.
+*/
+func (a Move) Marshal(tk *destination.Toolkit) (*destination.Job, error) {
+
+	// Ensure the object to move and its target are valid. Moving an object onto
+	// itself would delete it once copied.
+	if validations := validateTarget("Move", a.Filename, a.Target, a.TargetBucket); len(validations) > 0 {
+		return nil, &errors.Error{
+			StatusCode:  400,
+			Message:     "Bad Request",
+			Validations: validations,
+		}
+	}
+
+	// Try to marshal the data passed directly to the receiver.
+	data, err := json.Marshal(&a)
+	if err != nil {
+		return nil, &errors.Error{
+			StatusCode: 400,
+			Message:    "Bad Request",
+		}
+	}
+
+	// Create a job with the data. Since the 'Context' key is not
+	// set, the one from the event will automatically be applied.
+	j := &destination.Job{
+		Data: data,
+	}
+
+	// Return the job including the marshaled data.
+	return j, nil
+}
+
+/*
+Load is the function being run by the scheduler to load the data into
+the destination. It is in charge of the "L" in the ETL process.
+*/
+func (a Move) Load(tk *destination.Toolkit, queue *store.Queue, then chan<- destination.Then) {
+
+	// We can go through every events received from the queue and their
+	// related jobs. The queue can contain one or many events. The jobs
+	// present in the events are specific to this action only.
+	//
+	// This allows to parse everything needed and make a request to the
+	// destination for each event / job.
+	for _, event := range queue.Events {
+		for _, job := range event.Jobs {
+
+			// Unmarshal the `data` key of the job.
+			var payload Move
+			err := json.Unmarshal(job.Data, &payload)
+			if err != nil {
+				then <- destination.Then{
+					Jobs:         []string{job.ID},
+					Error:        err,
+					ForceDiscard: true,
+				}
+
+				continue
+			}
+
+			// There is nothing to do if the target is the object itself. Copying
+			// and then deleting it would lose the object.
+			if sameObject(payload.Filename, payload.Target, payload.TargetBucket) {
+				then <- destination.Then{
+					Jobs: []string{job.ID},
+				}
+
+				continue
+			}
+
+			// Discard the job if the target bucket is not allowed, since retrying
+			// it would not help.
+			if payload.TargetBucket != "" && a.targets[payload.TargetBucket] == nil {
+				then <- destination.Then{
+					Jobs:         []string{job.ID},
+					Error:        errTargetNotAllowed(payload.TargetBucket),
+					ForceDiscard: true,
+				}
+
+				continue
+			}
+
+			// Move the object. If the object to move does not exist there is no
+			// need to retry the job.
+			err = a.move(payload)
+			then <- destination.Then{
+				Jobs:         []string{job.ID},
+				Error:        err,
+				ForceDiscard: gcerrors.Code(err) == gcerrors.NotFound,
+			}
+		}
+	}
+}
+
+/*
+move moves the object of the payload to its target by copying it and then
+deleting the original. If the original object does not exist but the target
+does, it is assumed a previous attempt has already moved the object.
+*/
+func (a Move) move(payload Move) error {
+	cp := Copy{
+		env:     a.env,
+		ctx:     a.ctx,
+		bucket:  a.bucket,
+		targets: a.targets,
+
+		Filename:     payload.Filename,
+		Target:       payload.Target,
+		TargetBucket: payload.TargetBucket,
+	}
+
+	err := cp.copy(cp)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		moved, e := a.moved(payload)
+		if e != nil {
+			return e
+		}
+
+		if moved {
+			return nil
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = a.bucket.Delete(a.ctx, payload.Filename)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return nil
+	}
+
+	return err
+}
+
+/*
+moved indicates if the target of the payload already exists.
+*/
+func (a Move) moved(payload Move) (bool, error) {
+	if payload.TargetBucket == "" {
+		return a.bucket.Exists(a.ctx, payload.Target)
+	}
+
+	target := a.targets[payload.TargetBucket]
+	if target == nil {
+		return false, errTargetNotAllowed(payload.TargetBucket)
+	}
+
+	return target.Exists(a.ctx, payload.Target)
+}
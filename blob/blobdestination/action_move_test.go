@@ -0,0 +1,150 @@
+package blobdestination
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/destination"
+
+	"gocloud.dev/blob/memblob"
+)
+
+var _ destination.Action = Move{}
+
+func TestMove_Load(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      bool
+		target      bool
+		wantErr     bool
+		wantDiscard bool
+	}{
+		{
+			name:    "WithSource",
+			source:  true,
+			target:  false,
+			wantErr: false,
+		},
+		{
+			name:    "WithAlreadyMoved",
+			source:  false,
+			target:  true,
+			wantErr: false,
+		},
+		{
+			name:        "WithMissingSource",
+			source:      false,
+			target:      false,
+			wantErr:     true,
+			wantDiscard: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+
+			if tt.source {
+				bucket.WriteAll(ctx, "staging/hello.txt", []byte("Hello, World!"), nil)
+			}
+			if tt.target {
+				bucket.WriteAll(ctx, "production/hello.txt", []byte("Hello, World!"), nil)
+			}
+
+			a := Move{
+				env:    &Options{},
+				ctx:    ctx,
+				bucket: bucket,
+			}
+
+			data, _ := json.Marshal(Move{
+				Filename: "staging/hello.txt",
+				Target:   "production/hello.txt",
+			})
+
+			got := load(a, data)
+			if (got.Error != nil) != tt.wantErr {
+				t.Fatalf("Move.Load() error = %v, wantErr %v", got.Error, tt.wantErr)
+			}
+			if got.ForceDiscard != tt.wantDiscard {
+				t.Errorf("Move.Load() discard = %v, want %v", got.ForceDiscard, tt.wantDiscard)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if exists, _ := bucket.Exists(ctx, "staging/hello.txt"); exists {
+				t.Errorf("Move.Load() source still exists")
+			}
+			if exists, _ := bucket.Exists(ctx, "production/hello.txt"); !exists {
+				t.Errorf("Move.Load() target does not exist")
+			}
+		})
+	}
+}
+
+func TestMove_Marshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  Move
+		wantErr bool
+	}{
+		{
+			name:    "WithTarget",
+			action:  Move{Filename: "staging/hello.txt", Target: "production/hello.txt"},
+			wantErr: false,
+		},
+		{
+			name:    "WithSameKeyInTargetBucket",
+			action:  Move{Filename: "staging/hello.txt", Target: "staging/hello.txt", TargetBucket: "mem://archives"},
+			wantErr: false,
+		},
+		{
+			name:    "WithSameObject",
+			action:  Move{Filename: "staging/hello.txt", Target: "staging/hello.txt"},
+			wantErr: true,
+		},
+		{
+			name:    "WithoutFilename",
+			action:  Move{Target: "production/hello.txt"},
+			wantErr: true,
+		},
+		{
+			name:    "WithoutTarget",
+			action:  Move{Filename: "staging/hello.txt"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.action.Marshal(&destination.Toolkit{}); (err != nil) != tt.wantErr {
+				t.Errorf("Move.Marshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMove_LoadSameObject(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	bucket.WriteAll(ctx, "staging/hello.txt", []byte("Hello, World!"), nil)
+
+	a := Move{
+		env:    &Options{},
+		ctx:    ctx,
+		bucket: bucket,
+	}
+
+	got := load(a, []byte(`{"filename":"staging/hello.txt","target":"staging/hello.txt"}`))
+	if got.Error != nil {
+		t.Fatalf("Move.Load() error = %v", got.Error)
+	}
+
+	if exists, _ := bucket.Exists(ctx, "staging/hello.txt"); !exists {
+		t.Errorf("Move.Load() deleted the object moved onto itself")
+	}
+}
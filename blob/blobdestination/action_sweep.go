@@ -0,0 +1,240 @@
+package blobdestination
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/destination"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+)
+
+/*
+Sweep implements the Blacksmith destination.Action interface for the action
+"sweep". It holds the complete job's structure to load into the destination.
+
+It deletes the objects of a prefix matching retention criteria, and is meant to
+be executed on a regular basis from a CRON trigger. When both MaxAge and
+Metadata are set, only objects matching both criteria are deleted.
+*/
+type Sweep struct {
+	env    *Options
+	ctx    context.Context
+	bucket *blob.Bucket
+
+	// Prefix is the prefix of the objects to sweep.
+	//
+	// Example: "exports/"
+	Prefix string `json:"prefix"`
+
+	// MaxAge is the maximum age of the objects. Objects last modified before
+	// are deleted.
+	//
+	// Example: 30 * 24 * time.Hour
+	MaxAge time.Duration `json:"max_age,omitempty"`
+
+	// Metadata is a set of metadata the objects must hold to be deleted.
+	//
+	// Example: map[string]string{"retention": "temporary"}
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+/*
+String returns the string representation of the action Sweep.
+*/
+func (a Sweep) String() string {
+	return "sweep"
+}
+
+/*
+Schedule allows the action to override the schedule options of its
+destination. Do not override.
+*/
+func (a Sweep) Schedule() *destination.Schedule {
+	return nil
+}
+
+/*
+Marshal is the function being run when the action receives data into
+the Sweep receiver. It allows to transform and enrich the data before
+saving it in the store adapter.
+*/
+func (a Sweep) Marshal(tk *destination.Toolkit) (*destination.Job, error) {
+
+	// At least one criteria must be set to not delete every objects of the
+	// prefix by mistake.
+	if a.MaxAge <= 0 && len(a.Metadata) == 0 {
+		return nil, &errors.Error{
+			StatusCode: 400,
+			Message:    "Bad Request",
+			Validations: []errors.Validation{
+				{
+					Message: "At least one of MaxAge or Metadata must be set",
+					Path:    []string{"Sweep"},
+				},
+			},
+		}
+	}
+
+	// Try to marshal the data passed directly to the receiver.
+	data, err := json.Marshal(&a)
+	if err != nil {
+		return nil, &errors.Error{
+			StatusCode: 400,
+			Message:    "Bad Request",
+		}
+	}
+
+	// Create a job with the data. Since the 'Context' key is not
+	// set, the one from the event will automatically be applied.
+	j := &destination.Job{
+		Data: data,
+	}
+
+	// Return the job including the marshaled data.
+	return j, nil
+}
+
+/*
+Load is the function being run by the scheduler to load the data into
+the destination. It is in charge of the "L" in the ETL process.
+*/
+func (a Sweep) Load(tk *destination.Toolkit, queue *store.Queue, then chan<- destination.Then) {
+
+	// We can go through every events received from the queue and their
+	// related jobs. The queue can contain one or many events. The jobs
+	// present in the events are specific to this action only.
+	//
+	// This allows to parse everything needed and make a request to the
+	// destination for each event / job.
+	for _, event := range queue.Events {
+		for _, job := range event.Jobs {
+
+			// Unmarshal the `data` key of the job.
+			var payload Sweep
+			err := json.Unmarshal(job.Data, &payload)
+			if err != nil {
+				then <- destination.Then{
+					Jobs:         []string{job.ID},
+					Error:        err,
+					ForceDiscard: true,
+				}
+
+				continue
+			}
+
+			// Sweep the prefix and report the results. A sweep failing for some
+			// objects can safely be retried since objects already deleted are
+			// not listed anymore.
+			report, err := a.sweep(payload)
+			if err == nil {
+				tk.Logger.Infof("%s: Swept prefix '%s': %d listed, %d deleted, %d failed", job.Destination, payload.Prefix, report.listed, report.deleted, len(report.failed))
+				if len(report.failed) > 0 {
+					err = &errors.Error{
+						Message:     fmt.Sprintf("blob: Failed to delete %d objects of prefix '%s'", len(report.failed), payload.Prefix),
+						Validations: report.failed,
+					}
+				}
+			}
+
+			then <- destination.Then{
+				Jobs:  []string{job.ID},
+				Error: err,
+			}
+		}
+	}
+}
+
+/*
+sweepReport holds the results of a sweep.
+*/
+type sweepReport struct {
+	listed  int
+	deleted int
+	failed  []errors.Validation
+}
+
+/*
+sweep deletes the objects of the prefix matching the criteria of the payload.
+The objects are listed first and then deleted, so the listing is not affected
+by the deletions.
+*/
+func (a Sweep) sweep(payload Sweep) (*sweepReport, error) {
+	report := &sweepReport{
+		failed: []errors.Validation{},
+	}
+
+	keys := []string{}
+	deadline := time.Now().Add(-payload.MaxAge)
+	iter := a.bucket.List(&blob.ListOptions{
+		Prefix: payload.Prefix,
+	})
+
+	for {
+		obj, err := iter.Next(a.ctx)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if obj.IsDir {
+			continue
+		}
+
+		report.listed++
+		if payload.MaxAge > 0 && !obj.ModTime.Before(deadline) {
+			continue
+		}
+
+		keys = append(keys, obj.Key)
+	}
+
+	for _, key := range keys {
+		match, err := a.match(payload, key)
+		if err == nil && match {
+			err = a.bucket.Delete(a.ctx, key)
+			if err == nil {
+				report.deleted++
+			}
+		}
+
+		if err != nil && gcerrors.Code(err) != gcerrors.NotFound {
+			report.failed = append(report.failed, errors.Validation{
+				Message: err.Error(),
+				Path:    []string{key},
+			})
+		}
+	}
+
+	return report, nil
+}
+
+/*
+match indicates if the object holds the metadata of the payload.
+*/
+func (a Sweep) match(payload Sweep, key string) (bool, error) {
+	if len(payload.Metadata) == 0 {
+		return true, nil
+	}
+
+	attrs, err := a.bucket.Attributes(a.ctx, key)
+	if err != nil {
+		return false, err
+	}
+
+	for k, v := range payload.Metadata {
+		if attrs.Metadata[strings.ToLower(k)] != v {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,141 @@
+package blobdestination
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/destination"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/memblob"
+)
+
+var _ destination.Action = Sweep{}
+
+func TestSweep_Marshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  Sweep
+		wantErr bool
+	}{
+		{
+			name: "WithNoCriteria",
+			action: Sweep{
+				Prefix: "exports/",
+			},
+			wantErr: true,
+		},
+		{
+			name: "WithMaxAge",
+			action: Sweep{
+				Prefix: "exports/",
+				MaxAge: time.Hour,
+			},
+			wantErr: false,
+		},
+		{
+			name: "WithMetadata",
+			action: Sweep{
+				Prefix:   "exports/",
+				Metadata: map[string]string{"retention": "temporary"},
+			},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.action.Marshal(&destination.Toolkit{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Sweep.Marshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSweep_Load(t *testing.T) {
+	tests := []struct {
+		name      string
+		action    Sweep
+		wantKeys  []string
+		wantSleep bool
+	}{
+		{
+			name: "WithRecentObjects",
+			action: Sweep{
+				Prefix: "exports/",
+				MaxAge: time.Hour,
+			},
+			wantKeys: []string{"archives/a.csv", "exports/a.csv", "exports/b.csv"},
+		},
+		{
+			name: "WithExpiredObjects",
+			action: Sweep{
+				Prefix: "exports/",
+				MaxAge: time.Millisecond,
+			},
+			wantKeys:  []string{"archives/a.csv"},
+			wantSleep: true,
+		},
+		{
+			name: "WithMetadata",
+			action: Sweep{
+				Prefix:   "exports/",
+				Metadata: map[string]string{"Retention": "temporary"},
+			},
+			wantKeys: []string{"archives/a.csv", "exports/a.csv"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+
+			bucket.WriteAll(ctx, "archives/a.csv", []byte("a"), nil)
+			bucket.WriteAll(ctx, "exports/a.csv", []byte("a"), nil)
+			bucket.WriteAll(ctx, "exports/b.csv", []byte("b"), &blob.WriterOptions{
+				Metadata: map[string]string{"retention": "temporary"},
+			})
+
+			if tt.wantSleep {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			a := Sweep{
+				env:    &Options{},
+				ctx:    ctx,
+				bucket: bucket,
+			}
+
+			data, _ := json.Marshal(tt.action)
+			got := load(a, data)
+			if got.Error != nil {
+				t.Fatalf("Sweep.Load() error = %v", got.Error)
+			}
+
+			keys := []string{}
+			iter := bucket.List(nil)
+			for {
+				obj, err := iter.Next(ctx)
+				if err != nil {
+					break
+				}
+
+				keys = append(keys, obj.Key)
+			}
+
+			sort.Strings(keys)
+			if len(keys) != len(tt.wantKeys) {
+				t.Fatalf("Sweep.Load() keys = %v, want %v", keys, tt.wantKeys)
+			}
+			for i := range keys {
+				if keys[i] != tt.wantKeys[i] {
+					t.Errorf("Sweep.Load() keys = %v, want %v", keys, tt.wantKeys)
+				}
+			}
+		})
+	}
+}
@@ -1,16 +1,32 @@
 package blobdestination
 
 import (
+	"bytes"
 	"context"
+	"crypto/cipher"
+	"crypto/md5"
 	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+	"time"
 
 	"github.com/nunchistudio/blacksmith/adapter/store"
 	"github.com/nunchistudio/blacksmith/destination"
 	"github.com/nunchistudio/blacksmith/helper/errors"
 
 	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+	"gocloud.dev/secrets"
 )
 
+/*
+metadataTimestamp is the metadata key used to store the timestamp of the data
+written into an object. It is used to enforce the overwrite policy.
+*/
+const metadataTimestamp = "blacksmith-timestamp"
+
 /*
 Write implements the Blacksmith destination.Action interface for the action
 "write". It holds the complete job's structure to load into the destination.
@@ -19,9 +35,32 @@ type Write struct {
 	env    *Options
 	ctx    context.Context
 	bucket *blob.Bucket
+	keeper *secrets.Keeper
 
+	// Filename is the key of the object to write into the bucket.
+	//
+	// Example: "exports/myevent.json"
+	// Required.
 	Filename string `json:"filename"`
-	Content  []byte `json:"content"`
+
+	// Content is the content of the object to write. It is embedded in the job
+	// so it should only be used for small objects. Use Source for large ones.
+	Content []byte `json:"content,omitempty"`
+
+	// Source references the content of the object to write, instead of embedding
+	// it in the job. The content is streamed from the source to the bucket when
+	// loading the job. It can be a local path, a HTTP or HTTPS URL, or a blob URL
+	// supported by gocloud. It must be allowed by the destination's option
+	// AllowedSources.
+	//
+	// Examples: "/tmp/export.csv", "https://example.com/export.csv",
+	// "s3://mybucket/export.csv"
+	Source string `json:"source,omitempty"`
+
+	// SignedURL requests a pre-signed URL of the object once written. The URL is
+	// passed to the destination's option OnSignedURL, which returns the actions
+	// to run once the job has succeeded. It is ignored if OnSignedURL is not set.
+	SignedURL *SignedURL `json:"signed_url,omitempty"`
 }
 
 /*
@@ -46,6 +85,34 @@ saving it in the store adapter.
 */
 func (a Write) Marshal(tk *destination.Toolkit) (*destination.Job, error) {
 
+	// The content can either be embedded or referenced by a source, not both.
+	if a.Source != "" && len(a.Content) > 0 {
+		return nil, &errors.Error{
+			StatusCode: 400,
+			Message:    "Bad Request",
+			Validations: []errors.Validation{
+				{
+					Message: "Content and Source must not be set at the same time",
+					Path:    []string{"Write", "Source"},
+				},
+			},
+		}
+	}
+
+	// A pre-signed URL can not expire before being generated.
+	if a.SignedURL != nil && a.SignedURL.Expiry < 0 {
+		return nil, &errors.Error{
+			StatusCode: 400,
+			Message:    "Bad Request",
+			Validations: []errors.Validation{
+				{
+					Message: "Expiry must not be negative",
+					Path:    []string{"Write", "SignedURL", "Expiry"},
+				},
+			},
+		}
+	}
+
 	// Try to marshal the data passed directly to the receiver.
 	data, err := json.Marshal(&a)
 	if err != nil {
@@ -71,48 +138,371 @@ the destination. It is in charge of the "L" in the ETL process.
 */
 func (a Write) Load(tk *destination.Toolkit, queue *store.Queue, then chan<- destination.Then) {
 
+	// Start the workers in charge of writing the objects. There are as many
+	// workers as the concurrency allowed by the destination's options. Each
+	// job is handled by a single worker, which sends exactly one result for it.
+	workers := a.env.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	pending := make(chan writeJob)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range pending {
+				then <- a.load(tk, p.event, p.job)
+			}
+		}()
+	}
+
 	// We can go through every events received from the queue and their
 	// related jobs. The queue can contain one or many events. The jobs
 	// present in the events are specific to this action only.
 	//
-	// This allows to parse everything needed and make a request to the
-	// destination for each event / job.
+	// Once the destination is shutting down, the remaining jobs are not
+	// distributed to the workers anymore and are marked as failed so they
+	// can be retried later.
 	for _, event := range queue.Events {
 		for _, job := range event.Jobs {
-
-			// Unmarshal the `data` key of the job.
-			var payload Write
-			err := json.Unmarshal(job.Data, &payload)
-			if err != nil {
+			if err := a.ctx.Err(); err != nil {
 				then <- destination.Then{
-					Jobs:         []string{job.ID},
-					Error:        err,
-					ForceDiscard: true,
+					Jobs:  []string{job.ID},
+					Error: err,
 				}
 
 				continue
 			}
 
-			// Try to open a new writer with the bucket.
-			writer, err := a.bucket.NewWriter(a.ctx, payload.Filename, nil)
-			if err != nil {
+			select {
+			case pending <- writeJob{event: event, job: job}:
+			case <-a.ctx.Done():
 				then <- destination.Then{
 					Jobs:  []string{job.ID},
-					Error: err,
+					Error: a.ctx.Err(),
 				}
-
-				continue
 			}
+		}
+	}
 
-			// Try to write the content into the bucket with given filename.
-			// If the writer didn't return an error when closing it is safe to
-			// assume the content is has successfully been written.
-			writer.Write(payload.Content)
-			err = writer.Close()
-			then <- destination.Then{
+	close(pending)
+	wg.Wait()
+}
+
+/*
+writeJob is a job to load along its event, distributed to the workers of the
+action Write.
+*/
+type writeJob struct {
+	event *store.Event
+	job   *store.Job
+}
+
+/*
+load loads a single job into the destination and returns its result.
+*/
+func (a Write) load(tk *destination.Toolkit, event *store.Event, job *store.Job) destination.Then {
+
+	// Unmarshal the `data` key of the job.
+	var payload Write
+	err := json.Unmarshal(job.Data, &payload)
+	if err != nil {
+		return destination.Then{
+			Jobs:         []string{job.ID},
+			Error:        err,
+			ForceDiscard: true,
+		}
+	}
+
+	// Discard the job if its source is not allowed, since retrying it would not
+	// help.
+	if payload.Source != "" && !a.env.allowSource(payload.Source) {
+		return destination.Then{
+			Jobs:         []string{job.ID},
+			Error:        errSourceNotAllowed(payload.Source),
+			ForceDiscard: true,
+		}
+	}
+
+	// Ensure the object can be written given the overwrite policy of the
+	// destination. A job skipped is considered as succeeded since there is
+	// nothing more to do.
+	timestamp := jobTimestamp(event, job)
+	overwrite, err := a.overwrite(payload, timestamp)
+	if err != nil {
+		return destination.Then{
+			Jobs:  []string{job.ID},
+			Error: err,
+		}
+	}
+
+	if !overwrite {
+		tk.Logger.Infof("%s: Skipping write of '%s' given overwrite policy '%s'", job.Destination, payload.Filename, a.env.OverwritePolicy)
+	} else {
+
+		// Try to write the content into the bucket with given filename. If no
+		// error is returned it is safe to assume the content has successfully
+		// been written.
+		err = a.write(payload, timestamp)
+		if err != nil {
+			return destination.Then{
 				Jobs:  []string{job.ID},
 				Error: err,
 			}
 		}
 	}
+
+	// Generate the pre-signed URL of the object if requested, and pass it to
+	// the actions to run once the job has succeeded.
+	if payload.SignedURL != nil && a.env.OnSignedURL != nil {
+		signed, err := a.bucket.SignedURL(a.ctx, payload.Filename, &blob.SignedURLOptions{
+			Expiry: payload.SignedURL.Expiry,
+		})
+		// The object has been written, so the job is discarded if the driver
+		// can not sign URLs or if the options are not valid since retrying it
+		// would not help.
+		if err != nil {
+			code := gcerrors.Code(err)
+			return destination.Then{
+				Jobs:         []string{job.ID},
+				Error:        err,
+				ForceDiscard: code == gcerrors.Unimplemented || code == gcerrors.InvalidArgument,
+			}
+		}
+
+		return destination.Then{
+			Jobs:        []string{job.ID},
+			OnSucceeded: a.env.OnSignedURL(tk, payload, signed),
+		}
+	}
+
+	return destination.Then{
+		Jobs: []string{job.ID},
+	}
+}
+
+/*
+write writes the content of the payload into the bucket, either from the content
+embedded in the job or by streaming it from its source. When the content is
+embedded, a MD5 checksum is passed to the provider so it can reject corrupted
+uploads. When the destination's encryption is enabled, the content is encrypted
+with a new data key before being written. When the destination's option
+VerifyWrites is set, the attributes of the object are read back to ensure the
+size and checksum match what has been sent.
+*/
+func (a Write) write(payload Write, timestamp time.Time) error {
+	var r io.Reader
+	var contentMD5 []byte
+
+	// Open the source if any, otherwise read from the content embedded in the
+	// job for which the checksum is known in advance.
+	if payload.Source != "" {
+		src, err := a.env.openSource(a.ctx, payload.Source)
+		if err != nil {
+			return err
+		}
+
+		defer src.Close()
+		r = src
+	} else {
+		sum := md5.Sum(payload.Content)
+		contentMD5 = sum[:]
+		r = bytes.NewReader(payload.Content)
+	}
+
+	// When encryption is enabled, generate a new data key for the object. The
+	// checksum of the content can not be used anymore since what is written is
+	// the encrypted content.
+	var aead cipher.AEAD
+	var prefix []byte
+	var metadata map[string]string
+	if a.keeper != nil {
+		var err error
+		var keyID string
+		if a.env.Encryption != nil {
+			keyID = a.env.Encryption.KeyID
+		}
+
+		aead, prefix, metadata, err = newDataKey(a.ctx, a.keeper, keyID)
+		if err != nil {
+			return err
+		}
+
+		contentMD5 = nil
+	}
+
+	// Keep track of the timestamp of the data written so the overwrite policy
+	// can be enforced by future writes.
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+
+	metadata[metadataTimestamp] = timestamp.UTC().Format(time.RFC3339Nano)
+
+	// Try to open a new writer with the bucket. The context is canceled if the
+	// content can not be written so the upload is aborted instead of committing
+	// a partial object. Objects larger than the buffer size are uploaded in
+	// multiple parts by the drivers supporting it.
+	ctx, cancel := context.WithCancel(a.ctx)
+	defer cancel()
+
+	writer, err := a.bucket.NewWriter(ctx, payload.Filename, &blob.WriterOptions{
+		BufferSize: a.env.BufferSize,
+		ContentMD5: contentMD5,
+		Metadata:   metadata,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Compute the checksum and size of what is written while streaming so the
+	// object can be verified even when the content is not known in advance.
+	d := &digest{
+		hash: md5.New(),
+	}
+
+	var w io.WriteCloser = nopCloser{io.MultiWriter(writer, d)}
+	if aead != nil {
+		w = &encryptWriter{
+			w:      io.MultiWriter(writer, d),
+			aead:   aead,
+			prefix: prefix,
+		}
+	}
+
+	_, err = io.Copy(w, r)
+	if err == nil {
+		err = w.Close()
+	}
+
+	if err != nil {
+		cancel()
+		writer.Close()
+		return err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	if !a.env.VerifyWrites {
+		return nil
+	}
+
+	// Read back the attributes of the object and compare them with the content
+	// sent. Some providers do not return a MD5 checksum, in which case only the
+	// size can be verified.
+	attrs, err := a.bucket.Attributes(a.ctx, payload.Filename)
+	if err != nil {
+		return err
+	}
+
+	if attrs.Size != d.size {
+		return &errors.Error{
+			Message: fmt.Sprintf("blob: Size mismatch for '%s': wrote %d bytes, got %d", payload.Filename, d.size, attrs.Size),
+		}
+	}
+
+	if len(attrs.MD5) > 0 && !bytes.Equal(attrs.MD5, d.hash.Sum(nil)) {
+		return &errors.Error{
+			Message: fmt.Sprintf("blob: Checksum mismatch for '%s'", payload.Filename),
+		}
+	}
+
+	return nil
+}
+
+/*
+canSign ensures the bucket is able to generate pre-signed URLs, by signing the
+URL of an object that does not need to exist. Signing does not require to reach
+the provider for most drivers.
+*/
+func canSign(ctx context.Context, bucket *blob.Bucket) error {
+	_, err := bucket.SignedURL(ctx, "blacksmith-signing-check", &blob.SignedURLOptions{
+		Expiry: time.Minute,
+	})
+
+	return err
+}
+
+/*
+overwrite indicates if the object of the payload can be written given the
+overwrite policy of the destination. The existence check and the write are not
+atomic, so concurrent writes of the same object may still overwrite each other.
+*/
+func (a Write) overwrite(payload Write, timestamp time.Time) (bool, error) {
+	switch a.env.OverwritePolicy {
+	case OverwriteNever:
+		exists, err := a.bucket.Exists(a.ctx, payload.Filename)
+		return !exists, err
+
+	case OverwriteIfNewer:
+		attrs, err := a.bucket.Attributes(a.ctx, payload.Filename)
+		if gcerrors.Code(err) == gcerrors.NotFound {
+			return true, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		// Objects without a valid timestamp have not been written by the
+		// destination and are considered older.
+		existing, err := time.Parse(time.RFC3339Nano, attrs.Metadata[metadataTimestamp])
+		if err != nil {
+			return true, nil
+		}
+
+		return timestamp.After(existing), nil
+	}
+
+	return true, nil
+}
+
+/*
+jobTimestamp returns the timestamp of the data held by a job. It is the time the
+event has been sent by the source if any, or the time it has been received by
+the gateway otherwise.
+*/
+func jobTimestamp(event *store.Event, job *store.Job) time.Time {
+	if event.SentAt != nil && !event.SentAt.IsZero() {
+		return *event.SentAt
+	}
+
+	if !event.ReceivedAt.IsZero() {
+		return event.ReceivedAt
+	}
+
+	return job.CreatedAt
+}
+
+/*
+digest computes the checksum and size of the content written into it.
+*/
+type digest struct {
+	hash hash.Hash
+	size int64
+}
+
+/*
+Write adds the content to the checksum and size of the digest.
+*/
+func (d *digest) Write(p []byte) (int, error) {
+	d.size += int64(len(p))
+	return d.hash.Write(p)
+}
+
+/*
+nopCloser adds a no-op Close method to a writer.
+*/
+type nopCloser struct {
+	io.Writer
+}
+
+/*
+Close does nothing.
+*/
+func (nopCloser) Close() error {
+	return nil
 }
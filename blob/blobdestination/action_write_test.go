@@ -1,7 +1,497 @@
 package blobdestination
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
 	"github.com/nunchistudio/blacksmith/destination"
+	"github.com/nunchistudio/blacksmith/helper/logger"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/fileblob"
+	"gocloud.dev/blob/memblob"
 )
 
 var _ destination.Action = Write{}
+
+func TestWrite_Load(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello, World!"))
+	}))
+	defer srv.Close()
+
+	valid, _ := json.Marshal(Write{
+		Filename: "hello.txt",
+		Content:  []byte("Hello, World!"),
+	})
+
+	streamed, _ := json.Marshal(Write{
+		Filename: "hello.txt",
+		Source:   srv.URL,
+	})
+
+	tests := []struct {
+		name        string
+		env         *Options
+		data        []byte
+		wantErr     bool
+		wantDiscard bool
+	}{
+		{
+			name:    "WithValidContent",
+			env:     &Options{},
+			data:    valid,
+			wantErr: false,
+		},
+		{
+			name: "WithVerifyWrites",
+			env: &Options{
+				VerifyWrites: true,
+			},
+			data:    valid,
+			wantErr: false,
+		},
+		{
+			name: "WithSource",
+			env: &Options{
+				VerifyWrites:   true,
+				BufferSize:     5,
+				AllowedSources: []string{srv.URL},
+			},
+			data:    streamed,
+			wantErr: false,
+		},
+		{
+			name:        "WithSourceNotAllowed",
+			env:         &Options{},
+			data:        streamed,
+			wantErr:     true,
+			wantDiscard: true,
+		},
+		{
+			name:        "WithInvalidData",
+			env:         &Options{},
+			data:        []byte("{"),
+			wantErr:     true,
+			wantDiscard: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+
+			a := Write{
+				env:    tt.env,
+				ctx:    context.Background(),
+				bucket: bucket,
+			}
+
+			got := load(a, tt.data)
+			if (got.Error != nil) != tt.wantErr {
+				t.Fatalf("Write.Load() error = %v, wantErr %v", got.Error, tt.wantErr)
+			}
+			if got.ForceDiscard != tt.wantDiscard {
+				t.Errorf("Write.Load() discard = %v, want %v", got.ForceDiscard, tt.wantDiscard)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			content, err := bucket.ReadAll(context.Background(), "hello.txt")
+			if err != nil {
+				t.Fatalf("bucket.ReadAll() error = %v", err)
+			}
+			if string(content) != "Hello, World!" {
+				t.Errorf("bucket.ReadAll() = %s, want %s", content, "Hello, World!")
+			}
+		})
+	}
+}
+
+func TestWrite_Marshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  Write
+		wantErr bool
+	}{
+		{
+			name: "WithContent",
+			action: Write{
+				Filename: "hello.txt",
+				Content:  []byte("Hello, World!"),
+			},
+			wantErr: false,
+		},
+		{
+			name: "WithSource",
+			action: Write{
+				Filename: "hello.txt",
+				Source:   "/tmp/hello.txt",
+			},
+			wantErr: false,
+		},
+		{
+			name: "WithContentAndSource",
+			action: Write{
+				Filename: "hello.txt",
+				Content:  []byte("Hello, World!"),
+				Source:   "/tmp/hello.txt",
+			},
+			wantErr: true,
+		},
+		{
+			name: "WithNegativeSignedURLExpiry",
+			action: Write{
+				Filename:  "hello.txt",
+				Content:   []byte("Hello, World!"),
+				SignedURL: &SignedURL{Expiry: -time.Minute},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.action.Marshal(&destination.Toolkit{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Write.Marshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWrite_LoadOverwritePolicy(t *testing.T) {
+	now := time.Now()
+	before := now.Add(-time.Hour)
+	after := now.Add(time.Hour)
+
+	tests := []struct {
+		name        string
+		policy      OverwritePolicy
+		existing    map[string]string
+		sentAt      time.Time
+		wantContent string
+	}{
+		{
+			name:        "WithAlways",
+			policy:      OverwriteAlways,
+			existing:    map[string]string{metadataTimestamp: now.Format(time.RFC3339Nano)},
+			sentAt:      before,
+			wantContent: "new",
+		},
+		{
+			name:        "WithNever",
+			policy:      OverwriteNever,
+			existing:    map[string]string{metadataTimestamp: now.Format(time.RFC3339Nano)},
+			sentAt:      after,
+			wantContent: "old",
+		},
+		{
+			name:        "WithIfNewerAndOlderData",
+			policy:      OverwriteIfNewer,
+			existing:    map[string]string{metadataTimestamp: now.Format(time.RFC3339Nano)},
+			sentAt:      before,
+			wantContent: "old",
+		},
+		{
+			name:        "WithIfNewerAndNewerData",
+			policy:      OverwriteIfNewer,
+			existing:    map[string]string{metadataTimestamp: now.Format(time.RFC3339Nano)},
+			sentAt:      after,
+			wantContent: "new",
+		},
+		{
+			name:        "WithIfNewerAndNoTimestamp",
+			policy:      OverwriteIfNewer,
+			existing:    nil,
+			sentAt:      before,
+			wantContent: "new",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+
+			bucket.WriteAll(ctx, "hello.txt", []byte("old"), &blob.WriterOptions{
+				Metadata: tt.existing,
+			})
+
+			a := Write{
+				env: &Options{
+					OverwritePolicy: tt.policy,
+				},
+				ctx:    ctx,
+				bucket: bucket,
+			}
+
+			data, _ := json.Marshal(Write{
+				Filename: "hello.txt",
+				Content:  []byte("new"),
+			})
+
+			queue := &store.Queue{
+				Events: []*store.Event{
+					{
+						ID:     "event",
+						SentAt: &tt.sentAt,
+						Jobs: []*store.Job{
+							{
+								ID:   "job",
+								Data: data,
+							},
+						},
+					},
+				},
+			}
+
+			then := make(chan destination.Then, 1)
+			a.Load(&destination.Toolkit{
+				Logger: logger.Default,
+			}, queue, then)
+
+			got := <-then
+			if got.Error != nil {
+				t.Fatalf("Write.Load() error = %v", got.Error)
+			}
+
+			content, _ := bucket.ReadAll(ctx, "hello.txt")
+			if string(content) != tt.wantContent {
+				t.Errorf("Write.Load() content = %s, want %s", content, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestWrite_LoadConcurrency(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		concurrency int
+		wantErr     bool
+	}{
+		{
+			name:        "WithSequentialWrites",
+			ctx:         context.Background(),
+			concurrency: 1,
+			wantErr:     false,
+		},
+		{
+			name:        "WithConcurrentWrites",
+			ctx:         context.Background(),
+			concurrency: 8,
+			wantErr:     false,
+		},
+		{
+			name:        "WithCanceledContext",
+			ctx:         canceled,
+			concurrency: 8,
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+
+			a := Write{
+				env: &Options{
+					Concurrency: tt.concurrency,
+				},
+				ctx:    tt.ctx,
+				bucket: bucket,
+			}
+
+			queue := &store.Queue{}
+			for i := 0; i < 10; i++ {
+				event := &store.Event{
+					ID: fmt.Sprintf("event-%d", i),
+				}
+
+				for j := 0; j < 10; j++ {
+					data, _ := json.Marshal(Write{
+						Filename: fmt.Sprintf("%d/%d.txt", i, j),
+						Content:  []byte("Hello, World!"),
+					})
+
+					event.Jobs = append(event.Jobs, &store.Job{
+						ID:   fmt.Sprintf("job-%d-%d", i, j),
+						Data: data,
+					})
+				}
+
+				queue.Events = append(queue.Events, event)
+			}
+
+			then := make(chan destination.Then)
+			go func() {
+				a.Load(&destination.Toolkit{
+					Logger: logger.Default,
+				}, queue, then)
+				close(then)
+			}()
+
+			results := map[string]int{}
+			for got := range then {
+				if (got.Error != nil) != tt.wantErr {
+					t.Errorf("Write.Load() error = %v, wantErr %v", got.Error, tt.wantErr)
+				}
+
+				for _, id := range got.Jobs {
+					results[id]++
+				}
+			}
+
+			if len(results) != 100 {
+				t.Errorf("Write.Load() results = %d, want %d", len(results), 100)
+			}
+			for id, count := range results {
+				if count != 1 {
+					t.Errorf("Write.Load() results for %s = %d, want 1", id, count)
+				}
+			}
+		})
+	}
+}
+
+func TestWrite_LoadSignedURL(t *testing.T) {
+	base, _ := url.Parse("https://example.com/download")
+	bucket, err := fileblob.OpenBucket(t.TempDir(), &fileblob.Options{
+		URLSigner: fileblob.NewURLSignerHMAC(base, []byte("secret")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer bucket.Close()
+	tests := []struct {
+		name          string
+		signedURL     *SignedURL
+		wantSucceeded int
+	}{
+		{
+			name:          "WithSignedURL",
+			signedURL:     &SignedURL{Expiry: time.Minute},
+			wantSucceeded: 1,
+		},
+		{
+			name:          "WithoutSignedURL",
+			signedURL:     nil,
+			wantSucceeded: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := Write{
+				env: &Options{
+					OnSignedURL: func(tk *destination.Toolkit, payload Write, signed string) []destination.Action {
+						return []destination.Action{
+							Write{
+								Filename: payload.Filename + ".link",
+								Content:  []byte(signed),
+							},
+						}
+					},
+				},
+				ctx:    context.Background(),
+				bucket: bucket,
+			}
+
+			data, _ := json.Marshal(Write{
+				Filename:  "export.csv",
+				Content:   []byte("Hello, World!"),
+				SignedURL: tt.signedURL,
+			})
+
+			got := load(a, data)
+			if got.Error != nil {
+				t.Fatalf("Write.Load() error = %v", got.Error)
+			}
+			if len(got.OnSucceeded) != tt.wantSucceeded {
+				t.Fatalf("Write.Load() OnSucceeded = %d, want %d", len(got.OnSucceeded), tt.wantSucceeded)
+			}
+			if tt.wantSucceeded == 0 {
+				return
+			}
+
+			link := string(got.OnSucceeded[0].(Write).Content)
+			if !strings.HasPrefix(link, base.String()) {
+				t.Errorf("Write.Load() signed URL = %s, want prefix %s", link, base)
+			}
+		})
+	}
+}
+
+func TestWrite_LoadSignedURLUnsupported(t *testing.T) {
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	if err := canSign(context.Background(), bucket); err == nil {
+		t.Fatalf("canSign() error = nil, want unsupported driver")
+	}
+
+	a := Write{
+		env: &Options{
+			OnSignedURL: func(tk *destination.Toolkit, payload Write, signed string) []destination.Action {
+				return nil
+			},
+		},
+		ctx:    context.Background(),
+		bucket: bucket,
+	}
+
+	data, _ := json.Marshal(Write{
+		Filename:  "export.csv",
+		Content:   []byte("Hello, World!"),
+		SignedURL: &SignedURL{Expiry: time.Minute},
+	})
+
+	got := load(a, data)
+	if got.Error == nil || !got.ForceDiscard {
+		t.Errorf("Write.Load() = %+v, want discarded job", got)
+	}
+}
+
+func TestWrite_LoadSignedURLInvalid(t *testing.T) {
+	base, _ := url.Parse("https://example.com/download")
+	bucket, err := fileblob.OpenBucket(t.TempDir(), &fileblob.Options{
+		URLSigner: fileblob.NewURLSignerHMAC(base, []byte("secret")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer bucket.Close()
+	a := Write{
+		env: &Options{
+			OnSignedURL: func(tk *destination.Toolkit, payload Write, signed string) []destination.Action {
+				return nil
+			},
+		},
+		ctx:    context.Background(),
+		bucket: bucket,
+	}
+
+	data, _ := json.Marshal(Write{
+		Filename:  "export.csv",
+		Content:   []byte("Hello, World!"),
+		SignedURL: &SignedURL{Expiry: -time.Minute},
+	})
+
+	got := load(a, data)
+	if got.Error == nil || !got.ForceDiscard {
+		t.Errorf("Write.Load() = %+v, want discarded job", got)
+	}
+}
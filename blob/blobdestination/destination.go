@@ -12,6 +12,7 @@ import (
 	_ "gocloud.dev/blob/azureblob"
 	_ "gocloud.dev/blob/gcsblob"
 	_ "gocloud.dev/blob/s3blob"
+	"gocloud.dev/secrets"
 )
 
 /*
@@ -22,7 +23,10 @@ type Blob struct {
 	options *destination.Options
 	env     *Options
 	ctx     context.Context
+	cancel  context.CancelFunc
 	bucket  *blob.Bucket
+	targets map[string]*blob.Bucket
+	keeper  *secrets.Keeper
 }
 
 /*
@@ -68,6 +72,8 @@ func (d *Blob) Init(tk *destination.Toolkit) error {
 	switch d.env.Driver {
 	case DriverAWSS3:
 		bucket, err = blob.OpenBucket(d.ctx, "s3://"+url)
+	case DriverS3Compatible:
+		bucket, err = d.env.S3Compatible.open(d.ctx, d.env.Connection)
 	case DriverAzureBlob:
 		bucket, err = blob.OpenBucket(d.ctx, "azblob://"+url)
 	case DriverGoogleStorage:
@@ -85,25 +91,96 @@ func (d *Blob) Init(tk *destination.Toolkit) error {
 	}
 
 	d.bucket = bucket
+
+	// Ensure the bucket can sign URLs if the action Write can request them, so
+	// jobs do not fail forever once their object has been written.
+	if d.env.OnSignedURL != nil {
+		if err := canSign(d.ctx, bucket); err != nil {
+			d.Shutdown(tk)
+			return &errors.Error{
+				Message: fmt.Sprintf("%s: Driver can not generate signed URLs: %s", d.String(), err.Error()),
+			}
+		}
+	}
+
+	// Create a context canceled when shutting down the destination, so actions
+	// in progress can stop as soon as possible.
+	d.ctx, d.cancel = context.WithCancel(d.ctx)
+
+	// Open the buckets the actions Copy and Move are allowed to write into, so
+	// they are not opened for every job.
+	d.targets = map[string]*blob.Bucket{}
+	for _, target := range d.env.TargetBuckets {
+		bucket, err := blob.OpenBucket(d.ctx, target)
+		if err != nil {
+			d.Shutdown(tk)
+			return &errors.Error{
+				Message: fmt.Sprintf("%s: %s", d.String(), err.Error()),
+			}
+		}
+
+		d.targets[target] = bucket
+	}
+
+	// Open the keeper wrapping the data keys if encryption is enabled.
+	if d.env.Encryption != nil {
+		keeper, err := d.env.Encryption.keeper(d.ctx)
+		if err != nil {
+			d.Shutdown(tk)
+			return &errors.Error{
+				Message: fmt.Sprintf("%s: %s", d.String(), err.Error()),
+			}
+		}
+
+		d.keeper = keeper
+	}
+
 	return nil
 }
 
 /*
 Shutdown is part of the destination.WithHooks interface. It allows to properly
 close the connection with the bucket. It is called when shutting down the
-scheduler service.
+scheduler service, and when the destination fails to initialize so the
+connections already opened are closed.
+
+Every connection is closed even if closing one of them fails. The first failure
+is returned.
 */
 func (d *Blob) Shutdown(tk *destination.Toolkit) error {
+	var fail error
+	if d.cancel != nil {
+		d.cancel()
+	}
+
 	if d.bucket != nil {
 		err := d.bucket.Close()
-		if err != nil {
-			return &errors.Error{
+		if err != nil && fail == nil {
+			fail = &errors.Error{
 				Message: fmt.Sprintf("%s: Failed to properly close connection with bucket", d.String()),
 			}
 		}
 	}
 
-	return nil
+	for _, target := range d.targets {
+		err := target.Close()
+		if err != nil && fail == nil {
+			fail = &errors.Error{
+				Message: fmt.Sprintf("%s: Failed to properly close connection with target bucket", d.String()),
+			}
+		}
+	}
+
+	if d.keeper != nil {
+		err := d.keeper.Close()
+		if err != nil && fail == nil {
+			fail = &errors.Error{
+				Message: fmt.Sprintf("%s: Failed to properly close connection with keeper", d.String()),
+			}
+		}
+	}
+
+	return fail
 }
 
 /*
@@ -123,6 +200,29 @@ func (d *Blob) Actions() map[string]destination.Action {
 			env:    d.env,
 			ctx:    d.ctx,
 			bucket: d.bucket,
+			keeper: d.keeper,
+		},
+		"copy": Copy{
+			env:     d.env,
+			ctx:     d.ctx,
+			bucket:  d.bucket,
+			targets: d.targets,
+		},
+		"move": Move{
+			env:     d.env,
+			ctx:     d.ctx,
+			bucket:  d.bucket,
+			targets: d.targets,
+		},
+		"delete": Delete{
+			env:    d.env,
+			ctx:    d.ctx,
+			bucket: d.bucket,
+		},
+		"sweep": Sweep{
+			env:    d.env,
+			ctx:    d.ctx,
+			bucket: d.bucket,
 		},
 	}
 }
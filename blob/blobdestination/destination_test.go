@@ -6,14 +6,43 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/nunchistudio/blacksmith/adapter/store"
 	"github.com/nunchistudio/blacksmith/destination"
 	"github.com/nunchistudio/blacksmith/helper/logger"
 
 	"github.com/sirupsen/logrus"
+
+	"gocloud.dev/gcerrors"
 )
 
 var _ destination.Destination = &Blob{}
 
+/*
+load runs the action against a queue containing a single job with the given
+data, and returns the result sent by the action.
+*/
+func load(a destination.Action, data []byte) destination.Then {
+	queue := &store.Queue{
+		Events: []*store.Event{
+			{
+				ID: "event",
+				Jobs: []*store.Job{
+					{
+						ID:   "job",
+						Data: data,
+					},
+				},
+			},
+		},
+	}
+
+	then := make(chan destination.Then, 1)
+	a.Load(&destination.Toolkit{
+		Logger: logger.Default,
+	}, queue, then)
+	return <-then
+}
+
 func TestNew(t *testing.T) {
 	var fatal bool
 	logger.Default.Level = logrus.PanicLevel
@@ -73,12 +102,14 @@ func TestNew(t *testing.T) {
 					},
 				},
 				env: &Options{
-					Realtime:   false,
-					Interval:   destination.Defaults.DefaultSchedule.Interval,
-					MaxRetries: 10,
-					Name:       "fakename",
-					Driver:     DriverTest,
-					Connection: "conn://fakeurl",
+					Realtime:        false,
+					Interval:        destination.Defaults.DefaultSchedule.Interval,
+					MaxRetries:      10,
+					Name:            "fakename",
+					Driver:          DriverTest,
+					OverwritePolicy: OverwriteAlways,
+					Concurrency:     1,
+					Connection:      "conn://fakeurl",
 					Params: url.Values{
 						"hello": {"world"},
 					},
@@ -111,12 +142,14 @@ func TestNew(t *testing.T) {
 					},
 				},
 				env: &Options{
-					Realtime:   false,
-					Interval:   "@every 1h",
-					MaxRetries: destination.Defaults.DefaultSchedule.MaxRetries,
-					Name:       "fakename",
-					Driver:     DriverTest,
-					Connection: "conn://fakeurl",
+					Realtime:        false,
+					Interval:        "@every 1h",
+					MaxRetries:      destination.Defaults.DefaultSchedule.MaxRetries,
+					Name:            "fakename",
+					Driver:          DriverTest,
+					OverwritePolicy: OverwriteAlways,
+					Concurrency:     1,
+					Connection:      "conn://fakeurl",
 					Params: url.Values{
 						"hello": {"world"},
 					},
@@ -201,13 +234,15 @@ func TestNew(t *testing.T) {
 					},
 				},
 				env: &Options{
-					Realtime:   false,
-					Interval:   "@every 1h",
-					MaxRetries: 10,
-					Name:       "fakename",
-					Driver:     DriverTest,
-					Connection: "conn://fakeurl",
-					Params:     nil,
+					Realtime:        false,
+					Interval:        "@every 1h",
+					MaxRetries:      10,
+					Name:            "fakename",
+					Driver:          DriverTest,
+					OverwritePolicy: OverwriteAlways,
+					Concurrency:     1,
+					Connection:      "conn://fakeurl",
+					Params:          nil,
 				},
 				ctx: context.Background(),
 			},
@@ -228,3 +263,32 @@ func TestNew(t *testing.T) {
 		})
 	}
 }
+
+func TestBlob_InitFailure(t *testing.T) {
+	d := New(&Options{
+		Driver:     DriverS3Compatible,
+		Name:       "fakename",
+		Connection: "fakebucket",
+		S3Compatible: &S3Compatible{
+			Endpoint:        "http://localhost:9000",
+			PathStyle:       true,
+			DisableSSL:      true,
+			AccessKeyID:     "minioadmin",
+			SecretAccessKey: "minioadmin",
+		},
+		TargetBuckets: []string{"mem://archives", "unknown://archives"},
+	}).(*Blob)
+
+	if err := d.Init(&destination.Toolkit{}); err == nil {
+		t.Fatalf("Blob.Init() error = nil, want error for target bucket")
+	}
+
+	// The buckets opened before the failure must be closed.
+	ctx := context.Background()
+	if _, err := d.bucket.Exists(ctx, "hello.txt"); gcerrors.Code(err) != gcerrors.FailedPrecondition {
+		t.Errorf("bucket.Exists() error = %v, want bucket closed", err)
+	}
+	if _, err := d.targets["mem://archives"].Exists(ctx, "hello.txt"); gcerrors.Code(err) != gcerrors.FailedPrecondition {
+		t.Errorf("bucket.Exists() error = %v, want target bucket closed", err)
+	}
+}
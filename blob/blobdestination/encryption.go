@@ -0,0 +1,508 @@
+package blobdestination
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/secrets"
+	_ "gocloud.dev/secrets/awskms"
+	_ "gocloud.dev/secrets/azurekeyvault"
+	_ "gocloud.dev/secrets/gcpkms"
+	"gocloud.dev/secrets/localsecrets"
+)
+
+/*
+Metadata keys used to store the encryption details along the objects. The data
+key is stored wrapped by the key encryption key and can not be used as is.
+*/
+const (
+	metadataEncryptionAlgorithm = "encryption-algorithm"
+	metadataEncryptionKey       = "encryption-key"
+	metadataEncryptionKeyID     = "encryption-key-id"
+	metadataEncryptionNonce     = "encryption-nonce"
+)
+
+/*
+encryptionAlgorithm is the name of the algorithm used to encrypt the objects. The
+content is split into segments of segmentSize bytes, each one being encrypted
+with AES-256-GCM so large objects can be streamed without being fully loaded in
+memory.
+*/
+const encryptionAlgorithm = "AES-256-GCM-STREAM-64K"
+
+/*
+segmentSize is the size in bytes of the plaintext of every encrypted segment.
+*/
+const segmentSize = 64 * 1024
+
+/*
+Encryption holds the options to enable client-side envelope encryption of the
+objects written into the bucket. Every object is encrypted with its own data
+key, which is then wrapped by the key encryption key and stored in the object's
+metadata along the ID of the key.
+
+Only one of KeyURL and KeyFile must be set.
+
+Keys can be rotated by setting a new key along a new KeyID, and by moving the
+previous one to DecryptionKeys so existing objects can still be read.
+*/
+type Encryption struct {
+
+	// KeyID is the identifier of the key encryption key, stored in the metadata
+	// of the objects encrypted with it. It allows to find the key to use when
+	// decrypting an object once keys have been rotated.
+	//
+	// Example: "2021-05"
+	// Required if DecryptionKeys is set.
+	KeyID string
+
+	// KeyURL is the URL of the key encryption key, as supported by the gocloud
+	// secrets package.
+	//
+	// Format for AWS KMS: "awskms://<key-id>?region=<region>"
+	// Format for Azure Key Vault: "azurekeyvault://<vault>.vault.azure.net/keys/<key>"
+	// Format for Google Cloud KMS: "gcpkms://projects/<project>/locations/<location>/keyRings/<keyring>/cryptoKeys/<key>"
+	// Format for a local key: "base64key://<base64-key>"
+	KeyURL string
+
+	// KeyFile is the path to a local file holding the key encryption key. The
+	// file must contain a base64-encoded 32 bytes key.
+	//
+	// Example: "/etc/blacksmith/blob.key"
+	KeyFile string
+
+	// DecryptionKeys is the list of previous key encryption keys, only used to
+	// decrypt the objects encrypted before the keys have been rotated. Objects
+	// written without a key ID are decrypted by trying every key.
+	DecryptionKeys []EncryptionKey
+
+	// AllowPlaintext allows NewDecryptedReader to read the objects not encrypted,
+	// such as the ones written before encryption was enabled. Otherwise, reading
+	// an object without encryption metadata fails so its content is never mistaken
+	// for decrypted data.
+	AllowPlaintext bool
+}
+
+/*
+EncryptionKey is a previous key encryption key, used to decrypt the objects
+encrypted with it. Only one of KeyURL and KeyFile must be set.
+*/
+type EncryptionKey struct {
+
+	// KeyID is the identifier of the key, as it was stored in the metadata of
+	// the objects encrypted with it.
+	//
+	// Required.
+	KeyID string
+
+	// KeyURL is the URL of the key, as supported by the gocloud secrets package.
+	KeyURL string
+
+	// KeyFile is the path to a local file holding the base64-encoded key.
+	KeyFile string
+}
+
+/*
+validate ensures the encryption options are valid.
+*/
+func (enc *Encryption) validate(name string) []errors.Validation {
+	validations := []errors.Validation{}
+
+	if (enc.KeyURL == "") == (enc.KeyFile == "") {
+		validations = append(validations, errors.Validation{
+			Message: "Exactly one of 'KeyURL' or 'KeyFile' must be set",
+			Path:    []string{"Options", "Destinations", name, "Encryption"},
+		})
+	}
+
+	if len(enc.DecryptionKeys) > 0 && enc.KeyID == "" {
+		validations = append(validations, errors.Validation{
+			Message: "Key ID must be set when decryption keys are set",
+			Path:    []string{"Options", "Destinations", name, "Encryption", "KeyID"},
+		})
+	}
+
+	seen := map[string]bool{
+		enc.KeyID: true,
+	}
+
+	for i, key := range enc.DecryptionKeys {
+		index := fmt.Sprintf("%d", i)
+		if key.KeyID == "" || seen[key.KeyID] {
+			validations = append(validations, errors.Validation{
+				Message: "Key ID must be set and unique",
+				Path:    []string{"Options", "Destinations", name, "Encryption", "DecryptionKeys", index, "KeyID"},
+			})
+		}
+
+		if (key.KeyURL == "") == (key.KeyFile == "") {
+			validations = append(validations, errors.Validation{
+				Message: "Exactly one of 'KeyURL' or 'KeyFile' must be set",
+				Path:    []string{"Options", "Destinations", name, "Encryption", "DecryptionKeys", index},
+			})
+		}
+
+		seen[key.KeyID] = true
+	}
+
+	return validations
+}
+
+/*
+keys returns the current key encryption key followed by the decryption keys.
+*/
+func (enc *Encryption) keys() []EncryptionKey {
+	keys := []EncryptionKey{
+		{
+			KeyID:   enc.KeyID,
+			KeyURL:  enc.KeyURL,
+			KeyFile: enc.KeyFile,
+		},
+	}
+
+	return append(keys, enc.DecryptionKeys...)
+}
+
+/*
+keeper opens the keeper wrapping and unwrapping the data keys with the current
+key encryption key. It is up to the caller to close the keeper returned.
+*/
+func (enc *Encryption) keeper(ctx context.Context) (*secrets.Keeper, error) {
+	return enc.keys()[0].keeper(ctx)
+}
+
+/*
+keeper opens the keeper wrapping and unwrapping the data keys with the key. It
+is up to the caller to close the keeper returned.
+*/
+func (key EncryptionKey) keeper(ctx context.Context) (*secrets.Keeper, error) {
+	if key.KeyURL != "" {
+		return secrets.OpenKeeper(ctx, key.KeyURL)
+	}
+
+	content, err := ioutil.ReadFile(key.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := localsecrets.Base64KeyStd(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, err
+	}
+
+	return localsecrets.NewKeeper(decoded), nil
+}
+
+/*
+unwrap unwraps the data key of an object with the key encryption key it has
+been encrypted with. Objects written without a key ID are unwrapped by trying
+every key, starting with the current one.
+*/
+func (enc *Encryption) unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	var err error
+	for _, key := range enc.keys() {
+		if keyID != "" && key.KeyID != keyID {
+			continue
+		}
+
+		var keeper *secrets.Keeper
+		keeper, err = key.keeper(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var dataKey []byte
+		dataKey, err = keeper.Decrypt(ctx, wrapped)
+		keeper.Close()
+		if err == nil {
+			return dataKey, nil
+		}
+	}
+
+	if err == nil {
+		err = &errors.Error{
+			Message: fmt.Sprintf("blob: Key '%s' not found in encryption options", keyID),
+		}
+	}
+
+	return nil, err
+}
+
+/*
+newDataKey generates a new data key and returns the cipher to use along the
+metadata to store with the object. The ID of the key encryption key is stored
+in the metadata if set.
+*/
+func newDataKey(ctx context.Context, keeper *secrets.Keeper, keyID string) (cipher.AEAD, []byte, map[string]string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, nil, err
+	}
+
+	prefix := make([]byte, 7)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, nil, nil, err
+	}
+
+	wrapped, err := keeper.Encrypt(ctx, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	metadata := map[string]string{
+		metadataEncryptionAlgorithm: encryptionAlgorithm,
+		metadataEncryptionKey:       base64.StdEncoding.EncodeToString(wrapped),
+		metadataEncryptionNonce:     base64.StdEncoding.EncodeToString(prefix),
+	}
+
+	if keyID != "" {
+		metadata[metadataEncryptionKeyID] = keyID
+	}
+
+	return aead, prefix, metadata, nil
+}
+
+/*
+newAEAD returns the AES-GCM cipher for the given data key.
+*/
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+/*
+segmentNonce returns the nonce of a segment. It is made of the nonce prefix of
+the object, the index of the segment, and a flag indicating if the segment is
+the last one so an object can not be truncated without being noticed.
+*/
+func segmentNonce(prefix []byte, index uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[7:11], index)
+	if last {
+		nonce[11] = 1
+	}
+
+	return nonce
+}
+
+/*
+encryptWriter encrypts the content written into it, segment by segment, before
+writing it into the underlying writer. Close must be called to write the last
+segment.
+*/
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	prefix []byte
+	index  uint32
+	buf    []byte
+}
+
+/*
+Write buffers the content and encrypts every complete segment. A complete
+segment is only written once more content is received, so the last segment
+can be flagged as such when closing the writer.
+*/
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	e.buf = append(e.buf, p...)
+	for len(e.buf) > segmentSize {
+		if err := e.seal(e.buf[:segmentSize], false); err != nil {
+			return 0, err
+		}
+
+		e.buf = e.buf[segmentSize:]
+	}
+
+	return len(p), nil
+}
+
+/*
+Close encrypts and writes the last segment. It does not close the underlying
+writer.
+*/
+func (e *encryptWriter) Close() error {
+	err := e.seal(e.buf, true)
+	e.buf = nil
+	return err
+}
+
+/*
+seal encrypts a segment and writes it into the underlying writer.
+*/
+func (e *encryptWriter) seal(segment []byte, last bool) error {
+	nonce := segmentNonce(e.prefix, e.index, last)
+	e.index++
+
+	_, err := e.w.Write(e.aead.Seal(nil, nonce, segment, nil))
+	return err
+}
+
+/*
+decryptReader decrypts the content read from the underlying reader, segment by
+segment.
+*/
+type decryptReader struct {
+	r      *bufio.Reader
+	closer io.Closer
+	aead   cipher.AEAD
+	prefix []byte
+	index  uint32
+	buf    []byte
+	done   bool
+}
+
+/*
+Read returns the decrypted content of the object.
+*/
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+/*
+open reads and decrypts the next segment. The segment is the last one if no
+more content is available after it.
+*/
+func (d *decryptReader) open() error {
+	segment := make([]byte, segmentSize+d.aead.Overhead())
+	n, err := io.ReadFull(d.r, segment)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return err
+	}
+
+	last := err == io.ErrUnexpectedEOF
+	if !last {
+		if _, err := d.r.Peek(1); err == io.EOF {
+			last = true
+		}
+	}
+
+	nonce := segmentNonce(d.prefix, d.index, last)
+	d.index++
+
+	plaintext, err := d.aead.Open(nil, nonce, segment[:n], nil)
+	if err != nil {
+		return &errors.Error{
+			Message: fmt.Sprintf("blob: Failed to decrypt segment %d", d.index-1),
+		}
+	}
+
+	d.buf = plaintext
+	d.done = last
+	return nil
+}
+
+/*
+Close closes the underlying reader.
+*/
+func (d *decryptReader) Close() error {
+	return d.closer.Close()
+}
+
+/*
+NewDecryptedReader returns a reader for an object written by the destination
+with encryption enabled. It unwraps the data key stored in the object's
+metadata using the key of the encryption options it has been encrypted with,
+and decrypts the content while reading it. Objects not encrypted are returned
+as is only if no encryption options are given or if AllowPlaintext is set.
+
+It is up to the caller to close the reader returned.
+*/
+func NewDecryptedReader(ctx context.Context, bucket *blob.Bucket, key string, enc *Encryption) (io.ReadCloser, error) {
+	attrs, err := bucket.Attributes(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm, encrypted := attrs.Metadata[metadataEncryptionAlgorithm]
+	if !encrypted {
+		if enc != nil && !enc.AllowPlaintext {
+			return nil, &errors.Error{
+				Message: fmt.Sprintf("blob: Object '%s' is not encrypted", key),
+			}
+		}
+
+		return bucket.NewReader(ctx, key, nil)
+	}
+
+	if algorithm != encryptionAlgorithm {
+		return nil, &errors.Error{
+			Message: fmt.Sprintf("blob: Encryption algorithm '%s' not supported", algorithm),
+		}
+	}
+
+	if enc == nil {
+		return nil, &errors.Error{
+			Message: fmt.Sprintf("blob: Object '%s' is encrypted but no encryption options were given", key),
+		}
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(attrs.Metadata[metadataEncryptionKey])
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, err := base64.StdEncoding.DecodeString(attrs.Metadata[metadataEncryptionNonce])
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := enc.unwrap(ctx, attrs.Metadata[metadataEncryptionKeyID], wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := bucket.NewReader(ctx, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptReader{
+		r:      bufio.NewReader(reader),
+		closer: reader,
+		aead:   aead,
+		prefix: prefix,
+	}, nil
+}
@@ -0,0 +1,290 @@
+package blobdestination
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/memblob"
+	"gocloud.dev/secrets/localsecrets"
+)
+
+func TestEncryption_RoundTrip(t *testing.T) {
+	key, _ := localsecrets.NewRandomKey()
+	encoded := base64.StdEncoding.EncodeToString(key[:])
+
+	path := filepath.Join(t.TempDir(), "blob.key")
+	if err := ioutil.WriteFile(path, []byte(encoded+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		enc  *Encryption
+		size int
+	}{
+		{
+			name: "WithKeyURLAndEmptyContent",
+			enc:  &Encryption{KeyURL: "base64key://" + base64.URLEncoding.EncodeToString(key[:])},
+			size: 0,
+		},
+		{
+			name: "WithKeyURLAndOneSegment",
+			enc:  &Encryption{KeyURL: "base64key://" + base64.URLEncoding.EncodeToString(key[:])},
+			size: segmentSize,
+		},
+		{
+			name: "WithKeyFileAndSmallContent",
+			enc:  &Encryption{KeyFile: path},
+			size: 42,
+		},
+		{
+			name: "WithKeyFileAndManySegments",
+			enc:  &Encryption{KeyFile: path},
+			size: 3*segmentSize + 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+
+			keeper, err := tt.enc.keeper(ctx)
+			if err != nil {
+				t.Fatalf("Encryption.keeper() error = %v", err)
+			}
+
+			defer keeper.Close()
+			a := Write{
+				env: &Options{
+					VerifyWrites: true,
+				},
+				ctx:    ctx,
+				bucket: bucket,
+				keeper: keeper,
+			}
+
+			content := make([]byte, tt.size)
+			rand.Read(content)
+			data, _ := json.Marshal(Write{
+				Filename: "secret.bin",
+				Content:  content,
+			})
+
+			got := load(a, data)
+			if got.Error != nil {
+				t.Fatalf("Write.Load() error = %v", got.Error)
+			}
+
+			stored, _ := bucket.ReadAll(ctx, "secret.bin")
+			if tt.size > 0 && bytes.Contains(stored, content) {
+				t.Fatalf("Write.Load() content stored in plaintext")
+			}
+
+			r, err := NewDecryptedReader(ctx, bucket, "secret.bin", tt.enc)
+			if err != nil {
+				t.Fatalf("NewDecryptedReader() error = %v", err)
+			}
+
+			defer r.Close()
+			decrypted, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("NewDecryptedReader() read error = %v", err)
+			}
+			if !bytes.Equal(decrypted, content) {
+				t.Errorf("NewDecryptedReader() content mismatch")
+			}
+		})
+	}
+}
+
+func TestEncryption_Truncated(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	key, _ := localsecrets.NewRandomKey()
+	enc := &Encryption{
+		KeyURL: "base64key://" + base64.URLEncoding.EncodeToString(key[:]),
+	}
+
+	keeper, _ := enc.keeper(ctx)
+	defer keeper.Close()
+
+	a := Write{
+		env:    &Options{},
+		ctx:    ctx,
+		bucket: bucket,
+		keeper: keeper,
+	}
+
+	data, _ := json.Marshal(Write{
+		Filename: "secret.bin",
+		Content:  make([]byte, 2*segmentSize+10),
+	})
+
+	if got := load(a, data); got.Error != nil {
+		t.Fatalf("Write.Load() error = %v", got.Error)
+	}
+
+	// Remove the last segment while keeping the metadata of the object.
+	attrs, _ := bucket.Attributes(ctx, "secret.bin")
+	stored, _ := bucket.ReadAll(ctx, "secret.bin")
+	truncated := stored[:2*(segmentSize+16)]
+	err := bucket.WriteAll(ctx, "secret.bin", truncated, &blob.WriterOptions{
+		Metadata: attrs.Metadata,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewDecryptedReader(ctx, bucket, "secret.bin", enc)
+	if err != nil {
+		t.Fatalf("NewDecryptedReader() error = %v", err)
+	}
+
+	defer r.Close()
+	if _, err := ioutil.ReadAll(r); err == nil {
+		t.Errorf("NewDecryptedReader() should fail on truncated content")
+	}
+}
+
+func TestEncryption_Plaintext(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	if err := bucket.WriteAll(ctx, "plain.txt", []byte("hello"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := localsecrets.NewRandomKey()
+	keyURL := "base64key://" + base64.URLEncoding.EncodeToString(key[:])
+
+	tests := []struct {
+		name    string
+		enc     *Encryption
+		wantErr bool
+	}{
+		{
+			name:    "WithoutEncryption",
+			enc:     nil,
+			wantErr: false,
+		},
+		{
+			name:    "WithEncryption",
+			enc:     &Encryption{KeyURL: keyURL},
+			wantErr: true,
+		},
+		{
+			name:    "WithEncryptionAllowingPlaintext",
+			enc:     &Encryption{KeyURL: keyURL, AllowPlaintext: true},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewDecryptedReader(ctx, bucket, "plain.txt", tt.enc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewDecryptedReader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			defer r.Close()
+			content, _ := ioutil.ReadAll(r)
+			if string(content) != "hello" {
+				t.Errorf("NewDecryptedReader() = %s, want %s", content, "hello")
+			}
+		})
+	}
+}
+
+func TestEncryption_Rotation(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	previous, _ := localsecrets.NewRandomKey()
+	current, _ := localsecrets.NewRandomKey()
+	previousURL := "base64key://" + base64.URLEncoding.EncodeToString(previous[:])
+	currentURL := "base64key://" + base64.URLEncoding.EncodeToString(current[:])
+
+	// Write an object with the previous key, with and without key ID.
+	write := func(enc *Encryption, filename string) {
+		keeper, err := enc.keeper(ctx)
+		if err != nil {
+			t.Fatalf("Encryption.keeper() error = %v", err)
+		}
+
+		defer keeper.Close()
+		a := Write{
+			env: &Options{
+				Encryption: enc,
+			},
+			ctx:    ctx,
+			bucket: bucket,
+			keeper: keeper,
+		}
+
+		data, _ := json.Marshal(Write{
+			Filename: filename,
+			Content:  []byte("Hello, " + filename),
+		})
+
+		if got := load(a, data); got.Error != nil {
+			t.Fatalf("Write.Load() error = %v", got.Error)
+		}
+	}
+
+	write(&Encryption{KeyURL: previousURL}, "legacy.bin")
+	write(&Encryption{KeyID: "1", KeyURL: previousURL}, "previous.bin")
+	write(&Encryption{KeyID: "2", KeyURL: currentURL}, "current.bin")
+
+	attrs, _ := bucket.Attributes(ctx, "current.bin")
+	if attrs.Metadata[metadataEncryptionKeyID] != "2" {
+		t.Errorf("Write.Load() key ID = %q, want %q", attrs.Metadata[metadataEncryptionKeyID], "2")
+	}
+
+	// Once rotated, every object can still be read.
+	rotated := &Encryption{
+		KeyID:  "2",
+		KeyURL: currentURL,
+		DecryptionKeys: []EncryptionKey{
+			{KeyID: "1", KeyURL: previousURL},
+		},
+	}
+
+	for _, filename := range []string{"legacy.bin", "previous.bin", "current.bin"} {
+		r, err := NewDecryptedReader(ctx, bucket, filename, rotated)
+		if err != nil {
+			t.Fatalf("NewDecryptedReader(%s) error = %v", filename, err)
+		}
+
+		decrypted, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("NewDecryptedReader(%s) read error = %v", filename, err)
+		}
+		if string(decrypted) != "Hello, "+filename {
+			t.Errorf("NewDecryptedReader(%s) = %s", filename, decrypted)
+		}
+	}
+
+	// Objects encrypted with a key removed from the options can not be read.
+	_, err := NewDecryptedReader(ctx, bucket, "previous.bin", &Encryption{
+		KeyID:  "2",
+		KeyURL: currentURL,
+	})
+	if err == nil {
+		t.Errorf("NewDecryptedReader() should fail with an unknown key ID")
+	}
+}
@@ -0,0 +1,24 @@
+package blobdestination
+
+import (
+	"time"
+)
+
+/*
+SignedURL holds the options to generate a pre-signed URL of an object once it
+has been written by the action Write.
+
+Example:
+
+	blobdestination.SignedURL{
+	  Expiry: 72 * time.Hour,
+	}
+*/
+type SignedURL struct {
+
+	// Expiry is the duration for which the URL is valid. It must not be
+	// negative.
+	//
+	// Defaults to 1 hour.
+	Expiry time.Duration `json:"expiry,omitempty"`
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"time"
 
 	"github.com/nunchistudio/blacksmith/destination"
 	"github.com/nunchistudio/blacksmith/helper/errors"
@@ -25,6 +26,18 @@ Environment variables:
 */
 var DriverAWSS3 Driver = "aws/s3"
 
+/*
+DriverS3Compatible is used to leverage a S3-compatible storage, such as MinIO,
+Ceph, Cloudflare R2, or LocalStack, as the destination's driver. The options
+S3Compatible must be set when using this driver.
+
+Environment variables:
+  - AWS_ACCESS_KEY_ID (required if not set in options)
+  - AWS_SECRET_ACCESS_KEY (required if not set in options)
+  - AWS_SESSION_TOKEN
+*/
+var DriverS3Compatible Driver = "s3-compatible"
+
 /*
 DriverAzureBlob is used to leverage Azure Blob Storage as the destination's
 driver.
@@ -44,6 +57,31 @@ Environment variables:
 */
 var DriverGoogleStorage Driver = "google/storage"
 
+/*
+OverwritePolicy is a custom type allowing the user to only pass supported policies
+when writing objects that may already exist.
+*/
+type OverwritePolicy string
+
+/*
+OverwriteAlways always overwrites existing objects. This is the default policy.
+*/
+var OverwriteAlways OverwritePolicy = "always"
+
+/*
+OverwriteNever never overwrites existing objects. Writes of existing objects are
+skipped.
+*/
+var OverwriteNever OverwritePolicy = "never"
+
+/*
+OverwriteIfNewer only overwrites existing objects if the data written is newer
+than the one of the existing object. The timestamp of the data is the time the
+event has been sent by the source, and is stored in the object's metadata.
+Objects without such timestamp are always overwritten.
+*/
+var OverwriteIfNewer OverwritePolicy = "if-newer"
+
 /*
 Options is the options the destination can take as an input to be configured.
 */
@@ -85,6 +123,7 @@ type Options struct {
 	// into the bucket.
 	//
 	// Format for AWS S3: "<bucket>"
+	// Format for S3-compatible: "<bucket>"
 	// Format for Azure Blob Storage: "<container>"
 	// Format for Google Cloud Storage: "<bucket>"
 	Connection string
@@ -96,6 +135,68 @@ type Options struct {
 	//     "region": {"<region>"}, // Required if environment variable 'AWS_REGION' is not set.
 	//   }
 	Params url.Values
+
+	// S3Compatible holds the options to connect to a S3-compatible storage.
+	//
+	// Required when using DriverS3Compatible.
+	S3Compatible *S3Compatible
+
+	// VerifyWrites indicates if the attributes of every object written shall be
+	// read back to ensure its size and checksum match the content sent.
+	VerifyWrites bool
+
+	// BufferSize is the size in bytes of the chunks uploaded in a single request
+	// when writing an object. Larger objects are split into multiple requests,
+	// using multipart uploads when supported by the driver.
+	//
+	// Defaults to the driver's default.
+	BufferSize int
+
+	// Encryption enables client-side envelope encryption of the objects written
+	// by the action Write. Objects can then be read using NewDecryptedReader.
+	Encryption *Encryption
+
+	// OverwritePolicy is the policy to apply when the action Write is about to
+	// overwrite an existing object. Writes skipped because of the policy are
+	// reported as succeeded.
+	//
+	// Defaults to OverwriteAlways.
+	OverwritePolicy OverwritePolicy
+
+	// TargetBuckets is the list of blob URLs of the buckets the actions Copy and
+	// Move can write into, in addition to the bucket of the destination. The
+	// buckets are opened when initializing the destination. Target buckets not
+	// listed are denied.
+	//
+	// Example: []string{"s3://mybucket-archives?region=eu-west-1"}
+	TargetBuckets []string
+
+	// AllowedSources is the list of sources the action Write can read from.
+	// A source is allowed if it starts with one of the prefixes, which can be a
+	// scheme, a bucket, or a path. Local paths are compared once made absolute.
+	// Sources are denied if no prefix is set, or if their path contains "." or
+	// ".." segments.
+	//
+	// Example: []string{"/tmp/exports/", "https://example.com/exports/", "s3://mybucket"}
+	AllowedSources []string
+
+	// SourceTimeout is the maximum time allowed to read a source, including the
+	// time to stream its content to the bucket.
+	//
+	// Defaults to 10 minutes.
+	SourceTimeout time.Duration
+
+	// Concurrency is the maximum number of objects the action Write uploads in
+	// parallel when loading a queue of jobs.
+	//
+	// Defaults to 1.
+	Concurrency int
+
+	// OnSignedURL is called once an object has been written by the action Write
+	// with a pre-signed URL requested. It receives the payload of the job along
+	// the URL, and returns the actions to run once the job has succeeded, such
+	// as an email or a message sharing the download link.
+	OnSignedURL func(tk *destination.Toolkit, payload Write, url string) []destination.Action
 }
 
 /*
@@ -127,6 +228,14 @@ func (env *Options) validate() error {
 		env.MaxRetries = maxRetries
 	}
 
+	if env.Concurrency == 0 {
+		env.Concurrency = 1
+	}
+
+	if env.OverwritePolicy == "" {
+		env.OverwritePolicy = OverwriteAlways
+	}
+
 	if env.Name == "" {
 		fail.Validations = append(fail.Validations, errors.Validation{
 			Message: "Bucket name must be set",
@@ -151,9 +260,63 @@ func (env *Options) validate() error {
 		})
 	}
 
+	if env.BufferSize < 0 {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: "Buffer size must not be negative",
+			Path:    []string{"Options", "Destinations", name, "BufferSize"},
+		})
+	}
+
+	if env.Concurrency < 0 {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: "Concurrency must not be negative",
+			Path:    []string{"Options", "Destinations", name, "Concurrency"},
+		})
+	}
+
+	if env.SourceTimeout < 0 {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: "Source timeout must not be negative",
+			Path:    []string{"Options", "Destinations", name, "SourceTimeout"},
+		})
+	}
+
+	for i, target := range env.TargetBuckets {
+		if _, err := url.Parse(target); err != nil || target == "" {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: fmt.Sprintf("Target bucket '%s' not valid", target),
+				Path:    []string{"Options", "Destinations", name, "TargetBuckets", fmt.Sprintf("%d", i)},
+			})
+		}
+	}
+
+	for i, allowed := range env.AllowedSources {
+		if _, err := normalizeSource(allowed); err != nil || allowed == "" {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: fmt.Sprintf("Allowed source '%s' not valid", allowed),
+				Path:    []string{"Options", "Destinations", name, "AllowedSources", fmt.Sprintf("%d", i)},
+			})
+		}
+	}
+
+	switch env.OverwritePolicy {
+	case OverwriteAlways, OverwriteNever, OverwriteIfNewer:
+	default:
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: "Overwrite policy not supported",
+			Path:    []string{"Options", "Destinations", name, "OverwritePolicy"},
+		})
+	}
+
+	if env.Encryption != nil {
+		fail.Validations = append(fail.Validations, env.Encryption.validate(name)...)
+	}
+
 	switch env.Driver {
 	case DriverAWSS3:
 		fail.Validations = append(fail.Validations, env.validateDriverAWSS3(name)...)
+	case DriverS3Compatible:
+		fail.Validations = append(fail.Validations, env.validateDriverS3Compatible(name)...)
 	case DriverAzureBlob:
 		fail.Validations = append(fail.Validations, env.validateDriverAzureBlob(name)...)
 	case DriverGoogleStorage:
@@ -174,9 +337,12 @@ for the AWS S3 driver.
 func (env *Options) validateDriverAWSS3(name string) []errors.Validation {
 	validations := []errors.Validation{}
 
-	// Do not continue if a custom S3-compatible endpoint is set.
+	// Custom endpoints must use the S3-compatible driver, which validates them.
 	if env.Params.Get("endpoint") != "" {
-		return validations
+		validations = append(validations, errors.Validation{
+			Message: "Custom endpoints are not supported, use the S3-compatible driver instead",
+			Path:    []string{"Options", "Destinations", name, "Params", "endpoint"},
+		})
 	}
 
 	// Add a validation error if the AWS access key is not set.
@@ -214,6 +380,23 @@ func (env *Options) validateDriverAWSS3(name string) []errors.Validation {
 	return validations
 }
 
+/*
+validateDriverS3Compatible is part of the options' validation process and validate
+those for the S3-compatible driver.
+*/
+func (env *Options) validateDriverS3Compatible(name string) []errors.Validation {
+	if env.S3Compatible == nil {
+		return []errors.Validation{
+			{
+				Message: "S3-compatible options must be set",
+				Path:    []string{"Options", "Destinations", name, "S3Compatible"},
+			},
+		}
+	}
+
+	return env.S3Compatible.validate(name)
+}
+
 /*
 validateDriverAzureBlob is part of the options' validation process and validate
 those for the Azure Blob driver.
@@ -106,6 +106,172 @@ func TestOptions_validate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "WithNegativeBufferSize",
+			fields: &Options{
+				Realtime:   false,
+				Interval:   "@every 1h",
+				MaxRetries: 10,
+				Name:       "fakename",
+				Driver:     DriverTest,
+				Connection: "conn://fakeurl",
+				BufferSize: -1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "WithAWSS3CustomEndpoint",
+			fields: &Options{
+				Realtime:   false,
+				Interval:   "@every 1h",
+				MaxRetries: 10,
+				Name:       "fakename",
+				Driver:     DriverAWSS3,
+				Connection: "mybucket",
+				Params: url.Values{
+					"endpoint": {"http://127.0.0.1:9000"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "WithEmptyEncryption",
+			fields: &Options{
+				Realtime:   false,
+				Interval:   "@every 1h",
+				MaxRetries: 10,
+				Name:       "fakename",
+				Driver:     DriverTest,
+				Connection: "conn://fakeurl",
+				Encryption: &Encryption{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "WithEncryption",
+			fields: &Options{
+				Realtime:   false,
+				Interval:   "@every 1h",
+				MaxRetries: 10,
+				Name:       "fakename",
+				Driver:     DriverTest,
+				Connection: "conn://fakeurl",
+				Encryption: &Encryption{
+					KeyFile: "/etc/blacksmith/blob.key",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "WithDecryptionKeysWithoutKeyID",
+			fields: &Options{
+				Realtime:   false,
+				Interval:   "@every 1h",
+				MaxRetries: 10,
+				Name:       "fakename",
+				Driver:     DriverTest,
+				Connection: "conn://fakeurl",
+				Encryption: &Encryption{
+					KeyFile: "/etc/blacksmith/blob-2.key",
+					DecryptionKeys: []EncryptionKey{
+						{KeyID: "1", KeyFile: "/etc/blacksmith/blob-1.key"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "WithDecryptionKeys",
+			fields: &Options{
+				Realtime:   false,
+				Interval:   "@every 1h",
+				MaxRetries: 10,
+				Name:       "fakename",
+				Driver:     DriverTest,
+				Connection: "conn://fakeurl",
+				Encryption: &Encryption{
+					KeyID:   "2",
+					KeyFile: "/etc/blacksmith/blob-2.key",
+					DecryptionKeys: []EncryptionKey{
+						{KeyID: "1", KeyFile: "/etc/blacksmith/blob-1.key"},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "WithUnknownOverwritePolicy",
+			fields: &Options{
+				Realtime:        false,
+				Interval:        "@every 1h",
+				MaxRetries:      10,
+				Name:            "fakename",
+				Driver:          DriverTest,
+				Connection:      "conn://fakeurl",
+				OverwritePolicy: "sometimes",
+			},
+			wantErr: true,
+		},
+		{
+			name: "WithS3CompatibleAndNoOptions",
+			fields: &Options{
+				Realtime:   false,
+				Interval:   "@every 1h",
+				MaxRetries: 10,
+				Name:       "fakename",
+				Driver:     DriverS3Compatible,
+				Connection: "mybucket",
+			},
+			wantErr: true,
+		},
+		{
+			name: "WithS3CompatibleAndNoEndpoint",
+			fields: &Options{
+				Realtime:   false,
+				Interval:   "@every 1h",
+				MaxRetries: 10,
+				Name:       "fakename",
+				Driver:     DriverS3Compatible,
+				Connection: "mybucket",
+				S3Compatible: &S3Compatible{
+					AccessKeyID:     "minioadmin",
+					SecretAccessKey: "minioadmin",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "WithS3Compatible",
+			fields: &Options{
+				Realtime:   false,
+				Interval:   "@every 1h",
+				MaxRetries: 10,
+				Name:       "fakename",
+				Driver:     DriverS3Compatible,
+				Connection: "mybucket",
+				S3Compatible: &S3Compatible{
+					Endpoint:        "http://127.0.0.1:9000",
+					PathStyle:       true,
+					DisableSSL:      true,
+					AccessKeyID:     "minioadmin",
+					SecretAccessKey: "minioadmin",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "WithNegativeConcurrency",
+			fields: &Options{
+				Realtime:    false,
+				Interval:    "@every 1h",
+				MaxRetries:  10,
+				Name:        "fakename",
+				Driver:      DriverTest,
+				Connection:  "conn://fakeurl",
+				Concurrency: -1,
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,147 @@
+package blobdestination
+
+import (
+	"context"
+	"os"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/s3blob"
+)
+
+/*
+S3Compatible holds the options to connect to a S3-compatible storage, such as
+MinIO, Ceph, Cloudflare R2, or LocalStack. It is required when using the driver
+DriverS3Compatible.
+*/
+type S3Compatible struct {
+
+	// Endpoint is the URL of the S3-compatible API.
+	//
+	// Example: "https://minio.example.com:9000"
+	// Required.
+	Endpoint string
+
+	// Region is the region to sign the requests with. Most S3-compatible storages
+	// do not rely on regions.
+	//
+	// Defaults to "us-east-1".
+	Region string
+
+	// PathStyle indicates if the bucket name shall be part of the path of the
+	// requests ("<endpoint>/<bucket>/<key>") instead of the host name
+	// ("<bucket>.<endpoint>/<key>"). Most self-hosted storages require it.
+	PathStyle bool
+
+	// DisableSSL indicates if requests shall be sent over plain HTTP. This is
+	// only recommended for local development.
+	DisableSSL bool
+
+	// AccessKeyID is the access key to authenticate with.
+	//
+	// Defaults to the environment variable 'AWS_ACCESS_KEY_ID'.
+	AccessKeyID string
+
+	// SecretAccessKey is the secret key to authenticate with.
+	//
+	// Defaults to the environment variable 'AWS_SECRET_ACCESS_KEY'.
+	SecretAccessKey string
+
+	// SessionToken is the optional session token to authenticate with.
+	//
+	// Defaults to the environment variable 'AWS_SESSION_TOKEN'.
+	SessionToken string
+
+	// UseLegacyList forces the use of ListObjects instead of ListObjectsV2 for
+	// the storages not supporting the latter, such as Ceph.
+	UseLegacyList bool
+}
+
+/*
+credentials returns the credentials to authenticate with, falling back to the
+environment variables for those not set.
+*/
+func (s3 *S3Compatible) credentials() (string, string, string) {
+	id := s3.AccessKeyID
+	if id == "" {
+		id = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+
+	secret := s3.SecretAccessKey
+	if secret == "" {
+		secret = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+
+	token := s3.SessionToken
+	if token == "" {
+		token = os.Getenv("AWS_SESSION_TOKEN")
+	}
+
+	return id, secret, token
+}
+
+/*
+validate ensures the S3-compatible options are valid.
+*/
+func (s3 *S3Compatible) validate(name string) []errors.Validation {
+	validations := []errors.Validation{}
+
+	if s3.Endpoint == "" {
+		validations = append(validations, errors.Validation{
+			Message: "Endpoint must be set",
+			Path:    []string{"Options", "Destinations", name, "S3Compatible", "Endpoint"},
+		})
+	}
+
+	// Add a validation error if the access key is set neither in the options
+	// nor in the environment variables.
+	id, secret, _ := s3.credentials()
+	if id == "" {
+		validations = append(validations, errors.Validation{
+			Message: "'AccessKeyID' or environment variable 'AWS_ACCESS_KEY_ID' must be set",
+			Path:    []string{"Options", "Destinations", name, "S3Compatible", "AccessKeyID"},
+		})
+	}
+
+	// Add a validation error if the secret key is set neither in the options
+	// nor in the environment variables.
+	if secret == "" {
+		validations = append(validations, errors.Validation{
+			Message: "'SecretAccessKey' or environment variable 'AWS_SECRET_ACCESS_KEY' must be set",
+			Path:    []string{"Options", "Destinations", name, "S3Compatible", "SecretAccessKey"},
+		})
+	}
+
+	return validations
+}
+
+/*
+open opens the bucket with the given name on the S3-compatible storage.
+*/
+func (s3 *S3Compatible) open(ctx context.Context, bucket string) (*blob.Bucket, error) {
+	region := s3.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	id, secret, token := s3.credentials()
+	sess, err := session.NewSession(&aws.Config{
+		Endpoint:         aws.String(s3.Endpoint),
+		Region:           aws.String(region),
+		S3ForcePathStyle: aws.Bool(s3.PathStyle),
+		DisableSSL:       aws.Bool(s3.DisableSSL),
+		Credentials:      credentials.NewStaticCredentials(id, secret, token),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s3blob.OpenBucket(ctx, sess, bucket, &s3blob.Options{
+		UseLegacyList: s3.UseLegacyList,
+	})
+}
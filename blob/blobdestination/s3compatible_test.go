@@ -0,0 +1,152 @@
+package blobdestination
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/destination"
+	"github.com/nunchistudio/blacksmith/helper/logger"
+)
+
+/*
+s3StandIn is a minimal in-memory stand-in of a S3-compatible storage such as
+MinIO. It only supports path-style requests for putting, getting, and deleting
+objects.
+*/
+type s3StandIn struct {
+	mu      sync.Mutex
+	objects map[string]s3StandInObject
+}
+
+type s3StandInObject struct {
+	body   []byte
+	header http.Header
+}
+
+func (s *s3StandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := ioutil.ReadAll(r.Body)
+		sum := md5.Sum(body)
+
+		header := http.Header{}
+		for k, v := range r.Header {
+			if strings.HasPrefix(strings.ToLower(k), "x-amz-meta-") || k == "Content-Type" {
+				header[k] = v
+			}
+		}
+
+		header.Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		header.Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+		s.objects[key] = s3StandInObject{
+			body:   body,
+			header: header,
+		}
+
+		w.Header().Set("ETag", header.Get("ETag"))
+		w.WriteHeader(http.StatusOK)
+
+	case http.MethodHead, http.MethodGet:
+		obj, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				w.Write([]byte(`<Error><Code>NoSuchKey</Code></Error>`))
+			}
+
+			return
+		}
+
+		for k, v := range obj.header {
+			w.Header()[k] = v
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(obj.body)
+		}
+
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestDriverS3Compatible(t *testing.T) {
+	standin := &s3StandIn{
+		objects: map[string]s3StandInObject{},
+	}
+
+	srv := httptest.NewServer(standin)
+	defer srv.Close()
+
+	d := New(&Options{
+		Name:       "minio",
+		Driver:     DriverS3Compatible,
+		Connection: "mybucket",
+		S3Compatible: &S3Compatible{
+			Endpoint:        srv.URL,
+			PathStyle:       true,
+			DisableSSL:      true,
+			AccessKeyID:     "minioadmin",
+			SecretAccessKey: "minioadmin",
+		},
+		VerifyWrites: true,
+	}).(*Blob)
+
+	tk := &destination.Toolkit{
+		Logger: logger.Default,
+	}
+
+	if err := d.Init(tk); err != nil {
+		t.Fatalf("Blob.Init() error = %v", err)
+	}
+
+	defer d.Shutdown(tk)
+	data, _ := json.Marshal(Write{
+		Filename: "exports/hello.txt",
+		Content:  []byte("Hello, World!"),
+	})
+
+	got := load(d.Actions()["write"], data)
+	if got.Error != nil {
+		t.Fatalf("Write.Load() error = %v", got.Error)
+	}
+
+	obj, ok := standin.objects["mybucket/exports/hello.txt"]
+	if !ok {
+		t.Fatalf("Write.Load() object not written with path-style addressing")
+	}
+	if string(obj.body) != "Hello, World!" {
+		t.Errorf("Write.Load() content = %s, want %s", obj.body, "Hello, World!")
+	}
+
+	data, _ = json.Marshal(Delete{
+		Filename: "exports/hello.txt",
+	})
+
+	got = load(d.Actions()["delete"], data)
+	if got.Error != nil {
+		t.Fatalf("Delete.Load() error = %v", got.Error)
+	}
+	if _, ok := standin.objects["mybucket/exports/hello.txt"]; ok {
+		t.Errorf("Delete.Load() object still exists")
+	}
+}
@@ -0,0 +1,296 @@
+package blobdestination
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"gocloud.dev/blob"
+)
+
+/*
+defaultSourceTimeout is the maximum time allowed to read a source when the
+destination's option SourceTimeout is not set.
+*/
+const defaultSourceTimeout = 10 * time.Minute
+
+/*
+normalizeSource returns the canonical form of a source or of an allowed prefix,
+so they can be compared. Local paths are made absolute and prefixed by the
+"file://" scheme, and the paths of URLs are cleaned so "../" can not escape an
+allowed prefix.
+*/
+func normalizeSource(source string) (string, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return "", err
+	}
+
+	switch u.Scheme {
+	case "", "file":
+		abs, err := filepath.Abs(u.Path)
+		if err != nil {
+			return "", err
+		}
+
+		normalized := "file://" + filepath.ToSlash(abs)
+		if strings.HasSuffix(u.Path, "/") && !strings.HasSuffix(normalized, "/") {
+			normalized += "/"
+		}
+
+		return normalized, nil
+	}
+
+	if u.Path != "" {
+		cleaned := path.Clean("/" + u.Path)
+		if strings.HasSuffix(u.Path, "/") && cleaned != "/" {
+			cleaned += "/"
+		}
+
+		u.Path = cleaned
+		u.RawPath = ""
+	}
+
+	return u.String(), nil
+}
+
+/*
+hasDotSegments indicates if a path contains "." or ".." segments.
+*/
+func hasDotSegments(p string) bool {
+	for _, segment := range strings.Split(filepath.ToSlash(p), "/") {
+		if segment == "." || segment == ".." {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+allowSource indicates if a source can be read given the destination's option
+AllowedSources. A source is allowed if it starts with one of the prefixes, on a
+path boundary. Sources are denied if no prefix is set.
+
+Sources with "." or ".." path segments are always denied, since the path read
+would not be the one checked against the prefixes. Local and blob sources with a
+query string are denied as well, since the query of a blob URL configures the
+bucket opened, such as its endpoint.
+*/
+func (env *Options) allowSource(source string) bool {
+	u, err := url.Parse(source)
+	if err != nil || hasDotSegments(u.Path) {
+		return false
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" && (u.RawQuery != "" || u.ForceQuery) {
+		return false
+	}
+
+	normalized, err := normalizeSource(source)
+	if err != nil {
+		return false
+	}
+
+	for _, allowed := range env.AllowedSources {
+		prefix, err := normalizeSource(allowed)
+		if err != nil || !strings.HasPrefix(normalized, prefix) {
+			continue
+		}
+
+		// The prefix must end on a path boundary so "https://example.com" does
+		// not allow "https://example.com.evil.org".
+		rest := strings.TrimPrefix(normalized, prefix)
+		if rest == "" || strings.HasSuffix(prefix, "/") || strings.HasPrefix(rest, "/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+openSource opens a reader for the source referenced by a Write action. The
+source can be:
+  - a local path, with or without the "file://" scheme;
+  - a HTTP or HTTPS URL;
+  - a blob URL supported by gocloud, such as "s3://<bucket>/<key>".
+
+The source must be allowed by the destination's option AllowedSources. Reading
+the source must not take longer than the option SourceTimeout.
+
+It is up to the caller to close the reader returned.
+*/
+func (env *Options) openSource(ctx context.Context, source string) (io.ReadCloser, error) {
+	if !env.allowSource(source) {
+		return nil, errSourceNotAllowed(source)
+	}
+
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := env.SourceTimeout
+	if timeout == 0 {
+		timeout = defaultSourceTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+
+	var r io.ReadCloser
+	switch u.Scheme {
+	case "", "file":
+		r, err = os.Open(u.Path)
+
+	case "http", "https":
+		r, err = env.openSourceHTTP(ctx, source, timeout)
+
+	default:
+		r, err = openSourceBlob(ctx, u)
+	}
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &sourceReader{
+		ReadCloser: r,
+		cancel:     cancel,
+	}, nil
+}
+
+/*
+openSourceHTTP opens a reader on the body of a HTTP response. Every status code
+other than 2xx is considered an error. Redirects are only followed if the new
+location is allowed as well.
+*/
+func (env *Options) openSourceHTTP(ctx context.Context, source string, timeout time.Duration) (io.ReadCloser, error) {
+	client := &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+
+			if !env.allowSource(req.URL.String()) {
+				return errSourceNotAllowed(req.URL.String())
+			}
+
+			return nil
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		res.Body.Close()
+		return nil, &errors.Error{
+			StatusCode: res.StatusCode,
+			Message:    fmt.Sprintf("blob: Failed to fetch source '%s': %s", source, res.Status),
+		}
+	}
+
+	return res.Body, nil
+}
+
+/*
+openSourceBlob opens a reader on an object stored in another bucket. The bucket
+is opened from the scheme and host of the source only, for the time of the read,
+and is closed along the reader.
+*/
+func openSourceBlob(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	key := strings.TrimPrefix(u.Path, "/")
+	if key == "" {
+		return nil, &errors.Error{
+			Message: fmt.Sprintf("blob: Source '%s' does not reference an object", u.String()),
+		}
+	}
+
+	bucketURL := url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+	}
+
+	bucket, err := blob.OpenBucket(ctx, bucketURL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := bucket.NewReader(ctx, key, nil)
+	if err != nil {
+		bucket.Close()
+		return nil, err
+	}
+
+	return &sourceBlob{
+		Reader: reader,
+		bucket: bucket,
+	}, nil
+}
+
+/*
+sourceBlob wraps a blob reader so the bucket it has been opened from is closed
+along with the reader.
+*/
+type sourceBlob struct {
+	*blob.Reader
+	bucket *blob.Bucket
+}
+
+/*
+Close closes the reader and then its bucket.
+*/
+func (s *sourceBlob) Close() error {
+	err := s.Reader.Close()
+	if e := s.bucket.Close(); err == nil {
+		err = e
+	}
+
+	return err
+}
+
+/*
+sourceReader wraps the reader of a source so the context limiting the time of
+the read is released along with the reader.
+*/
+type sourceReader struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+/*
+Close closes the reader and then releases its context.
+*/
+func (s *sourceReader) Close() error {
+	defer s.cancel()
+	return s.ReadCloser.Close()
+}
+
+/*
+errSourceNotAllowed returns the error to send when a source is not allowed by
+the destination's option AllowedSources.
+*/
+func errSourceNotAllowed(source string) error {
+	return &errors.Error{
+		Message: fmt.Sprintf("blob: Source '%s' not allowed", source),
+	}
+}
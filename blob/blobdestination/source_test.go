@@ -0,0 +1,233 @@
+package blobdestination
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenSource(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hello.txt")
+	if err := ioutil.WriteFile(path, []byte("Hello, World!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/hello.txt" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write([]byte("Hello, World!"))
+	}))
+	defer srv.Close()
+
+	env := &Options{
+		AllowedSources: []string{dir + "/", srv.URL, "mem://"},
+	}
+
+	tests := []struct {
+		name    string
+		source  string
+		wantErr bool
+	}{
+		{
+			name:    "WithLocalPath",
+			source:  path,
+			wantErr: false,
+		},
+		{
+			name:    "WithFileURL",
+			source:  "file://" + path,
+			wantErr: false,
+		},
+		{
+			name:    "WithMissingFile",
+			source:  filepath.Join(dir, "missing.txt"),
+			wantErr: true,
+		},
+		{
+			name:    "WithHTTP",
+			source:  srv.URL + "/hello.txt",
+			wantErr: false,
+		},
+		{
+			name:    "WithHTTPNotFound",
+			source:  srv.URL + "/missing.txt",
+			wantErr: true,
+		},
+		{
+			name:    "WithPathNotAllowed",
+			source:  "/etc/passwd",
+			wantErr: true,
+		},
+		{
+			name:    "WithPathEscapingPrefix",
+			source:  dir + "/../" + filepath.Base(dir) + "-other/hello.txt",
+			wantErr: true,
+		},
+		{
+			name:    "WithURLNotAllowed",
+			source:  "http://169.254.169.254/latest/meta-data/",
+			wantErr: true,
+		},
+		{
+			name:    "WithHostExtendingPrefix",
+			source:  srv.URL + ".evil.org/hello.txt",
+			wantErr: true,
+		},
+		{
+			name:    "WithBlobWithoutKey",
+			source:  "mem://",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := env.openSource(context.Background(), tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("openSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			defer r.Close()
+			content, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != "Hello, World!" {
+				t.Errorf("openSource() = %s, want %s", content, "Hello, World!")
+			}
+		})
+	}
+}
+
+func TestOptions_allowSource(t *testing.T) {
+	env := &Options{
+		AllowedSources: []string{"s3://bucket/exports/", "https://example.com/files", "/var/data/"},
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		want   bool
+	}{
+		{
+			name:   "WithBlobInPrefix",
+			source: "s3://bucket/exports/report.csv",
+			want:   true,
+		},
+		{
+			name:   "WithBlobParentSegment",
+			source: "s3://bucket/secret/../exports/report.csv",
+			want:   false,
+		},
+		{
+			name:   "WithBlobEncodedParentSegment",
+			source: "s3://bucket/secret/%2e%2e/exports/report.csv",
+			want:   false,
+		},
+		{
+			name:   "WithBlobCurrentSegment",
+			source: "s3://bucket/exports/./report.csv",
+			want:   false,
+		},
+		{
+			name:   "WithHTTPParentSegment",
+			source: "https://example.com/files/../admin",
+			want:   false,
+		},
+		{
+			name:   "WithLocalParentSegment",
+			source: "/var/data/../../etc/passwd",
+			want:   false,
+		},
+		{
+			name:   "WithBlobQuery",
+			source: "s3://bucket/exports/report.csv?endpoint=http://attacker.example.com",
+			want:   false,
+		},
+		{
+			name:   "WithBlobEmptyQuery",
+			source: "s3://bucket/exports/report.csv?",
+			want:   false,
+		},
+		{
+			name:   "WithLocalQuery",
+			source: "/var/data/report.csv?x=1",
+			want:   false,
+		},
+		{
+			name:   "WithHTTPQuery",
+			source: "https://example.com/files/report.csv?version=2",
+			want:   true,
+		},
+		{
+			name:   "WithLocalInPrefix",
+			source: "/var/data/report.csv",
+			want:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := env.allowSource(tt.source); got != tt.want {
+				t.Errorf("Options.allowSource() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenSource_Denied(t *testing.T) {
+	env := &Options{}
+	if _, err := env.openSource(context.Background(), filepath.Join(t.TempDir(), "hello.txt")); err == nil {
+		t.Errorf("openSource() error = nil, want sources denied by default")
+	}
+}
+
+func TestOpenSource_Timeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	env := &Options{
+		AllowedSources: []string{srv.URL},
+		SourceTimeout:  50 * time.Millisecond,
+	}
+
+	if _, err := env.openSource(context.Background(), srv.URL+"/slow.txt"); err == nil {
+		t.Errorf("openSource() error = nil, want timeout")
+	}
+}
+
+func TestOpenSource_Redirect(t *testing.T) {
+	forbidden := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	}))
+	defer forbidden.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, forbidden.URL, http.StatusFound)
+	}))
+	defer srv.Close()
+
+	env := &Options{
+		AllowedSources: []string{srv.URL},
+	}
+
+	if _, err := env.openSource(context.Background(), srv.URL+"/hello.txt"); err == nil {
+		t.Errorf("openSource() error = nil, want redirect denied")
+	}
+}
@@ -3,6 +3,7 @@ module github.com/nunchistudio/blacksmith-modules/blob
 go 1.16
 
 require (
+	github.com/aws/aws-sdk-go v1.38.35
 	github.com/nunchistudio/blacksmith v0.18.0
 	github.com/sirupsen/logrus v1.8.1
 	gocloud.dev v0.23.0
@@ -0,0 +1,226 @@
+package docstoredestination
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/destination"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"gocloud.dev/gcerrors"
+)
+
+/*
+Create implements the Blacksmith destination.Action interface for the action
+"create". It holds the complete job's structure to load into the destination.
+
+The document is created only if it does not exist yet.
+*/
+type Create struct {
+	env         *Options
+	ctx         context.Context
+	collections *collections
+
+	// Destination is the name of the destination the action is loaded into, as
+	// set in its options. It allows to validate the action against the options
+	// of the destination when marshaled.
+	//
+	// Only needed if there are many docstore destinations. When not set and the
+	// destination can not be found, the action is validated when loaded.
+	Destination string `json:"-"`
+
+	// Document is the document to create. Its key fields must be set unless the
+	// driver is able to generate them.
+	//
+	// Required.
+	Document map[string]interface{} `json:"document"`
+
+	// Collection is the name of the collection to load the document into. It
+	// must be allowed in the options of the destination.
+	//
+	// Defaults to the collection set in the connection string.
+	Collection string `json:"collection,omitempty"`
+
+	// Expiry allows to make the document expire. The 'ttl_field' param must be
+	// set in the options of the destination.
+	Expiry *Expiry `json:"expiry,omitempty"`
+
+	// IfExists is the policy to apply if the document already exists.
+	//
+	// Defaults to PolicyDiscard.
+	IfExists Policy `json:"if_exists,omitempty"`
+}
+
+/*
+String returns the string representation of the action Create.
+*/
+func (a Create) String() string {
+	return "create"
+}
+
+/*
+Schedule allows the action to override the schedule options of its
+destination. Do not override.
+*/
+func (a Create) Schedule() *destination.Schedule {
+	return nil
+}
+
+/*
+Marshal is the function being run when the action receives data into
+the Create receiver. It allows to transform and enrich the data before
+saving it in the store adapter.
+*/
+func (a Create) Marshal(tk *destination.Toolkit) (*destination.Job, error) {
+
+	// Find the options of the destination, so the action is validated against
+	// them before being saved. If they can not be found, the document is
+	// validated when loaded and the job is discarded if invalid.
+	env, validations := lookup(a.env, a.Destination, "Create")
+	if len(validations) > 0 {
+		return nil, &errors.Error{
+			StatusCode:  400,
+			Message:     "Bad Request",
+			Validations: validations,
+		}
+	}
+
+	if env != nil {
+		// Derive the key of the document. The key is not required since the
+		// document store can generate one.
+		if err := env.deriveKey(a.Document); err != nil {
+			return nil, &errors.Error{
+				StatusCode: 400,
+				Message:    "Bad Request",
+				Validations: []errors.Validation{
+					{
+						Message: fmt.Sprintf("Failed to derive key from template: %s", err.Error()),
+						Path:    []string{"Create", "Document"},
+					},
+				},
+			}
+		}
+
+		// Ensure the document satisfies the schema of the collection.
+		if validations := env.validateSchema("Create", a.Collection, a.Document); len(validations) > 0 {
+			return nil, &errors.Error{
+				StatusCode:  400,
+				Message:     "Bad Request",
+				Validations: validations,
+			}
+		}
+
+		// Ensure the collection is allowed.
+		if validations := env.allowCollection("Create", a.Collection); len(validations) > 0 {
+			return nil, &errors.Error{
+				StatusCode:  400,
+				Message:     "Bad Request",
+				Validations: validations,
+			}
+		}
+	}
+
+	// Ensure the expiry is valid, and make it absolute so retrying the job does
+	// not extend the life of the document.
+	if a.Expiry != nil {
+		validations := a.Expiry.validate("Create")
+		if env != nil {
+			validations = env.validateExpiry("Create", a.Expiry)
+		}
+
+		if len(validations) > 0 {
+			return nil, &errors.Error{
+				StatusCode:  400,
+				Message:     "Bad Request",
+				Validations: validations,
+			}
+		}
+
+		a.Expiry = a.Expiry.absolute(time.Now())
+	}
+
+	// Try to marshal the data passed directly to the receiver.
+	data, err := json.Marshal(&a)
+	if err != nil {
+		return nil, &errors.Error{
+			StatusCode: 400,
+			Message:    "Bad Request",
+		}
+	}
+
+	// Create a job with the data. Since the 'Context' key is not
+	// set, the one from the event will automatically be applied.
+	j := &destination.Job{
+		Data: data,
+	}
+
+	// Return the job including the marshaled data.
+	return j, nil
+}
+
+/*
+Load is the function being run by the scheduler to load the data into
+the destination. It is in charge of the "L" in the ETL process.
+*/
+func (a Create) Load(tk *destination.Toolkit, queue *store.Queue, then chan<- destination.Then) {
+
+	// We can go through every events received from the queue and their
+	// related jobs. The queue can contain one or many events. The jobs
+	// present in the events are specific to this action only.
+	//
+	// This allows to parse everything needed and make a request to the
+	// destination for each event / job.
+	for _, event := range queue.Events {
+		for _, job := range event.Jobs {
+			var create Create
+			if failed := decodeJob(job, &create); failed != nil {
+				then <- *failed
+				continue
+			}
+
+			// Get the collection the document shall be loaded into.
+			collection, failed := a.collections.forJob(job.ID, "Create", create.Collection)
+			if failed != nil {
+				then <- *failed
+				continue
+			}
+
+			// Discard the job if the document can not be prepared, so bad or
+			// sensitive data never reaches the store.
+			if failed := a.env.prepare(job, &write{
+				action:       "Create",
+				collection:   create.Collection,
+				document:     create.Document,
+				expiry:       create.Expiry,
+				generatedKey: true,
+			}); failed != nil {
+				then <- *failed
+				continue
+			}
+
+			// Read the document before changing it if the audit is enabled, so the
+			// change can be recorded.
+			entry, err := a.collections.beginAudit(event, job, "create", create.Collection, collection, create.Document)
+			if err != nil {
+				then <- destination.Then{
+					Jobs:  []string{job.ID},
+					Error: err,
+				}
+
+				continue
+			}
+
+			// Create the document in the docstore. The policy of the job is
+			// applied if the document already exists.
+			err = collection.Create(a.ctx, create.Document)
+			if err == nil {
+				a.collections.commitAudit(tk, entry, collection, create.Document)
+			}
+
+			then <- thenWithPolicy(job.ID, err, gcerrors.AlreadyExists, create.IfExists)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package docstoredestination
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/destination"
+)
+
+var _ destination.Action = Create{}
+
+func TestCreate_Load(t *testing.T) {
+	tests := []struct {
+		name        string
+		existing    bool
+		data        []byte
+		wantErr     bool
+		wantDiscard bool
+		wantName    string
+	}{
+		{
+			name:     "WithNewDocument",
+			existing: false,
+			data:     []byte(`{"document":{"id":"user-1","name":"Jane"}}`),
+			wantErr:  false,
+			wantName: "Jane",
+		},
+		{
+			name:        "WithExistingDocument",
+			existing:    true,
+			data:        []byte(`{"document":{"id":"user-1","name":"Jane"}}`),
+			wantErr:     true,
+			wantDiscard: true,
+			wantName:    "John",
+		},
+		{
+			name:     "WithExistingDocumentAndSucceedPolicy",
+			existing: true,
+			data:     []byte(`{"document":{"id":"user-1","name":"Jane"},"if_exists":"succeed"}`),
+			wantErr:  false,
+			wantName: "John",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			d := newMemory(t, &Options{})
+			if tt.existing {
+				defaultCollection(t, d).Put(ctx, map[string]interface{}{"id": "user-1", "name": "John"})
+			}
+
+			got := load(d.Actions()["create"], tt.data)
+			if (got.Error != nil) != tt.wantErr {
+				t.Fatalf("Create.Load() error = %v, wantErr %v", got.Error, tt.wantErr)
+			}
+			if got.ForceDiscard != tt.wantDiscard {
+				t.Errorf("Create.Load() discard = %v, want %v", got.ForceDiscard, tt.wantDiscard)
+			}
+
+			doc := map[string]interface{}{"id": "user-1"}
+			defaultCollection(t, d).Get(ctx, doc)
+			if doc["name"] != tt.wantName {
+				t.Errorf("Collection.Get() name = %v, want %v", doc["name"], tt.wantName)
+			}
+		})
+	}
+}
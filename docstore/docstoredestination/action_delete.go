@@ -0,0 +1,183 @@
+package docstoredestination
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/destination"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+Delete implements the Blacksmith destination.Action interface for the action
+"delete". It holds the complete job's structure to load into the destination.
+
+Deleting a document that does not exist succeeds.
+*/
+type Delete struct {
+	env         *Options
+	ctx         context.Context
+	collections *collections
+
+	// Destination is the name of the destination the action is loaded into, as
+	// set in its options. It allows to validate the action against the options
+	// of the destination when marshaled.
+	//
+	// Only needed if there are many docstore destinations. When not set and the
+	// destination can not be found, the action is validated when loaded.
+	Destination string `json:"-"`
+
+	// Document holds the key fields of the document to delete. Other fields are
+	// ignored.
+	//
+	// Required.
+	Document map[string]interface{} `json:"document"`
+
+	// Collection is the name of the collection to load the document into. It
+	// must be allowed in the options of the destination.
+	//
+	// Defaults to the collection set in the connection string.
+	Collection string `json:"collection,omitempty"`
+}
+
+/*
+String returns the string representation of the action Delete.
+*/
+func (a Delete) String() string {
+	return "delete"
+}
+
+/*
+Schedule allows the action to override the schedule options of its
+destination. Do not override.
+*/
+func (a Delete) Schedule() *destination.Schedule {
+	return nil
+}
+
+/*
+Marshal is the function being run when the action receives data into
+the Delete receiver. It allows to transform and enrich the data before
+saving it in the store adapter.
+*/
+func (a Delete) Marshal(tk *destination.Toolkit) (*destination.Job, error) {
+
+	// Find the options of the destination, so the action is validated against
+	// them before being saved. If they can not be found, the document is
+	// validated when loaded and the job is discarded if invalid.
+	env, validations := lookup(a.env, a.Destination, "Delete")
+	if len(validations) > 0 {
+		return nil, &errors.Error{
+			StatusCode:  400,
+			Message:     "Bad Request",
+			Validations: validations,
+		}
+	}
+
+	if env != nil {
+		// Ensure the document can be keyed, so unkeyable documents are rejected
+		// before being saved.
+		if validations := env.keyDocument("Delete", a.Document); len(validations) > 0 {
+			return nil, &errors.Error{
+				StatusCode:  400,
+				Message:     "Bad Request",
+				Validations: validations,
+			}
+		}
+
+		// Ensure the collection is allowed.
+		if validations := env.allowCollection("Delete", a.Collection); len(validations) > 0 {
+			return nil, &errors.Error{
+				StatusCode:  400,
+				Message:     "Bad Request",
+				Validations: validations,
+			}
+		}
+	}
+
+	// Try to marshal the data passed directly to the receiver.
+	data, err := json.Marshal(&a)
+	if err != nil {
+		return nil, &errors.Error{
+			StatusCode: 400,
+			Message:    "Bad Request",
+		}
+	}
+
+	// Create a job with the data. Since the 'Context' key is not
+	// set, the one from the event will automatically be applied.
+	j := &destination.Job{
+		Data: data,
+	}
+
+	// Return the job including the marshaled data.
+	return j, nil
+}
+
+/*
+Load is the function being run by the scheduler to load the data into
+the destination. It is in charge of the "L" in the ETL process.
+*/
+func (a Delete) Load(tk *destination.Toolkit, queue *store.Queue, then chan<- destination.Then) {
+
+	// We can go through every events received from the queue and their
+	// related jobs. The queue can contain one or many events. The jobs
+	// present in the events are specific to this action only.
+	//
+	// This allows to parse everything needed and make a request to the
+	// destination for each event / job.
+	for _, event := range queue.Events {
+		for _, job := range event.Jobs {
+			var del Delete
+			if failed := decodeJob(job, &del); failed != nil {
+				then <- *failed
+				continue
+			}
+
+			// Get the collection the document shall be loaded into.
+			collection, failed := a.collections.forJob(job.ID, "Delete", del.Collection)
+			if failed != nil {
+				then <- *failed
+				continue
+			}
+
+			// Discard the job if the document can not be prepared. The key fields
+			// of the document are protected the same way they are when written, so
+			// the document stored can be found.
+			if failed := a.env.prepare(job, &write{
+				action:     "Delete",
+				collection: del.Collection,
+				document:   del.Document,
+				partial:    true,
+			}); failed != nil {
+				then <- *failed
+				continue
+			}
+
+			// Read the document before changing it if the audit is enabled, so the
+			// change can be recorded.
+			entry, err := a.collections.beginAudit(event, job, "delete", del.Collection, collection, del.Document)
+			if err != nil {
+				then <- destination.Then{
+					Jobs:  []string{job.ID},
+					Error: err,
+				}
+
+				continue
+			}
+
+			// Delete the document from the docstore.
+			a.env.normalizeRevision(del.Document)
+			err = collection.Delete(a.ctx, del.Document)
+			if err == nil {
+				a.collections.commitAudit(tk, entry, collection, del.Document)
+			}
+
+			then <- destination.Then{
+				Jobs:  []string{job.ID},
+				Error: err,
+			}
+		}
+	}
+}
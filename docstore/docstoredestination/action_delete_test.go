@@ -0,0 +1,47 @@
+package docstoredestination
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/destination"
+
+	"gocloud.dev/gcerrors"
+)
+
+var _ destination.Action = Delete{}
+
+func TestDelete_Load(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing bool
+	}{
+		{
+			name:     "WithExistingDocument",
+			existing: true,
+		},
+		{
+			name:     "WithMissingDocument",
+			existing: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			d := newMemory(t, &Options{})
+			if tt.existing {
+				defaultCollection(t, d).Put(ctx, map[string]interface{}{"id": "user-1", "name": "John"})
+			}
+
+			got := load(d.Actions()["delete"], []byte(`{"document":{"id":"user-1"}}`))
+			if got.Error != nil {
+				t.Fatalf("Delete.Load() error = %v", got.Error)
+			}
+
+			err := defaultCollection(t, d).Get(ctx, map[string]interface{}{"id": "user-1"})
+			if gcerrors.Code(err) != gcerrors.NotFound {
+				t.Errorf("Collection.Get() error = %v, want NotFound", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,451 @@
+package docstoredestination
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/destination"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"gocloud.dev/docstore"
+	"gocloud.dev/gcerrors"
+)
+
+/*
+defaultLookupLimit is the maximum number of documents returned by a query when
+the action Lookup has no limit set.
+*/
+const defaultLookupLimit = 100
+
+/*
+Lookup implements the Blacksmith destination.Action interface for the action
+"lookup". It holds the complete job's structure to load into the destination.
+
+It reads documents to enrich the data of an event, and forwards the result to
+other destinations' actions returned by the option OnLookup. The actions are run
+once the job has succeeded. Documents are either read by key, or by a query
+when Where is set. Only one of Document or Where must be set.
+*/
+type Lookup struct {
+	env         *Options
+	ctx         context.Context
+	collections *collections
+
+	// Destination is the name of the destination the action is loaded into, as
+	// set in its options. It allows to validate the action against the options
+	// of the destination when marshaled.
+	//
+	// Only needed if there are many docstore destinations. When not set and the
+	// destination can not be found, the action is validated when loaded.
+	Destination string `json:"-"`
+
+	// Document holds the key fields of the document to read. Other fields are
+	// ignored.
+	Document map[string]interface{} `json:"document,omitempty"`
+
+	// Where is the list of filters of the query to run. Documents must satisfy
+	// every filter.
+	Where []Filter `json:"where,omitempty"`
+
+	// Limit is the maximum number of documents returned by the query.
+	//
+	// Defaults to 100.
+	Limit int `json:"limit,omitempty"`
+
+	// Collection is the name of the collection to read the documents from. It
+	// must be allowed in the options of the destination.
+	//
+	// Defaults to the collection set in the connection string.
+	Collection string `json:"collection,omitempty"`
+
+	// Data is the data to enrich with the documents read.
+	//
+	// Example: map[string]interface{}{"user_id": "123", "event": "Signed Up"}
+	Data map[string]interface{} `json:"data,omitempty"`
+
+	// Into is the field of Data to set with the documents read. When reading by
+	// key, the fields of the document are merged into Data if not set, without
+	// overriding the existing ones. When querying, Into is required and is set
+	// with the list of documents read.
+	//
+	// Example: "customer"
+	Into string `json:"into,omitempty"`
+
+	// IfMissing is the policy to apply if the document read by key does not
+	// exist.
+	//
+	// Defaults to PolicyDiscard.
+	IfMissing Policy `json:"if_missing,omitempty"`
+}
+
+/*
+Filter is a filter of the query run by the action Lookup.
+*/
+type Filter struct {
+
+	// Field is the path of the field to filter on. Field paths use dots to
+	// select fields of sub-documents, such as "address.city".
+	//
+	// Required.
+	Field string `json:"field"`
+
+	// Op is the operator to compare the field with the value. Valid operators are
+	// "=", ">", "<", ">=", and "<=".
+	//
+	// Required.
+	Op string `json:"op"`
+
+	// Value is the value to compare the field with. It must be a string, a
+	// number, or a time.
+	//
+	// Required.
+	Value interface{} `json:"value"`
+}
+
+/*
+validFilterOps is the list of operators allowed in a Filter.
+*/
+var validFilterOps = map[string]bool{
+	"=":  true,
+	">":  true,
+	"<":  true,
+	">=": true,
+	"<=": true,
+}
+
+/*
+String returns the string representation of the action Lookup.
+*/
+func (a Lookup) String() string {
+	return "lookup"
+}
+
+/*
+Schedule allows the action to override the schedule options of its
+destination. Do not override.
+*/
+func (a Lookup) Schedule() *destination.Schedule {
+	return nil
+}
+
+/*
+Marshal is the function being run when the action receives data into
+the Lookup receiver. It allows to transform and enrich the data before
+saving it in the store adapter.
+*/
+func (a Lookup) Marshal(tk *destination.Toolkit) (*destination.Job, error) {
+
+	// Ensure the action reads documents either by key or by a query.
+	if validations := a.validate(); len(validations) > 0 {
+		return nil, &errors.Error{
+			StatusCode:  400,
+			Message:     "Bad Request",
+			Validations: validations,
+		}
+	}
+
+	// Find the options of the destination, so the action is validated against
+	// them before being saved. If they can not be found, the document is
+	// validated when loaded and the job is discarded if invalid.
+	env, validations := lookup(a.env, a.Destination, "Lookup")
+	if len(validations) > 0 {
+		return nil, &errors.Error{
+			StatusCode:  400,
+			Message:     "Bad Request",
+			Validations: validations,
+		}
+	}
+
+	if env != nil {
+		// Ensure the document can be keyed, so unkeyable documents are rejected
+		// before being saved.
+		if a.Document != nil {
+			if validations := env.keyDocument("Lookup", a.Document); len(validations) > 0 {
+				return nil, &errors.Error{
+					StatusCode:  400,
+					Message:     "Bad Request",
+					Validations: validations,
+				}
+			}
+		}
+
+		// Ensure the collection is allowed.
+		if validations := env.allowCollection("Lookup", a.Collection); len(validations) > 0 {
+			return nil, &errors.Error{
+				StatusCode:  400,
+				Message:     "Bad Request",
+				Validations: validations,
+			}
+		}
+	}
+
+	// Try to marshal the data passed directly to the receiver.
+	data, err := json.Marshal(&a)
+	if err != nil {
+		return nil, &errors.Error{
+			StatusCode: 400,
+			Message:    "Bad Request",
+		}
+	}
+
+	// Create a job with the data. Since the 'Context' key is not
+	// set, the one from the event will automatically be applied.
+	j := &destination.Job{
+		Data: data,
+	}
+
+	// Return the job including the marshaled data.
+	return j, nil
+}
+
+/*
+Load is the function being run by the scheduler to load the data into
+the destination. It is in charge of the "L" in the ETL process.
+*/
+func (a Lookup) Load(tk *destination.Toolkit, queue *store.Queue, then chan<- destination.Then) {
+
+	// We can go through every events received from the queue and their
+	// related jobs. The queue can contain one or many events. The jobs
+	// present in the events are specific to this action only.
+	//
+	// This allows to parse everything needed and make a request to the
+	// destination for each event / job.
+	for _, event := range queue.Events {
+		for _, job := range event.Jobs {
+			var lookup Lookup
+			if failed := decodeJob(job, &lookup); failed != nil {
+				then <- *failed
+				continue
+			}
+
+			// Discard the job if the lookup is not valid, since retrying it would
+			// not help.
+			if validations := lookup.validate(); len(validations) > 0 {
+				then <- destination.Then{
+					Jobs: []string{job.ID},
+					Error: &errors.Error{
+						Message:     "docstore: Lookup not valid",
+						Validations: validations,
+					},
+					ForceDiscard: true,
+				}
+
+				continue
+			}
+
+			// Get the collection the documents shall be read from.
+			collection, failed := a.collections.forJob(job.ID, "Lookup", lookup.Collection)
+			if failed != nil {
+				then <- *failed
+				continue
+			}
+
+			if lookup.Document != nil {
+				then <- a.get(tk, collection, job, lookup)
+			} else {
+				then <- a.query(tk, collection, job.ID, lookup)
+			}
+		}
+	}
+}
+
+/*
+get reads a document by key and forwards the data enriched with it.
+*/
+func (a Lookup) get(tk *destination.Toolkit, collection *docstore.Collection, job *store.Job, lookup Lookup) destination.Then {
+
+	// Discard the job if the document can not be prepared. The key fields of
+	// the document are protected the same way they are when written, so the
+	// document stored can be found.
+	if failed := a.env.prepare(job, &write{
+		action:     "Lookup",
+		collection: lookup.Collection,
+		document:   lookup.Document,
+		partial:    true,
+	}); failed != nil {
+		return *failed
+	}
+
+	document := map[string]interface{}{}
+	for _, field := range a.env.keyFields() {
+		document[field] = lookup.Document[field]
+	}
+
+	// Read the document. The policy of the job is applied if the document does
+	// not exist.
+	err := collection.Get(a.ctx, document)
+	if err != nil {
+		return thenWithPolicy(job.ID, err, gcerrors.NotFound, lookup.IfMissing)
+	}
+
+	if err := a.env.Decrypt(document); err != nil {
+		return destination.Then{
+			Jobs:         []string{job.ID},
+			Error:        err,
+			ForceDiscard: true,
+		}
+	}
+
+	merged := lookup.data()
+	if lookup.Into != "" {
+		merged[lookup.Into] = document
+	} else {
+		for field, value := range document {
+			if _, exists := merged[field]; !exists {
+				merged[field] = value
+			}
+		}
+	}
+
+	return a.forward(tk, job.ID, lookup, merged)
+}
+
+/*
+query reads the documents satisfying the filters and forwards the data enriched
+with them.
+*/
+func (a Lookup) query(tk *destination.Toolkit, collection *docstore.Collection, jobID string, lookup Lookup) destination.Then {
+	limit := lookup.Limit
+	if limit == 0 {
+		limit = defaultLookupLimit
+	}
+
+	q := collection.Query().Limit(limit)
+	for _, filter := range lookup.Where {
+		value, err := a.env.protectValue(filter.Field, filter.Value)
+		if err != nil {
+			return destination.Then{
+				Jobs:         []string{jobID},
+				Error:        err,
+				ForceDiscard: true,
+			}
+		}
+
+		q = q.Where(docstore.FieldPath(filter.Field), filter.Op, value)
+	}
+
+	// Read every documents returned by the query. A query not supported by the
+	// document store can not succeed even after retries.
+	documents := []map[string]interface{}{}
+	iter := q.Get(a.ctx)
+	defer iter.Stop()
+
+	for {
+		document := map[string]interface{}{}
+		err := iter.Next(a.ctx, document)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			code := gcerrors.Code(err)
+			return destination.Then{
+				Jobs:         []string{jobID},
+				Error:        err,
+				ForceDiscard: code == gcerrors.InvalidArgument || code == gcerrors.Unimplemented,
+			}
+		}
+
+		if err := a.env.Decrypt(document); err != nil {
+			return destination.Then{
+				Jobs:         []string{jobID},
+				Error:        err,
+				ForceDiscard: true,
+			}
+		}
+
+		documents = append(documents, document)
+	}
+
+	merged := lookup.data()
+	merged[lookup.Into] = documents
+	return a.forward(tk, jobID, lookup, merged)
+}
+
+/*
+forward returns the result of a job, with the actions to run once succeeded
+given the data enriched.
+*/
+func (a Lookup) forward(tk *destination.Toolkit, jobID string, lookup Lookup, merged map[string]interface{}) destination.Then {
+	if a.env.OnLookup == nil {
+		return destination.Then{
+			Jobs: []string{jobID},
+		}
+	}
+
+	return destination.Then{
+		Jobs:        []string{jobID},
+		OnSucceeded: a.env.OnLookup(tk, lookup, merged),
+	}
+}
+
+/*
+data returns a copy of the data to enrich, so the payload of the job is left
+untouched.
+*/
+func (a Lookup) data() map[string]interface{} {
+	data := map[string]interface{}{}
+	for field, value := range a.Data {
+		data[field] = value
+	}
+
+	return data
+}
+
+/*
+validate ensures the action reads documents either by key or by a query, and
+that the filters of the query are valid.
+*/
+func (a Lookup) validate() []errors.Validation {
+	validations := []errors.Validation{}
+
+	if (a.Document == nil) == (len(a.Where) == 0) {
+		validations = append(validations, errors.Validation{
+			Message: "Exactly one of 'Document' or 'Where' must be set",
+			Path:    []string{"Lookup"},
+		})
+	}
+
+	if len(a.Where) > 0 && a.Into == "" {
+		validations = append(validations, errors.Validation{
+			Message: "'Into' must be set when querying documents",
+			Path:    []string{"Lookup", "Into"},
+		})
+	}
+
+	if a.Limit < 0 {
+		validations = append(validations, errors.Validation{
+			Message: "Limit must not be negative",
+			Path:    []string{"Lookup", "Limit"},
+		})
+	}
+
+	for i, filter := range a.Where {
+		path := []string{"Lookup", "Where", fmt.Sprintf("%d", i)}
+		if filter.Field == "" {
+			validations = append(validations, errors.Validation{
+				Message: "Field must be set",
+				Path:    append(path, "Field"),
+			})
+		}
+
+		if !validFilterOps[filter.Op] {
+			validations = append(validations, errors.Validation{
+				Message: fmt.Sprintf("Operator '%s' not valid", filter.Op),
+				Path:    append(path, "Op"),
+			})
+		}
+
+		if filter.Value == nil {
+			validations = append(validations, errors.Validation{
+				Message: "Value must be set",
+				Path:    append(path, "Value"),
+			})
+		}
+	}
+
+	return validations
+}
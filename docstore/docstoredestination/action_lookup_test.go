@@ -0,0 +1,178 @@
+package docstoredestination
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/destination"
+)
+
+var _ destination.Action = Lookup{}
+
+func TestLookup_Marshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  Lookup
+		wantErr bool
+	}{
+		{
+			name: "WithDocument",
+			action: Lookup{
+				Document: map[string]interface{}{"id": "customer-1"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "WithWhere",
+			action: Lookup{
+				Where: []Filter{{Field: "plan", Op: "=", Value: "premium"}},
+				Into:  "customers",
+			},
+			wantErr: false,
+		},
+		{
+			name: "WithDocumentAndWhere",
+			action: Lookup{
+				Document: map[string]interface{}{"id": "customer-1"},
+				Where:    []Filter{{Field: "plan", Op: "=", Value: "premium"}},
+				Into:     "customers",
+			},
+			wantErr: true,
+		},
+		{
+			name: "WithWhereAndNoInto",
+			action: Lookup{
+				Where: []Filter{{Field: "plan", Op: "=", Value: "premium"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "WithInvalidOperator",
+			action: Lookup{
+				Where: []Filter{{Field: "plan", Op: "!=", Value: "premium"}},
+				Into:  "customers",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newOptions(t, &Options{
+				Driver: DriverMemory,
+				Params: url.Values{"id_field": {"id"}},
+			})
+
+			if _, err := tt.action.Marshal(&destination.Toolkit{}); (err != nil) != tt.wantErr {
+				t.Errorf("Lookup.Marshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLookup_Load(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          string
+		wantData      map[string]interface{}
+		wantSucceeded bool
+		wantDiscard   bool
+	}{
+		{
+			name: "WithDocument",
+			data: `{"document":{"id":"customer-1"},"data":{"user_id":"customer-1","plan":"free"}}`,
+			wantData: map[string]interface{}{
+				"user_id": "customer-1",
+				"plan":    "free",
+				"id":      "customer-1",
+				"tier":    "gold",
+			},
+			wantSucceeded: true,
+		},
+		{
+			name: "WithDocumentInto",
+			data: `{"document":{"id":"customer-1"},"data":{"user_id":"customer-1"},"into":"customer"}`,
+			wantData: map[string]interface{}{
+				"user_id":  "customer-1",
+				"customer": map[string]interface{}{"id": "customer-1", "plan": "premium", "tier": "gold"},
+			},
+			wantSucceeded: true,
+		},
+		{
+			name: "WithWhere",
+			data: `{"where":[{"field":"tier","op":"=","value":"gold"}],"into":"customers"}`,
+			wantData: map[string]interface{}{
+				"customers": []map[string]interface{}{
+					{"id": "customer-1", "plan": "premium", "tier": "gold"},
+				},
+			},
+			wantSucceeded: true,
+		},
+		{
+			name:        "WithMissingDocument",
+			data:        `{"document":{"id":"customer-2"}}`,
+			wantDiscard: true,
+		},
+		{
+			name: "WithMissingDocumentAndPolicySucceed",
+			data: `{"document":{"id":"customer-2"},"if_missing":"succeed"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotData map[string]interface{}
+			d := newMemory(t, &Options{
+				OnLookup: func(tk *destination.Toolkit, payload Lookup, data map[string]interface{}) []destination.Action {
+					gotData = data
+					return []destination.Action{
+						Put{Document: data},
+					}
+				},
+			})
+
+			defaultCollection(t, d).Put(context.Background(), map[string]interface{}{"id": "customer-1", "plan": "premium", "tier": "gold"})
+			defaultCollection(t, d).Put(context.Background(), map[string]interface{}{"id": "customer-3", "plan": "free", "tier": "silver"})
+
+			got := load(d.Actions()["lookup"], []byte(tt.data))
+			if got.ForceDiscard != tt.wantDiscard {
+				t.Fatalf("Lookup.Load() discard = %v, want %v (error = %v)", got.ForceDiscard, tt.wantDiscard, got.Error)
+			}
+
+			if (len(got.OnSucceeded) == 1) != tt.wantSucceeded {
+				t.Fatalf("Lookup.Load() OnSucceeded = %v, want forwarded %v", got.OnSucceeded, tt.wantSucceeded)
+			}
+
+			if tt.wantSucceeded && !reflect.DeepEqual(gotData, tt.wantData) {
+				t.Errorf("Lookup.Load() data = %v, want %v", gotData, tt.wantData)
+			}
+		})
+	}
+}
+
+func TestLookup_LoadEncrypted(t *testing.T) {
+	var gotData map[string]interface{}
+	d := newMemory(t, &Options{
+		EncryptFields: []string{"id"},
+		EncryptionKey: testEncryptionKey,
+		OnLookup: func(tk *destination.Toolkit, payload Lookup, data map[string]interface{}) []destination.Action {
+			gotData = data
+			return nil
+		},
+	})
+
+	load(d.Actions()["put"], []byte(`{"document":{"id":"john@example.com","tier":"gold"}}`))
+
+	got := load(d.Actions()["lookup"], []byte(`{"document":{"id":"john@example.com"},"into":"customer"}`))
+	if got.Error != nil {
+		t.Fatalf("Lookup.Load() error = %v", got.Error)
+	}
+
+	want := map[string]interface{}{
+		"customer": map[string]interface{}{"id": "john@example.com", "tier": "gold"},
+	}
+
+	if !reflect.DeepEqual(gotData, want) {
+		t.Errorf("Lookup.Load() data = %v, want %v", gotData, want)
+	}
+}
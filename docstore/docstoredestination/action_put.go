@@ -3,12 +3,14 @@ package docstoredestination
 import (
 	"context"
 	"encoding/json"
+	"time"
 
 	"github.com/nunchistudio/blacksmith/adapter/store"
 	"github.com/nunchistudio/blacksmith/destination"
 	"github.com/nunchistudio/blacksmith/helper/errors"
 
 	"gocloud.dev/docstore"
+	"gocloud.dev/gcerrors"
 )
 
 /*
@@ -16,11 +18,29 @@ Put implements the Blacksmith destination.Action interface for the action
 "put". It holds the complete job's structure to load into the destination.
 */
 type Put struct {
-	env        *Options
-	ctx        context.Context
-	collection *docstore.Collection
+	env         *Options
+	ctx         context.Context
+	collections *collections
+
+	// Destination is the name of the destination the action is loaded into, as
+	// set in its options. It allows to validate the action against the options
+	// of the destination when marshaled.
+	//
+	// Only needed if there are many docstore destinations. When not set and the
+	// destination can not be found, the action is validated when loaded.
+	Destination string `json:"-"`
 
 	Document map[string]interface{} `json:"document"`
+
+	// Collection is the name of the collection to load the document into. It
+	// must be allowed in the options of the destination.
+	//
+	// Defaults to the collection set in the connection string.
+	Collection string `json:"collection,omitempty"`
+
+	// Expiry allows to make the document expire. The 'ttl_field' param must be
+	// set in the options of the destination.
+	Expiry *Expiry `json:"expiry,omitempty"`
 }
 
 /*
@@ -45,6 +65,67 @@ saving it in the store adapter.
 */
 func (a Put) Marshal(tk *destination.Toolkit) (*destination.Job, error) {
 
+	// Find the options of the destination, so the action is validated against
+	// them before being saved. If they can not be found, the document is
+	// validated when loaded and the job is discarded if invalid.
+	env, validations := lookup(a.env, a.Destination, "Put")
+	if len(validations) > 0 {
+		return nil, &errors.Error{
+			StatusCode:  400,
+			Message:     "Bad Request",
+			Validations: validations,
+		}
+	}
+
+	if env != nil {
+		// Ensure the document can be keyed, so unkeyable documents are rejected
+		// before being saved.
+		if validations := env.keyDocument("Put", a.Document); len(validations) > 0 {
+			return nil, &errors.Error{
+				StatusCode:  400,
+				Message:     "Bad Request",
+				Validations: validations,
+			}
+		}
+
+		// Ensure the document satisfies the schema of the collection.
+		if validations := env.validateSchema("Put", a.Collection, a.Document); len(validations) > 0 {
+			return nil, &errors.Error{
+				StatusCode:  400,
+				Message:     "Bad Request",
+				Validations: validations,
+			}
+		}
+
+		// Ensure the collection is allowed.
+		if validations := env.allowCollection("Put", a.Collection); len(validations) > 0 {
+			return nil, &errors.Error{
+				StatusCode:  400,
+				Message:     "Bad Request",
+				Validations: validations,
+			}
+		}
+	}
+
+	// Ensure the expiry is valid, and make it absolute so retrying the job does
+	// not extend the life of the document.
+	if a.Expiry != nil {
+		validations := a.Expiry.validate("Put")
+		if env != nil {
+			validations = env.validateExpiry("Put", a.Expiry)
+		}
+
+		if len(validations) > 0 {
+			return nil, &errors.Error{
+				StatusCode:  400,
+				Message:     "Bad Request",
+				Validations: validations,
+			}
+		}
+
+		a.Expiry = a.Expiry.absolute(time.Now())
+	}
+
 	// Try to marshal the data passed directly to the receiver.
 	data, err := json.Marshal(&a)
 	if err != nil {
@@ -69,6 +150,10 @@ Load is the function being run by the scheduler to load the data into
 the destination. It is in charge of the "L" in the ETL process.
 */
 func (a Put) Load(tk *destination.Toolkit, queue *store.Queue, then chan<- destination.Then) {
+	if a.env.Batch && a.env.AuditCollection == "" {
+		a.loadBatch(tk, queue, then)
+		return
+	}
 
 	// We can go through every events received from the queue and their
 	// related jobs. The queue can contain one or many events. The jobs
@@ -79,12 +164,39 @@ func (a Put) Load(tk *destination.Toolkit, queue *store.Queue, then chan<- desti
 	for _, event := range queue.Events {
 		for _, job := range event.Jobs {
 			var put Put
-			err := json.Unmarshal(job.Data, &put)
+			if failed := decodeJob(job, &put); failed != nil {
+				then <- *failed
+				continue
+			}
+
+			// Get the collection the document shall be loaded into.
+			collection, failed := a.collections.forJob(job.ID, "Put", put.Collection)
+			if failed != nil {
+				then <- *failed
+				continue
+			}
+
+			// Discard the job if the document can not be prepared, so bad or
+			// sensitive data never reaches the store.
+			w := &write{
+				action:     "Put",
+				collection: put.Collection,
+				document:   put.Document,
+				expiry:     put.Expiry,
+			}
+
+			if failed := a.env.prepare(job, w); failed != nil {
+				then <- *failed
+				continue
+			}
+
+			// Read the document before changing it if the audit is enabled, so the
+			// change can be recorded.
+			entry, err := a.collections.beginAudit(event, job, "put", put.Collection, collection, put.Document)
 			if err != nil {
 				then <- destination.Then{
-					Jobs:         []string{job.ID},
-					Error:        err,
-					ForceDiscard: true,
+					Jobs:  []string{job.ID},
+					Error: err,
 				}
 
 				continue
@@ -92,8 +204,20 @@ func (a Put) Load(tk *destination.Toolkit, queue *store.Queue, then chan<- desti
 
 			// Put the document in the docstore. We put them one-by-one and not
 			// in batch (using actions list) for more control over the success or
-			// failure of each job.
-			err = a.collection.Put(a.ctx, put.Document)
+			// failure of each job. See the 'Batch' option for writing them in
+			// batch instead.
+			a.env.normalizeRevision(put.Document)
+			err = collection.Put(a.ctx, put.Document)
+			discarded, err := resolveConflict(a.ctx, tk, a.env, collection, job, w, a.put(collection), err)
+			if discarded != nil {
+				then <- *discarded
+				continue
+			}
+
+			if err == nil {
+				a.collections.commitAudit(tk, entry, collection, put.Document)
+			}
+
 			then <- destination.Then{
 				Jobs:  []string{job.ID},
 				Error: err,
@@ -101,3 +225,177 @@ func (a Put) Load(tk *destination.Toolkit, queue *store.Queue, then chan<- desti
 		}
 	}
 }
+
+/*
+put returns a function writing a single document in the collection.
+*/
+func (a Put) put(collection *docstore.Collection) func(map[string]interface{}) error {
+	return func(document map[string]interface{}) error {
+		return collection.Put(a.ctx, document)
+	}
+}
+
+/*
+batchJob is a job waiting to be written within an actions list.
+*/
+type batchJob struct {
+	*store.Job
+	write *write
+}
+
+/*
+loadBatch writes the documents of every jobs in the queue using an actions list
+per collection, and maps the errors returned back to their jobs so each one
+still has its own result.
+
+An actions list is rejected as a whole without being executed when one of its
+documents is not valid, such as when it has no key or when its key is already
+present in the list. In this case, the documents in error are put aside and the
+list is executed again without them. The documents put aside are then tried in
+a following list so documents sharing the same key are written in order. Since
+writing a document is idempotent, executing a list more than once is safe.
+*/
+func (a Put) loadBatch(tk *destination.Toolkit, queue *store.Queue, then chan<- destination.Then) {
+
+	// Group the jobs by collection so an actions list is executed for each one.
+	// The jobs keep their order within a collection.
+	var order []*docstore.Collection
+	groups := map[*docstore.Collection][]batchJob{}
+
+	for _, event := range queue.Events {
+		for _, job := range event.Jobs {
+			var put Put
+			if failed := decodeJob(job, &put); failed != nil {
+				then <- *failed
+				continue
+			}
+
+			// Get the collection the document shall be loaded into.
+			collection, failed := a.collections.forJob(job.ID, "Put", put.Collection)
+			if failed != nil {
+				then <- *failed
+				continue
+			}
+
+			// Discard the job if the document can not be prepared, so bad or
+			// sensitive data never reaches the store.
+			w := &write{
+				action:     "Put",
+				collection: put.Collection,
+				document:   put.Document,
+				expiry:     put.Expiry,
+			}
+
+			if failed := a.env.prepare(job, w); failed != nil {
+				then <- *failed
+				continue
+			}
+
+			a.env.normalizeRevision(put.Document)
+			if _, exists := groups[collection]; !exists {
+				order = append(order, collection)
+			}
+
+			groups[collection] = append(groups[collection], batchJob{
+				Job:   job,
+				write: w,
+			})
+		}
+	}
+
+	for _, collection := range order {
+		a.writeBatch(tk, collection, groups[collection], then)
+	}
+}
+
+/*
+writeBatch writes the documents of the jobs into the collection using an actions
+list, as described in loadBatch.
+*/
+func (a Put) writeBatch(tk *destination.Toolkit, collection *docstore.Collection, pending []batchJob, then chan<- destination.Then) {
+	var deferred []batchJob
+	for len(pending) > 0 {
+		list := collection.Actions()
+		for _, job := range pending {
+			list.Put(job.write.document)
+		}
+
+		// Every jobs succeeded, we can move on to the jobs put aside if any.
+		err := list.Do(a.ctx)
+		if err == nil {
+			for _, job := range pending {
+				then <- destination.Then{
+					Jobs: []string{job.ID},
+				}
+			}
+
+			pending, deferred = deferred, nil
+			continue
+		}
+
+		// When the errors can not be attributed to specific jobs, every remaining
+		// job is considered failed.
+		failed := map[int]error{}
+		rejected := false
+		alerr, ok := err.(docstore.ActionListError)
+		for _, e := range alerr {
+			if e.Index < 0 || e.Index >= len(pending) {
+				ok = false
+				break
+			}
+
+			failed[e.Index] = e.Err
+			if gcerrors.Code(e.Err) == gcerrors.InvalidArgument {
+				rejected = true
+			}
+		}
+
+		if !ok {
+			for _, job := range append(pending, deferred...) {
+				then <- destination.Then{
+					Jobs:  []string{job.ID},
+					Error: err,
+				}
+			}
+
+			return
+		}
+
+		// If the list has been executed, every job has its own result. Revision
+		// conflicts are resolved one-by-one.
+		if !rejected || len(failed) == len(pending) {
+			for i, job := range pending {
+				err := failed[i]
+				if err != nil && !rejected {
+					var discarded *destination.Then
+					discarded, err = resolveConflict(a.ctx, tk, a.env, collection, job.Job, job.write, a.put(collection), err)
+					if discarded != nil {
+						then <- *discarded
+						continue
+					}
+				}
+
+				then <- destination.Then{
+					Jobs:  []string{job.ID},
+					Error: err,
+				}
+			}
+
+			pending, deferred = deferred, nil
+			continue
+		}
+
+		// Otherwise, put aside the jobs in error and try again with the others.
+		var next []batchJob
+		var aside []batchJob
+		for i, job := range pending {
+			if _, exists := failed[i]; exists {
+				aside = append(aside, job)
+			} else {
+				next = append(next, job)
+			}
+		}
+
+		pending, deferred = next, append(aside, deferred...)
+	}
+}
@@ -1,7 +1,261 @@
 package docstoredestination
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
 	"github.com/nunchistudio/blacksmith/destination"
+	"github.com/nunchistudio/blacksmith/helper/logger"
 )
 
 var _ destination.Action = Put{}
+
+func TestPut_Load(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        []byte
+		wantErr     bool
+		wantDiscard bool
+	}{
+		{
+			name:    "WithDocument",
+			data:    []byte(`{"document":{"id":"user-1","name":"John"}}`),
+			wantErr: false,
+		},
+		{
+			name:        "WithDocumentWithoutKey",
+			data:        []byte(`{"document":{"name":"John"}}`),
+			wantErr:     true,
+			wantDiscard: true,
+		},
+		{
+			name:        "WithInvalidData",
+			data:        []byte("{"),
+			wantErr:     true,
+			wantDiscard: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newMemory(t, &Options{})
+
+			got := load(d.Actions()["put"], tt.data)
+			if (got.Error != nil) != tt.wantErr {
+				t.Fatalf("Put.Load() error = %v, wantErr %v", got.Error, tt.wantErr)
+			}
+			if got.ForceDiscard != tt.wantDiscard {
+				t.Errorf("Put.Load() discard = %v, want %v", got.ForceDiscard, tt.wantDiscard)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var put Put
+			json.Unmarshal(tt.data, &put)
+			doc := map[string]interface{}{
+				"id": put.Document["id"],
+			}
+
+			if err := defaultCollection(t, d).Get(context.Background(), doc); err != nil {
+				t.Fatalf("Collection.Get() error = %v", err)
+			}
+			if doc["name"] != put.Document["name"] {
+				t.Errorf("Collection.Get() name = %v, want %v", doc["name"], put.Document["name"])
+			}
+		})
+	}
+}
+
+func TestPut_LoadBatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     [][]byte
+		wantErrs map[string]bool
+		wantName map[string]string
+	}{
+		{
+			name: "WithValidDocuments",
+			data: [][]byte{
+				[]byte(`{"document":{"id":"user-1","name":"John"}}`),
+				[]byte(`{"document":{"id":"user-2","name":"Jane"}}`),
+			},
+			wantErrs: map[string]bool{
+				"job-0": false,
+				"job-1": false,
+			},
+			wantName: map[string]string{
+				"user-1": "John",
+				"user-2": "Jane",
+			},
+		},
+		{
+			name: "WithDocumentWithoutKey",
+			data: [][]byte{
+				[]byte(`{"document":{"id":"user-1","name":"John"}}`),
+				[]byte(`{"document":{"name":"Jane"}}`),
+				[]byte(`{"document":{"id":"user-2","name":"Jane"}}`),
+			},
+			wantErrs: map[string]bool{
+				"job-0": false,
+				"job-1": true,
+				"job-2": false,
+			},
+			wantName: map[string]string{
+				"user-1": "John",
+				"user-2": "Jane",
+			},
+		},
+		{
+			name: "WithDuplicateKeys",
+			data: [][]byte{
+				[]byte(`{"document":{"id":"user-1","name":"John"}}`),
+				[]byte(`{"document":{"id":"user-2","name":"Jane"}}`),
+				[]byte(`{"document":{"id":"user-1","name":"Johnny"}}`),
+			},
+			wantErrs: map[string]bool{
+				"job-0": false,
+				"job-1": false,
+				"job-2": false,
+			},
+			wantName: map[string]string{
+				"user-1": "Johnny",
+				"user-2": "Jane",
+			},
+		},
+		{
+			name: "WithInvalidData",
+			data: [][]byte{
+				[]byte("{"),
+				[]byte(`{"document":{"id":"user-1","name":"John"}}`),
+			},
+			wantErrs: map[string]bool{
+				"job-0": true,
+				"job-1": false,
+			},
+			wantName: map[string]string{
+				"user-1": "John",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newMemory(t, &Options{
+				Batch: true,
+			})
+
+			event := &store.Event{
+				ID: "event",
+			}
+
+			for i, data := range tt.data {
+				event.Jobs = append(event.Jobs, &store.Job{
+					ID:   fmt.Sprintf("job-%d", i),
+					Data: data,
+				})
+			}
+
+			then := make(chan destination.Then, len(tt.data))
+			d.Actions()["put"].Load(&destination.Toolkit{
+				Logger: logger.Default,
+			}, &store.Queue{
+				Events: []*store.Event{event},
+			}, then)
+			close(then)
+
+			got := map[string]bool{}
+			for result := range then {
+				for _, id := range result.Jobs {
+					got[id] = result.Error != nil
+				}
+			}
+
+			if !reflect.DeepEqual(got, tt.wantErrs) {
+				t.Errorf("Put.Load() errors = %v, want %v", got, tt.wantErrs)
+			}
+
+			for id, name := range tt.wantName {
+				doc := map[string]interface{}{
+					"id": id,
+				}
+
+				if err := defaultCollection(t, d).Get(context.Background(), doc); err != nil {
+					t.Fatalf("Collection.Get() error = %v", err)
+				}
+				if doc["name"] != name {
+					t.Errorf("Collection.Get() name = %v, want %v", doc["name"], name)
+				}
+			}
+		})
+	}
+}
+
+func TestPut_MarshalDestination(t *testing.T) {
+	tests := []struct {
+		name         string
+		destinations []string
+		action       Put
+		wantErr      bool
+	}{
+		{
+			name:         "WithSingleDestination",
+			destinations: []string{"users"},
+			action:       Put{Document: map[string]interface{}{"id": "1", "email": "john@example.com"}},
+			wantErr:      false,
+		},
+		{
+			name:         "WithSingleDestinationAndUnkeyableDocument",
+			destinations: []string{"users"},
+			action:       Put{Document: map[string]interface{}{"email": "john@example.com"}},
+			wantErr:      true,
+		},
+		{
+			name:         "WithSingleDestinationAndInvalidDocument",
+			destinations: []string{"users"},
+			action:       Put{Document: map[string]interface{}{"id": "1"}},
+			wantErr:      true,
+		},
+		{
+			name:         "WithManyDestinations",
+			destinations: []string{"users", "orders"},
+			action:       Put{Document: map[string]interface{}{"email": "john@example.com"}},
+			wantErr:      false,
+		},
+		{
+			name:         "WithManyDestinationsAndDestination",
+			destinations: []string{"users", "orders"},
+			action:       Put{Destination: "orders", Document: map[string]interface{}{"email": "john@example.com"}},
+			wantErr:      true,
+		},
+		{
+			name:         "WithUnknownDestination",
+			destinations: []string{"users"},
+			action:       Put{Destination: "orders", Document: map[string]interface{}{"id": "1"}},
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetRegistry(t)
+			for _, name := range tt.destinations {
+				New(&Options{
+					Name:       name,
+					Driver:     DriverMemory,
+					Connection: name,
+					Schema: map[string]string{
+						name: testSchema,
+					},
+					Params: url.Values{"id_field": {"id"}},
+				})
+			}
+
+			if _, err := tt.action.Marshal(&destination.Toolkit{}); (err != nil) != tt.wantErr {
+				t.Errorf("Put.Marshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
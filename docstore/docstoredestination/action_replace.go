@@ -0,0 +1,238 @@
+package docstoredestination
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/destination"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"gocloud.dev/docstore"
+	"gocloud.dev/gcerrors"
+)
+
+/*
+Replace implements the Blacksmith destination.Action interface for the action
+"replace". It holds the complete job's structure to load into the destination.
+
+The document is replaced only if it already exists.
+*/
+type Replace struct {
+	env         *Options
+	ctx         context.Context
+	collections *collections
+
+	// Destination is the name of the destination the action is loaded into, as
+	// set in its options. It allows to validate the action against the options
+	// of the destination when marshaled.
+	//
+	// Only needed if there are many docstore destinations. When not set and the
+	// destination can not be found, the action is validated when loaded.
+	Destination string `json:"-"`
+
+	// Document is the document replacing the existing one. Its key fields must
+	// be set.
+	//
+	// Required.
+	Document map[string]interface{} `json:"document"`
+
+	// Collection is the name of the collection to load the document into. It
+	// must be allowed in the options of the destination.
+	//
+	// Defaults to the collection set in the connection string.
+	Collection string `json:"collection,omitempty"`
+
+	// Expiry allows to make the document expire. The 'ttl_field' param must be
+	// set in the options of the destination.
+	Expiry *Expiry `json:"expiry,omitempty"`
+
+	// IfMissing is the policy to apply if the document does not exist.
+	//
+	// Defaults to PolicyDiscard.
+	IfMissing Policy `json:"if_missing,omitempty"`
+}
+
+/*
+String returns the string representation of the action Replace.
+*/
+func (a Replace) String() string {
+	return "replace"
+}
+
+/*
+Schedule allows the action to override the schedule options of its
+destination. Do not override.
+*/
+func (a Replace) Schedule() *destination.Schedule {
+	return nil
+}
+
+/*
+Marshal is the function being run when the action receives data into
+the Replace receiver. It allows to transform and enrich the data before
+saving it in the store adapter.
+*/
+func (a Replace) Marshal(tk *destination.Toolkit) (*destination.Job, error) {
+
+	// Find the options of the destination, so the action is validated against
+	// them before being saved. If they can not be found, the document is
+	// validated when loaded and the job is discarded if invalid.
+	env, validations := lookup(a.env, a.Destination, "Replace")
+	if len(validations) > 0 {
+		return nil, &errors.Error{
+			StatusCode:  400,
+			Message:     "Bad Request",
+			Validations: validations,
+		}
+	}
+
+	if env != nil {
+		// Ensure the document can be keyed, so unkeyable documents are rejected
+		// before being saved.
+		if validations := env.keyDocument("Replace", a.Document); len(validations) > 0 {
+			return nil, &errors.Error{
+				StatusCode:  400,
+				Message:     "Bad Request",
+				Validations: validations,
+			}
+		}
+
+		// Ensure the document satisfies the schema of the collection.
+		if validations := env.validateSchema("Replace", a.Collection, a.Document); len(validations) > 0 {
+			return nil, &errors.Error{
+				StatusCode:  400,
+				Message:     "Bad Request",
+				Validations: validations,
+			}
+		}
+
+		// Ensure the collection is allowed.
+		if validations := env.allowCollection("Replace", a.Collection); len(validations) > 0 {
+			return nil, &errors.Error{
+				StatusCode:  400,
+				Message:     "Bad Request",
+				Validations: validations,
+			}
+		}
+	}
+
+	// Ensure the expiry is valid, and make it absolute so retrying the job does
+	// not extend the life of the document.
+	if a.Expiry != nil {
+		validations := a.Expiry.validate("Replace")
+		if env != nil {
+			validations = env.validateExpiry("Replace", a.Expiry)
+		}
+
+		if len(validations) > 0 {
+			return nil, &errors.Error{
+				StatusCode:  400,
+				Message:     "Bad Request",
+				Validations: validations,
+			}
+		}
+
+		a.Expiry = a.Expiry.absolute(time.Now())
+	}
+
+	// Try to marshal the data passed directly to the receiver.
+	data, err := json.Marshal(&a)
+	if err != nil {
+		return nil, &errors.Error{
+			StatusCode: 400,
+			Message:    "Bad Request",
+		}
+	}
+
+	// Create a job with the data. Since the 'Context' key is not
+	// set, the one from the event will automatically be applied.
+	j := &destination.Job{
+		Data: data,
+	}
+
+	// Return the job including the marshaled data.
+	return j, nil
+}
+
+/*
+Load is the function being run by the scheduler to load the data into
+the destination. It is in charge of the "L" in the ETL process.
+*/
+func (a Replace) Load(tk *destination.Toolkit, queue *store.Queue, then chan<- destination.Then) {
+
+	// We can go through every events received from the queue and their
+	// related jobs. The queue can contain one or many events. The jobs
+	// present in the events are specific to this action only.
+	//
+	// This allows to parse everything needed and make a request to the
+	// destination for each event / job.
+	for _, event := range queue.Events {
+		for _, job := range event.Jobs {
+			var replace Replace
+			if failed := decodeJob(job, &replace); failed != nil {
+				then <- *failed
+				continue
+			}
+
+			// Get the collection the document shall be loaded into.
+			collection, failed := a.collections.forJob(job.ID, "Replace", replace.Collection)
+			if failed != nil {
+				then <- *failed
+				continue
+			}
+
+			// Discard the job if the document can not be prepared, so bad or
+			// sensitive data never reaches the store.
+			w := &write{
+				action:     "Replace",
+				collection: replace.Collection,
+				document:   replace.Document,
+				expiry:     replace.Expiry,
+			}
+
+			if failed := a.env.prepare(job, w); failed != nil {
+				then <- *failed
+				continue
+			}
+
+			// Read the document before changing it if the audit is enabled, so the
+			// change can be recorded.
+			entry, err := a.collections.beginAudit(event, job, "replace", replace.Collection, collection, replace.Document)
+			if err != nil {
+				then <- destination.Then{
+					Jobs:  []string{job.ID},
+					Error: err,
+				}
+
+				continue
+			}
+
+			// Replace the document in the docstore. The policy of the job is
+			// applied if the document does not exist.
+			a.env.normalizeRevision(replace.Document)
+			err = collection.Replace(a.ctx, replace.Document)
+			discarded, err := resolveConflict(a.ctx, tk, a.env, collection, job, w, a.replace(collection), err)
+			if discarded != nil {
+				then <- *discarded
+				continue
+			}
+
+			if err == nil {
+				a.collections.commitAudit(tk, entry, collection, replace.Document)
+			}
+
+			then <- thenWithPolicy(job.ID, err, gcerrors.NotFound, replace.IfMissing)
+		}
+	}
+}
+
+/*
+replace returns a function replacing a single document in the collection.
+*/
+func (a Replace) replace(collection *docstore.Collection) func(map[string]interface{}) error {
+	return func(document map[string]interface{}) error {
+		return collection.Replace(a.ctx, document)
+	}
+}
@@ -0,0 +1,69 @@
+package docstoredestination
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/destination"
+)
+
+var _ destination.Action = Replace{}
+
+func TestReplace_Load(t *testing.T) {
+	tests := []struct {
+		name        string
+		existing    bool
+		data        []byte
+		wantErr     bool
+		wantDiscard bool
+	}{
+		{
+			name:     "WithExistingDocument",
+			existing: true,
+			data:     []byte(`{"document":{"id":"user-1","name":"Jane"}}`),
+			wantErr:  false,
+		},
+		{
+			name:        "WithMissingDocument",
+			existing:    false,
+			data:        []byte(`{"document":{"id":"user-1","name":"Jane"}}`),
+			wantErr:     true,
+			wantDiscard: true,
+		},
+		{
+			name:     "WithMissingDocumentAndSucceedPolicy",
+			existing: false,
+			data:     []byte(`{"document":{"id":"user-1","name":"Jane"},"if_missing":"succeed"}`),
+			wantErr:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			d := newMemory(t, &Options{})
+			if tt.existing {
+				defaultCollection(t, d).Put(ctx, map[string]interface{}{"id": "user-1", "name": "John", "age": 42})
+			}
+
+			got := load(d.Actions()["replace"], tt.data)
+			if (got.Error != nil) != tt.wantErr {
+				t.Fatalf("Replace.Load() error = %v, wantErr %v", got.Error, tt.wantErr)
+			}
+			if got.ForceDiscard != tt.wantDiscard {
+				t.Errorf("Replace.Load() discard = %v, want %v", got.ForceDiscard, tt.wantDiscard)
+			}
+			if !tt.existing {
+				return
+			}
+
+			doc := map[string]interface{}{"id": "user-1"}
+			defaultCollection(t, d).Get(ctx, doc)
+			if doc["name"] != "Jane" {
+				t.Errorf("Collection.Get() name = %v, want %v", doc["name"], "Jane")
+			}
+			if _, ok := doc["age"]; ok {
+				t.Errorf("Collection.Get() age should have been removed")
+			}
+		})
+	}
+}
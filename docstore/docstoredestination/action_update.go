@@ -0,0 +1,291 @@
+package docstoredestination
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/destination"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"gocloud.dev/docstore"
+	"gocloud.dev/gcerrors"
+)
+
+/*
+Update implements the Blacksmith destination.Action interface for the action
+"update". It holds the complete job's structure to load into the destination.
+
+It applies field-level modifications to an existing document. Field paths use
+dots to select fields of sub-documents, such as "address.city".
+*/
+type Update struct {
+	env         *Options
+	ctx         context.Context
+	collections *collections
+
+	// Destination is the name of the destination the action is loaded into, as
+	// set in its options. It allows to validate the action against the options
+	// of the destination when marshaled.
+	//
+	// Only needed if there are many docstore destinations. When not set and the
+	// destination can not be found, the action is validated when loaded.
+	Destination string `json:"-"`
+
+	// Document holds the key fields of the document to update. If the revision
+	// field is set, the update is applied only if it matches the revision of the
+	// document stored. Other fields are ignored.
+	//
+	// Required.
+	Document map[string]interface{} `json:"document"`
+
+	// Collection is the name of the collection to load the document into. It
+	// must be allowed in the options of the destination.
+	//
+	// Defaults to the collection set in the connection string.
+	Collection string `json:"collection,omitempty"`
+
+	// Expiry allows to make the document expire. The 'ttl_field' param must be
+	// set in the options of the destination.
+	Expiry *Expiry `json:"expiry,omitempty"`
+
+	// Set is the list of fields to set with their new value.
+	//
+	// Example: map[string]interface{}{"plan": "premium"}
+	Set map[string]interface{} `json:"set,omitempty"`
+
+	// Increment is the list of numeric fields to increment with the amount to
+	// add. The amount can be negative.
+	//
+	// Example: map[string]interface{}{"logins": 1}
+	Increment map[string]interface{} `json:"increment,omitempty"`
+
+	// Unset is the list of fields to remove.
+	//
+	// Example: []string{"trial_ends_at"}
+	Unset []string `json:"unset,omitempty"`
+
+	// IfMissing is the policy to apply if the document does not exist.
+	//
+	// Defaults to PolicyDiscard.
+	IfMissing Policy `json:"if_missing,omitempty"`
+}
+
+/*
+String returns the string representation of the action Update.
+*/
+func (a Update) String() string {
+	return "update"
+}
+
+/*
+Schedule allows the action to override the schedule options of its
+destination. Do not override.
+*/
+func (a Update) Schedule() *destination.Schedule {
+	return nil
+}
+
+/*
+Marshal is the function being run when the action receives data into
+the Update receiver. It allows to transform and enrich the data before
+saving it in the store adapter.
+*/
+func (a Update) Marshal(tk *destination.Toolkit) (*destination.Job, error) {
+
+	// Find the options of the destination, so the action is validated against
+	// them before being saved. If they can not be found, the document is
+	// validated when loaded and the job is discarded if invalid.
+	env, validations := lookup(a.env, a.Destination, "Update")
+	if len(validations) > 0 {
+		return nil, &errors.Error{
+			StatusCode:  400,
+			Message:     "Bad Request",
+			Validations: validations,
+		}
+	}
+
+	if env != nil {
+		// Ensure the document can be keyed, so unkeyable documents are rejected
+		// before being saved.
+		if validations := env.keyDocument("Update", a.Document); len(validations) > 0 {
+			return nil, &errors.Error{
+				StatusCode:  400,
+				Message:     "Bad Request",
+				Validations: validations,
+			}
+		}
+
+		// Ensure the collection is allowed.
+		if validations := env.allowCollection("Update", a.Collection); len(validations) > 0 {
+			return nil, &errors.Error{
+				StatusCode:  400,
+				Message:     "Bad Request",
+				Validations: validations,
+			}
+		}
+	}
+
+	// Ensure the expiry is valid, and make it absolute so retrying the job does
+	// not extend the life of the document.
+	if a.Expiry != nil {
+		validations := a.Expiry.validate("Update")
+		if env != nil {
+			validations = env.validateExpiry("Update", a.Expiry)
+		}
+
+		if len(validations) > 0 {
+			return nil, &errors.Error{
+				StatusCode:  400,
+				Message:     "Bad Request",
+				Validations: validations,
+			}
+		}
+
+		a.Expiry = a.Expiry.absolute(time.Now())
+	}
+
+	// Try to marshal the data passed directly to the receiver.
+	data, err := json.Marshal(&a)
+	if err != nil {
+		return nil, &errors.Error{
+			StatusCode: 400,
+			Message:    "Bad Request",
+		}
+	}
+
+	// Create a job with the data. Since the 'Context' key is not
+	// set, the one from the event will automatically be applied.
+	j := &destination.Job{
+		Data: data,
+	}
+
+	// Return the job including the marshaled data.
+	return j, nil
+}
+
+/*
+Load is the function being run by the scheduler to load the data into
+the destination. It is in charge of the "L" in the ETL process.
+*/
+func (a Update) Load(tk *destination.Toolkit, queue *store.Queue, then chan<- destination.Then) {
+
+	// We can go through every events received from the queue and their
+	// related jobs. The queue can contain one or many events. The jobs
+	// present in the events are specific to this action only.
+	//
+	// This allows to parse everything needed and make a request to the
+	// destination for each event / job.
+	for _, event := range queue.Events {
+		for _, job := range event.Jobs {
+			var update Update
+			if failed := decodeJob(job, &update); failed != nil {
+				then <- *failed
+				continue
+			}
+
+			// Get the collection the document shall be loaded into.
+			collection, failed := a.collections.forJob(job.ID, "Update", update.Collection)
+			if failed != nil {
+				then <- *failed
+				continue
+			}
+
+			// Discard the job if the document can not be prepared. The expiration
+			// time may be added to the fields to set.
+			w := &write{
+				action:     "Update",
+				collection: update.Collection,
+				document:   update.Document,
+				expiry:     update.Expiry,
+				partial:    true,
+				set:        update.Set,
+				increment:  update.Increment,
+			}
+
+			if failed := a.env.prepare(job, w); failed != nil {
+				then <- *failed
+				continue
+			}
+
+			update.Set = w.set
+
+			// Build the modifications to apply. Invalid modifications can not
+			// succeed even after retries.
+			mods, err := update.mods()
+			if err != nil {
+				then <- destination.Then{
+					Jobs:         []string{job.ID},
+					Error:        err,
+					ForceDiscard: true,
+				}
+
+				continue
+			}
+
+			// Read the document before changing it if the audit is enabled, so the
+			// change can be recorded.
+			entry, err := a.collections.beginAudit(event, job, "update", update.Collection, collection, update.Document)
+			if err != nil {
+				then <- destination.Then{
+					Jobs:  []string{job.ID},
+					Error: err,
+				}
+
+				continue
+			}
+
+			// Update the document in the docstore. The policy of the job is
+			// applied if the document does not exist.
+			a.env.normalizeRevision(update.Document)
+			err = collection.Update(a.ctx, update.Document, mods)
+			if err == nil {
+				a.collections.commitAudit(tk, entry, collection, update.Document)
+			}
+
+			then <- thenWithPolicy(job.ID, err, gcerrors.NotFound, update.IfMissing)
+		}
+	}
+}
+
+/*
+mods returns the modifications to apply to the document. Since the amounts of
+the increments are unmarshaled as floating-point numbers, integral amounts are
+converted back to integers so integer fields keep their type.
+*/
+func (a Update) mods() (docstore.Mods, error) {
+	mods := docstore.Mods{}
+	for field, value := range a.Set {
+		mods[docstore.FieldPath(field)] = value
+	}
+
+	for field, value := range a.Increment {
+		amount, ok := value.(float64)
+		if !ok {
+			return nil, &errors.Error{
+				Message: fmt.Sprintf("docstore: Increment of field '%s' must be a number", field),
+			}
+		}
+
+		if amount == math.Trunc(amount) {
+			mods[docstore.FieldPath(field)] = docstore.Increment(int64(amount))
+		} else {
+			mods[docstore.FieldPath(field)] = docstore.Increment(amount)
+		}
+	}
+
+	for _, field := range a.Unset {
+		mods[docstore.FieldPath(field)] = nil
+	}
+
+	if len(mods) == 0 {
+		return nil, &errors.Error{
+			Message: "docstore: At least one modification must be set",
+		}
+	}
+
+	return mods, nil
+}
@@ -0,0 +1,92 @@
+package docstoredestination
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/destination"
+)
+
+var _ destination.Action = Update{}
+
+func TestUpdate_Load(t *testing.T) {
+	tests := []struct {
+		name        string
+		existing    bool
+		data        []byte
+		wantErr     bool
+		wantDiscard bool
+		want        map[string]interface{}
+	}{
+		{
+			name:     "WithMods",
+			existing: true,
+			data:     []byte(`{"document":{"id":"user-1"},"set":{"plan":"premium"},"increment":{"logins":2},"unset":["trial"]}`),
+			wantErr:  false,
+			want: map[string]interface{}{
+				"id":     "user-1",
+				"plan":   "premium",
+				"logins": int64(3),
+			},
+		},
+		{
+			name:        "WithNoMods",
+			existing:    true,
+			data:        []byte(`{"document":{"id":"user-1"}}`),
+			wantErr:     true,
+			wantDiscard: true,
+		},
+		{
+			name:        "WithInvalidIncrement",
+			existing:    true,
+			data:        []byte(`{"document":{"id":"user-1"},"increment":{"logins":"one"}}`),
+			wantErr:     true,
+			wantDiscard: true,
+		},
+		{
+			name:        "WithMissingDocument",
+			existing:    false,
+			data:        []byte(`{"document":{"id":"user-1"},"set":{"plan":"premium"}}`),
+			wantErr:     true,
+			wantDiscard: true,
+		},
+		{
+			name:     "WithMissingDocumentAndSucceedPolicy",
+			existing: false,
+			data:     []byte(`{"document":{"id":"user-1"},"set":{"plan":"premium"},"if_missing":"succeed"}`),
+			wantErr:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			d := newMemory(t, &Options{})
+			if tt.existing {
+				defaultCollection(t, d).Put(ctx, map[string]interface{}{"id": "user-1", "plan": "free", "logins": int64(1), "trial": true})
+			}
+
+			got := load(d.Actions()["update"], tt.data)
+			if (got.Error != nil) != tt.wantErr {
+				t.Fatalf("Update.Load() error = %v, wantErr %v", got.Error, tt.wantErr)
+			}
+			if got.ForceDiscard != tt.wantDiscard {
+				t.Errorf("Update.Load() discard = %v, want %v", got.ForceDiscard, tt.wantDiscard)
+			}
+			if tt.want == nil {
+				return
+			}
+
+			doc := map[string]interface{}{"id": "user-1"}
+			defaultCollection(t, d).Get(ctx, doc)
+			delete(doc, "DocstoreRevision")
+			if len(doc) != len(tt.want) {
+				t.Fatalf("Collection.Get() = %v, want %v", doc, tt.want)
+			}
+			for k, v := range tt.want {
+				if doc[k] != v {
+					t.Errorf("Collection.Get() %s = %v (%T), want %v (%T)", k, doc[k], doc[k], v, v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package docstoredestination
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/destination"
+
+	"gocloud.dev/docstore"
+	"gocloud.dev/gcerrors"
+)
+
+/*
+auditEntry is the history entry of a change made by a job, written into the
+audit collection once the change has succeeded.
+*/
+type auditEntry struct {
+	jobID      string
+	eventID    string
+	source     string
+	trigger    string
+	context    interface{}
+	action     string
+	collection string
+	key        map[string]interface{}
+	before     map[string]interface{}
+}
+
+/*
+beginAudit reads the state of a document before a job changes it, if the audit
+is enabled. It returns nil otherwise.
+*/
+func (c *collections) beginAudit(event *store.Event, job *store.Job, action string, name string, collection *docstore.Collection, document map[string]interface{}) (*auditEntry, error) {
+	if c.env.AuditCollection == "" {
+		return nil, nil
+	}
+
+	if name == "" {
+		name = c.env.defaultCollection()
+	}
+
+	entry := &auditEntry{
+		jobID:      job.ID,
+		eventID:    event.ID,
+		source:     event.Source,
+		trigger:    event.Trigger,
+		context:    auditContext(event, job),
+		action:     action,
+		collection: name,
+		key:        map[string]interface{}{},
+	}
+
+	for _, field := range c.env.keyFields() {
+		entry.key[field] = document[field]
+	}
+
+	// A document without key, such as one created with a generated key, does
+	// not exist yet.
+	for _, value := range entry.key {
+		if isEmptyKey(value) {
+			return entry, nil
+		}
+	}
+
+	var err error
+	entry.before, err = c.current(collection, entry.key)
+	return entry, err
+}
+
+/*
+commitAudit writes the history entry of a change once it has been made. It does
+nothing if the entry is nil.
+
+The change can not be undone at this point, so failing to write the entry does
+not fail the job: retrying it would make the change again. The failure is logged
+instead.
+*/
+func (c *collections) commitAudit(tk *destination.Toolkit, entry *auditEntry, collection *docstore.Collection, document map[string]interface{}) {
+	if entry == nil {
+		return
+	}
+
+	if err := c.writeAudit(entry, collection, document); err != nil {
+		tk.Logger.Errorf("docstore(%s): Failed to audit change of job '%s': %s", c.env.Name, entry.jobID, err.Error())
+	}
+}
+
+/*
+writeAudit reads the state of a document after a job changed it, and writes the
+history entry into the audit collection. The key is read again from the document
+written since it can be generated when writing.
+
+The entry is keyed by the job ID and the revision of the document, so it is
+written only once per change. If the entry already exists, the first one is
+kept.
+*/
+func (c *collections) writeAudit(entry *auditEntry, collection *docstore.Collection, document map[string]interface{}) error {
+	for _, field := range c.env.keyFields() {
+		entry.key[field] = document[field]
+	}
+
+	after, err := c.current(collection, entry.key)
+	if err != nil {
+		return err
+	}
+
+	audit, err := c.get(c.env.AuditCollection)
+	if err != nil {
+		return err
+	}
+
+	// The revision of a deleted document is the one it had before being
+	// deleted.
+	state := after
+	if state == nil {
+		state = entry.before
+	}
+
+	revision := ""
+	if state[c.env.revisionField()] != nil {
+		revision, err = collection.RevisionToString(state[c.env.revisionField()])
+		if err != nil {
+			return err
+		}
+	}
+
+	history := c.env.auditKey(entry.jobID, revision)
+	history["job_id"] = entry.jobID
+	history["event_id"] = entry.eventID
+	history["source"] = entry.source
+	history["trigger"] = entry.trigger
+	history["context"] = entry.context
+	history["action"] = entry.action
+	history["collection"] = entry.collection
+	history["key"] = entry.key
+	history["timestamp"] = time.Now().UTC()
+	history["before"] = entry.before
+	history["after"] = after
+	history["changes"] = c.env.changes(entry.before, after)
+
+	err = audit.Create(c.ctx, history)
+	if gcerrors.Code(err) == gcerrors.AlreadyExists {
+		return nil
+	}
+
+	return err
+}
+
+/*
+current returns the document currently stored with the given key, or nil if it
+does not exist.
+*/
+func (c *collections) current(collection *docstore.Collection, key map[string]interface{}) (map[string]interface{}, error) {
+	document := map[string]interface{}{}
+	for field, value := range key {
+		document[field] = value
+	}
+
+	err := collection.Get(c.ctx, document)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return document, nil
+}
+
+/*
+auditKey returns a document holding the key of the history entry of a change.
+Every key field is set to the job ID, followed by the revision of the document
+if any, so the key is the same every time the entry of a change is written.
+*/
+func (env *Options) auditKey(jobID string, revision string) map[string]interface{} {
+	key := jobID
+	if revision != "" {
+		key = jobID + "-" + revision
+	}
+
+	document := map[string]interface{}{}
+	for _, field := range env.keyFields() {
+		document[field] = key
+	}
+
+	return document
+}
+
+/*
+changes returns the sorted list of the top-level fields which differ between the
+states of a document before and after a change. The revision field is ignored.
+*/
+func (env *Options) changes(before map[string]interface{}, after map[string]interface{}) []string {
+	fields := map[string]bool{}
+	for field := range before {
+		fields[field] = true
+	}
+
+	for field := range after {
+		fields[field] = true
+	}
+
+	changes := []string{}
+	for field := range fields {
+		if field == env.revisionField() {
+			continue
+		}
+
+		if !reflect.DeepEqual(before[field], after[field]) {
+			changes = append(changes, field)
+		}
+	}
+
+	sort.Strings(changes)
+	return changes
+}
+
+/*
+auditContext returns the context of the job, or the one of its event if not set,
+so the history entry records who made the change.
+*/
+func auditContext(event *store.Event, job *store.Job) interface{} {
+	for _, data := range [][]byte{job.Context, event.Context} {
+		var context interface{}
+		if len(data) > 0 && json.Unmarshal(data, &context) == nil && context != nil {
+			return context
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package docstoredestination
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/destination"
+	"github.com/nunchistudio/blacksmith/helper/logger"
+)
+
+/*
+loadJob runs the action against a queue containing a single job with the given
+ID and data, and returns the result sent by the action.
+*/
+func loadJob(a destination.Action, jobID string, data []byte) destination.Then {
+	queue := &store.Queue{
+		Events: []*store.Event{
+			{
+				ID:      "event-" + jobID,
+				Source:  "crm",
+				Trigger: "customer-updated",
+				Context: []byte(`{"user":"admin@example.com"}`),
+				Jobs: []*store.Job{
+					{
+						ID:   jobID,
+						Data: data,
+					},
+				},
+			},
+		},
+	}
+
+	then := make(chan destination.Then, 1)
+	a.Load(&destination.Toolkit{
+		Logger: logger.Default,
+	}, queue, then)
+
+	return <-then
+}
+
+func TestDocstore_LoadAudit(t *testing.T) {
+	ctx := context.Background()
+	d := newMemory(t, &Options{
+		AuditCollection: "history",
+	})
+
+	steps := []struct {
+		jobID       string
+		action      string
+		data        string
+		wantBefore  map[string]interface{}
+		wantAfter   map[string]interface{}
+		wantChanges []string
+	}{
+		{
+			jobID:       "job-1",
+			action:      "put",
+			data:        `{"document":{"id":"customer-1","plan":"free"}}`,
+			wantBefore:  nil,
+			wantAfter:   map[string]interface{}{"id": "customer-1", "plan": "free"},
+			wantChanges: []string{"id", "plan"},
+		},
+		{
+			jobID:       "job-2",
+			action:      "update",
+			data:        `{"document":{"id":"customer-1"},"set":{"plan":"premium","seats":5}}`,
+			wantBefore:  map[string]interface{}{"id": "customer-1", "plan": "free"},
+			wantAfter:   map[string]interface{}{"id": "customer-1", "plan": "premium", "seats": float64(5)},
+			wantChanges: []string{"plan", "seats"},
+		},
+		{
+			jobID:       "job-3",
+			action:      "delete",
+			data:        `{"document":{"id":"customer-1"}}`,
+			wantBefore:  map[string]interface{}{"id": "customer-1", "plan": "premium", "seats": float64(5)},
+			wantAfter:   nil,
+			wantChanges: []string{"id", "plan", "seats"},
+		},
+	}
+	for _, step := range steps {
+		t.Run(step.jobID, func(t *testing.T) {
+			got := loadJob(d.Actions()[step.action], step.jobID, []byte(step.data))
+			if got.Error != nil {
+				t.Fatalf("Load() error = %v", got.Error)
+			}
+
+			audit, _ := d.collections.get("history")
+			entry := map[string]interface{}{"id": step.jobID}
+			if err := audit.Get(ctx, entry); err != nil {
+				t.Fatalf("Collection.Get() error = %v", err)
+			}
+
+			before, _ := entry["before"].(map[string]interface{})
+			after, _ := entry["after"].(map[string]interface{})
+			if !reflect.DeepEqual(before, step.wantBefore) || !reflect.DeepEqual(after, step.wantAfter) {
+				t.Errorf("audit before = %v, after = %v, want %v and %v", before, after, step.wantBefore, step.wantAfter)
+			}
+
+			changes := []string{}
+			for _, field := range entry["changes"].([]interface{}) {
+				changes = append(changes, field.(string))
+			}
+
+			if !reflect.DeepEqual(changes, step.wantChanges) {
+				t.Errorf("audit changes = %v, want %v", changes, step.wantChanges)
+			}
+
+			if entry["event_id"] != "event-"+step.jobID || entry["action"] != step.action || entry["collection"] != "fakecollection" {
+				t.Errorf("audit entry = %v", entry)
+			}
+
+			if !reflect.DeepEqual(entry["context"], map[string]interface{}{"user": "admin@example.com"}) {
+				t.Errorf("audit context = %v", entry["context"])
+			}
+		})
+	}
+}
+
+func TestDocstore_LoadAuditRetried(t *testing.T) {
+	ctx := context.Background()
+	d := newMemory(t, &Options{
+		AuditCollection: "history",
+	})
+
+	defaultCollection(t, d).Put(ctx, map[string]interface{}{"id": "customer-1", "plan": "free"})
+
+	// The job is loaded twice, as if it was retried after the change succeeded.
+	// The document has no revision so the entry of the first change is kept.
+	for i := 0; i < 2; i++ {
+		got := loadJob(d.Actions()["put"], "job-1", []byte(`{"document":{"id":"customer-1","plan":"premium"}}`))
+		if got.Error != nil {
+			t.Fatalf("Put.Load() error = %v", got.Error)
+		}
+	}
+
+	audit, _ := d.collections.get("history")
+	entry := map[string]interface{}{"id": "job-1"}
+	audit.Get(ctx, entry)
+
+	before, _ := entry["before"].(map[string]interface{})
+	if before["plan"] != "free" {
+		t.Errorf("audit before = %v, want plan free", before)
+	}
+}
+
+func TestDocstore_LoadAuditRevisions(t *testing.T) {
+	ctx := context.Background()
+	d := newMemory(t, &Options{
+		AuditCollection: "history",
+	})
+
+	defaultCollection(t, d).Put(ctx, map[string]interface{}{"id": "customer-1", "plan": "free", "DocstoreRevision": nil})
+
+	// The job is loaded twice, as if it was retried after the change succeeded.
+	// Each change gives a new revision, so each one has its own entry.
+	for i := 0; i < 2; i++ {
+		got := loadJob(d.Actions()["put"], "job-1", []byte(`{"document":{"id":"customer-1","plan":"premium","DocstoreRevision":null}}`))
+		if got.Error != nil {
+			t.Fatalf("Put.Load() error = %v", got.Error)
+		}
+	}
+
+	audit, _ := d.collections.get("history")
+	iter := audit.Query().Where("job_id", "=", "job-1").Get(ctx)
+	defer iter.Stop()
+
+	plans := map[interface{}]bool{}
+	for {
+		entry := map[string]interface{}{}
+		if err := iter.Next(ctx, entry); err != nil {
+			break
+		}
+
+		if !strings.HasPrefix(entry["id"].(string), "job-1-") {
+			t.Errorf("audit key = %v, want job ID and revision", entry["id"])
+		}
+
+		before, _ := entry["before"].(map[string]interface{})
+		plans[before["plan"]] = true
+	}
+
+	if !reflect.DeepEqual(plans, map[interface{}]bool{"free": true, "premium": true}) {
+		t.Errorf("audit before plans = %v, want free and premium", plans)
+	}
+}
+
+func TestDocstore_LoadAuditFailure(t *testing.T) {
+	ctx := context.Background()
+	d := newMemory(t, &Options{
+		AuditCollection: "history",
+	})
+
+	// Close the audit collection so writing the history entry fails.
+	audit, _ := d.collections.get("history")
+	audit.Close()
+
+	got := loadJob(d.Actions()["put"], "job-1", []byte(`{"document":{"id":"customer-1","plan":"premium"}}`))
+	if got.Error != nil {
+		t.Fatalf("Put.Load() error = %v, want nil since the change has been made", got.Error)
+	}
+
+	doc := map[string]interface{}{"id": "customer-1"}
+	if err := defaultCollection(t, d).Get(ctx, doc); err != nil || doc["plan"] != "premium" {
+		t.Errorf("Collection.Get() = %v, %v, want document written", doc, err)
+	}
+}
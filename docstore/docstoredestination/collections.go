@@ -0,0 +1,233 @@
+package docstoredestination
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/nunchistudio/blacksmith/destination"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"gocloud.dev/docstore"
+	"gocloud.dev/docstore/memdocstore"
+)
+
+/*
+collections opens and caches the collections of a destination. Collections are
+opened lazily the first time they are needed. Collections opened from a URL
+share the same client, created once by the driver. PostgreSQL collections share
+the same connection pool, opened with the first collection.
+*/
+type collections struct {
+	env    *Options
+	ctx    context.Context
+	mutex  sync.Mutex
+	opened map[string]*docstore.Collection
+	db     *sql.DB
+}
+
+/*
+newCollections returns an empty cache of collections.
+*/
+func newCollections(ctx context.Context, env *Options) *collections {
+	return &collections{
+		env:    env,
+		ctx:    ctx,
+		opened: map[string]*docstore.Collection{},
+	}
+}
+
+/*
+get returns the collection with the given name, opening it if necessary. An
+empty name is the collection set in the connection string.
+*/
+func (c *collections) get(name string) (*docstore.Collection, error) {
+	if name == "" {
+		name = c.env.defaultCollection()
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if collection, exists := c.opened[name]; exists {
+		return collection, nil
+	}
+
+	collection, err := c.open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.opened[name] = collection
+	return collection, nil
+}
+
+/*
+open opens the collection with the given name given the driver and the params
+passed by the user.
+*/
+func (c *collections) open(name string) (*docstore.Collection, error) {
+	url := c.env.connection(name) + "?" + c.env.driverParams().Encode()
+	switch c.env.Driver {
+	case DriverAWSDynamoDB:
+		return docstore.OpenCollection(c.ctx, "dynamodb://"+url)
+	case DriverAzureCosmosDB:
+		return docstore.OpenCollection(c.ctx, "mongo://"+url)
+	case DriverGoogleFirestore:
+		return docstore.OpenCollection(c.ctx, "firestore://"+url)
+	case DriverMongoDB:
+		return docstore.OpenCollection(c.ctx, "mongo://"+url)
+	case DriverMemory:
+		return memdocstore.OpenCollection(c.env.Params.Get("id_field"), &memdocstore.Options{
+			Filename:      c.env.filename(name),
+			RevisionField: c.env.Params.Get("revision_field"),
+		})
+	case DriverPostgres:
+		if c.db == nil {
+			db, err := sql.Open("postgres", os.Getenv("POSTGRES_URL"))
+			if err != nil {
+				return nil, err
+			}
+
+			c.db = db
+		}
+
+		return openPostgresCollection(c.ctx, c.db, c.env, name)
+	}
+
+	return nil, fmt.Errorf("Driver not supported")
+}
+
+/*
+forJob returns the collection a job shall be loaded into. If the collection is
+not allowed, the job is discarded since retrying it would not help. If the
+collection can not be opened, the job can be retried.
+*/
+func (c *collections) forJob(jobID string, action string, name string) (*docstore.Collection, *destination.Then) {
+	if validations := c.env.allowCollection(action, name); len(validations) > 0 {
+		return nil, &destination.Then{
+			Jobs: []string{jobID},
+			Error: &errors.Error{
+				Message:     "docstore: Collection not allowed",
+				Validations: validations,
+			},
+			ForceDiscard: true,
+		}
+	}
+
+	collection, err := c.get(name)
+	if err != nil {
+		return nil, &destination.Then{
+			Jobs:  []string{jobID},
+			Error: err,
+		}
+	}
+
+	return collection, nil
+}
+
+/*
+close closes every collection opened.
+*/
+func (c *collections) close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var err error
+	for name, collection := range c.opened {
+		if e := collection.Close(); e != nil && err == nil {
+			err = e
+		}
+
+		delete(c.opened, name)
+	}
+
+	if c.db != nil {
+		if e := c.db.Close(); e != nil && err == nil {
+			err = e
+		}
+
+		c.db = nil
+	}
+
+	return err
+}
+
+/*
+defaultCollection returns the name of the collection set in the connection
+string, which is always its last segment.
+*/
+func (env *Options) defaultCollection() string {
+	segments := strings.Split(env.Connection, "/")
+	return segments[len(segments)-1]
+}
+
+/*
+connection returns the connection string of the collection with the given name,
+by replacing the collection of the connection string.
+*/
+func (env *Options) connection(name string) string {
+	segments := strings.Split(env.Connection, "/")
+	segments[len(segments)-1] = name
+	return strings.Join(segments, "/")
+}
+
+/*
+filename returns the file to persist an in-memory collection into, if any. The
+collection set in the connection string uses the file as is, while the others
+use a file next to it suffixed with their name.
+*/
+func (env *Options) filename(name string) string {
+	filename := env.Params.Get("filename")
+	if filename == "" || name == env.defaultCollection() {
+		return filename
+	}
+
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + "." + name + ext
+}
+
+/*
+driverParams returns the params to pass to the driver when opening a collection.
+The params only used by the destination are removed, since some drivers do not
+allow unknown params.
+*/
+func (env *Options) driverParams() url.Values {
+	params := url.Values{}
+	for key, values := range env.Params {
+		if key != "ttl_field" {
+			params[key] = values
+		}
+	}
+
+	return params
+}
+
+/*
+allowCollection ensures a collection can be used by the destination. The
+collection set in the connection string is always allowed.
+*/
+func (env *Options) allowCollection(action string, name string) []errors.Validation {
+	validations := []errors.Validation{}
+	if name == "" || name == env.defaultCollection() {
+		return validations
+	}
+
+	for _, allowed := range env.Collections {
+		if allowed == name {
+			return validations
+		}
+	}
+
+	validations = append(validations, errors.Validation{
+		Message: fmt.Sprintf("Collection '%s' is not allowed", name),
+		Path:    []string{action, "Collection"},
+	})
+
+	return validations
+}
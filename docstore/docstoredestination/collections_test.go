@@ -0,0 +1,198 @@
+package docstoredestination
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/destination"
+	"github.com/nunchistudio/blacksmith/helper/logger"
+
+	"gocloud.dev/docstore"
+)
+
+func TestOptions_connection(t *testing.T) {
+	tests := []struct {
+		name       string
+		connection string
+		collection string
+		want       string
+	}{
+		{
+			name:       "WithAWSDynamoDB",
+			connection: "users",
+			collection: "orders",
+			want:       "orders",
+		},
+		{
+			name:       "WithMongoDB",
+			connection: "mydb/users",
+			collection: "orders",
+			want:       "mydb/orders",
+		},
+		{
+			name:       "WithGoogleFirestore",
+			connection: "projects/myproject/databases/(default)/documents/users",
+			collection: "orders",
+			want:       "projects/myproject/databases/(default)/documents/orders",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &Options{
+				Connection: tt.connection,
+			}
+
+			if got := env.defaultCollection(); got != "users" {
+				t.Errorf("Options.defaultCollection() = %v, want %v", got, "users")
+			}
+			if got := env.connection(tt.collection); got != tt.want {
+				t.Errorf("Options.connection() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollections_get(t *testing.T) {
+	d := newMemory(t, &Options{
+		Collections: []string{"orders"},
+	})
+
+	first, err := d.collections.get("orders")
+	if err != nil {
+		t.Fatalf("collections.get() error = %v", err)
+	}
+
+	second, _ := d.collections.get("orders")
+	if first != second {
+		t.Errorf("collections.get() opened the collection twice")
+	}
+
+	def, _ := d.collections.get("")
+	if def != defaultCollection(t, d) || def == first {
+		t.Errorf("collections.get() did not return the default collection")
+	}
+}
+
+func TestPut_LoadCollection(t *testing.T) {
+	tests := []struct {
+		name        string
+		batch       bool
+		collection  string
+		wantErr     bool
+		wantDiscard bool
+	}{
+		{
+			name:       "WithDefaultCollection",
+			collection: "",
+			wantErr:    false,
+		},
+		{
+			name:       "WithAllowedCollection",
+			collection: "orders",
+			wantErr:    false,
+		},
+		{
+			name:       "WithAllowedCollectionInBatch",
+			batch:      true,
+			collection: "orders",
+			wantErr:    false,
+		},
+		{
+			name:        "WithForbiddenCollection",
+			collection:  "secrets",
+			wantErr:     true,
+			wantDiscard: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			d := newMemory(t, &Options{
+				Batch:       tt.batch,
+				Collections: []string{"orders"},
+			})
+
+			data := []byte(fmt.Sprintf(`{"document":{"id":"doc-1"},"collection":"%s"}`, tt.collection))
+			got := load(d.Actions()["put"], data)
+			if (got.Error != nil) != tt.wantErr {
+				t.Fatalf("Put.Load() error = %v, wantErr %v", got.Error, tt.wantErr)
+			}
+			if got.ForceDiscard != tt.wantDiscard {
+				t.Errorf("Put.Load() discard = %v, want %v", got.ForceDiscard, tt.wantDiscard)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			collection, _ := d.collections.get(tt.collection)
+			if err := collection.Get(ctx, map[string]interface{}{"id": "doc-1"}); err != nil {
+				t.Errorf("Collection.Get() error = %v", err)
+			}
+			if tt.collection != "" {
+				if err := defaultCollection(t, d).Get(ctx, map[string]interface{}{"id": "doc-1"}); err == nil {
+					t.Errorf("Collection.Get() document found in the default collection")
+				}
+			}
+		})
+	}
+}
+
+func TestPut_LoadBatchCollections(t *testing.T) {
+	ctx := context.Background()
+	d := newMemory(t, &Options{
+		Batch:       true,
+		Collections: []string{"orders"},
+	})
+
+	event := &store.Event{
+		ID: "event",
+	}
+
+	for i, collection := range []string{"", "orders", "", "orders"} {
+		event.Jobs = append(event.Jobs, &store.Job{
+			ID:   fmt.Sprintf("job-%d", i),
+			Data: []byte(fmt.Sprintf(`{"document":{"id":"doc-%d"},"collection":"%s"}`, i, collection)),
+		})
+	}
+
+	then := make(chan destination.Then, len(event.Jobs))
+	d.Actions()["put"].Load(&destination.Toolkit{
+		Logger: logger.Default,
+	}, &store.Queue{
+		Events: []*store.Event{event},
+	}, then)
+	close(then)
+
+	for result := range then {
+		if result.Error != nil {
+			t.Errorf("Put.Load() error = %v", result.Error)
+		}
+	}
+
+	orders, _ := d.collections.get("orders")
+	for i, collection := range []*docstore.Collection{defaultCollection(t, d), orders, defaultCollection(t, d), orders} {
+		doc := map[string]interface{}{"id": fmt.Sprintf("doc-%d", i)}
+		if err := collection.Get(ctx, doc); err != nil {
+			t.Errorf("Collection.Get() doc-%d error = %v", i, err)
+		}
+	}
+}
+
+func TestPut_MarshalCollection(t *testing.T) {
+	newOptions(t, &Options{
+		Driver:      DriverMemory,
+		Connection:  "users",
+		Collections: []string{"orders"},
+		Params:      url.Values{"id_field": {"id"}},
+	})
+
+	if _, err := (Put{Collection: "orders", Document: map[string]interface{}{"id": "order-1"}}).Marshal(&destination.Toolkit{}); err != nil {
+		t.Errorf("Put.Marshal() error = %v", err)
+	}
+	if _, err := (Put{Collection: "secrets", Document: map[string]interface{}{"id": "order-1"}}).Marshal(&destination.Toolkit{}); err == nil {
+		t.Errorf("Put.Marshal() error = nil, want error")
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"github.com/nunchistudio/blacksmith/helper/errors"
 	"github.com/nunchistudio/blacksmith/helper/logger"
 
-	"gocloud.dev/docstore"
 	_ "gocloud.dev/docstore/awsdynamodb"
 	_ "gocloud.dev/docstore/gcpfirestore"
 	_ "gocloud.dev/docstore/mongodocstore"
@@ -19,10 +18,10 @@ Docstore implements the Blacksmith destination.Destination interface for working
 with NoSQL document stores.
 */
 type Docstore struct {
-	options    *destination.Options
-	env        *Options
-	ctx        context.Context
-	collection *docstore.Collection
+	options     *destination.Options
+	env         *Options
+	ctx         context.Context
+	collections *collections
 }
 
 /*
@@ -34,6 +33,10 @@ func New(env *Options) destination.Destination {
 		return nil
 	}
 
+	// Keep track of the options of the destination so the actions built by
+	// users can be validated against them when marshaled.
+	register(env)
+
 	return &Docstore{
 		options: &destination.Options{
 			DefaultSchedule: &destination.Schedule{
@@ -61,44 +64,28 @@ the connection with the document store. It is called when starting the scheduler
 service.
 */
 func (d *Docstore) Init(tk *destination.Toolkit) error {
-	var err error
-	var collection *docstore.Collection
-
-	// Open the document store given the driver and the URL passed by the user.
-	url := d.env.Connection + "?" + d.env.Params.Encode()
-	switch d.env.Driver {
-	case DriverAWSDynamoDB:
-		collection, err = docstore.OpenCollection(d.ctx, "dynamodb://"+url)
-	case DriverAzureCosmosDB:
-		collection, err = docstore.OpenCollection(d.ctx, "mongo://"+url)
-	case DriverGoogleFirestore:
-		collection, err = docstore.OpenCollection(d.ctx, "firestore://"+url)
-	case DriverMongoDB:
-		collection, err = docstore.OpenCollection(d.ctx, "mongo://"+url)
-	default:
-		return &errors.Error{
-			Message: fmt.Sprintf("%s: Driver not supported", d.String()),
-		}
-	}
 
-	if err != nil {
+	// Open the collection set in the connection string so the connection with
+	// the document store is checked right away. Other collections are opened
+	// when needed.
+	d.collections = newCollections(d.ctx, d.env)
+	if _, err := d.collections.get(""); err != nil {
 		return &errors.Error{
 			Message: fmt.Sprintf("%s: %s", d.String(), err.Error()),
 		}
 	}
 
-	d.collection = collection
 	return nil
 }
 
 /*
 Shutdown is part of the destination.WithHooks interface. It allows to properly
-close the connection with the collection. It is called when shutting down the
+close the connection with the collections. It is called when shutting down the
 scheduler service.
 */
 func (d *Docstore) Shutdown(tk *destination.Toolkit) error {
-	if d.collection != nil {
-		err := d.collection.Close()
+	if d.collections != nil {
+		err := d.collections.close()
 		if err != nil {
 			return &errors.Error{
 				Message: fmt.Sprintf("%s: Failed to properly close connection with collection", d.String()),
@@ -123,9 +110,34 @@ Actions return a list of actions the destination Docstore is able to handle.
 func (d *Docstore) Actions() map[string]destination.Action {
 	return map[string]destination.Action{
 		"put": Put{
-			env:        d.env,
-			ctx:        d.ctx,
-			collection: d.collection,
+			env:         d.env,
+			ctx:         d.ctx,
+			collections: d.collections,
+		},
+		"create": Create{
+			env:         d.env,
+			ctx:         d.ctx,
+			collections: d.collections,
+		},
+		"replace": Replace{
+			env:         d.env,
+			ctx:         d.ctx,
+			collections: d.collections,
+		},
+		"update": Update{
+			env:         d.env,
+			ctx:         d.ctx,
+			collections: d.collections,
+		},
+		"delete": Delete{
+			env:         d.env,
+			ctx:         d.ctx,
+			collections: d.collections,
+		},
+		"lookup": Lookup{
+			env:         d.env,
+			ctx:         d.ctx,
+			collections: d.collections,
 		},
 	}
 }
@@ -3,17 +3,128 @@ package docstoredestination
 import (
 	"context"
 	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
+	"github.com/nunchistudio/blacksmith/adapter/store"
 	"github.com/nunchistudio/blacksmith/destination"
 	"github.com/nunchistudio/blacksmith/helper/logger"
 
 	"github.com/sirupsen/logrus"
+
+	"gocloud.dev/docstore"
 )
 
 var _ destination.Destination = &Docstore{}
 
+/*
+newMemory returns an initialized Docstore destination using the in-memory
+driver, with "id" as the primary key field.
+*/
+func newMemory(t *testing.T, env *Options) *Docstore {
+	resetRegistry(t)
+	env.Name = "fakename"
+	env.Driver = DriverMemory
+	env.Connection = "fakecollection"
+	if env.Params == nil {
+		env.Params = url.Values{}
+	}
+
+	if env.Params.Get("id_field") == "" {
+		env.Params.Set("id_field", "id")
+	}
+
+	d := New(env).(*Docstore)
+	if err := d.Init(&destination.Toolkit{}); err != nil {
+		t.Fatalf("Docstore.Init() error = %v", err)
+	}
+
+	t.Cleanup(func() {
+		d.Shutdown(&destination.Toolkit{})
+	})
+
+	return d
+}
+
+/*
+defaultCollection returns the collection set in the connection string of the
+destination.
+*/
+func defaultCollection(t *testing.T, d *Docstore) *docstore.Collection {
+	collection, err := d.collections.get("")
+	if err != nil {
+		t.Fatalf("collections.get() error = %v", err)
+	}
+
+	return collection
+}
+
+/*
+newOptions creates a destination named "fakename" with the given options, the
+same way users do, and returns the options once validated. It is the only
+destination registered, so actions built by users are validated against these
+options when marshaled.
+*/
+func newOptions(t *testing.T, env *Options) *Options {
+	resetRegistry(t)
+	env.Name = "fakename"
+	if env.Connection == "" {
+		env.Connection = "fakecollection"
+	}
+
+	New(env)
+	return env
+}
+
+/*
+setenv sets the environment variables for the duration of the test, and
+restores their previous values once the test is done.
+*/
+func setenv(t *testing.T, vars map[string]string) {
+	for key, value := range vars {
+		previous, exists := os.LookupEnv(key)
+		os.Setenv(key, value)
+
+		key := key
+		t.Cleanup(func() {
+			if exists {
+				os.Setenv(key, previous)
+			} else {
+				os.Unsetenv(key)
+			}
+		})
+	}
+}
+
+/*
+load runs the action against a queue containing a single job with the given
+data, and returns the result sent by the action.
+*/
+func load(a destination.Action, data []byte) destination.Then {
+	queue := &store.Queue{
+		Events: []*store.Event{
+			{
+				ID: "event",
+				Jobs: []*store.Job{
+					{
+						ID:   "job",
+						Data: data,
+					},
+				},
+			},
+		},
+	}
+
+	then := make(chan destination.Then, 1)
+	a.Load(&destination.Toolkit{
+		Logger: logger.Default,
+	}, queue, then)
+
+	return <-then
+}
+
 func TestNew(t *testing.T) {
 	var fatal bool
 	logger.Default.Level = logrus.PanicLevel
@@ -264,3 +375,53 @@ func TestNew(t *testing.T) {
 		})
 	}
 }
+
+func TestDocstore_InitMemory(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "collection.db")
+	env := &Options{
+		Name:       "fakename",
+		Driver:     DriverMemory,
+		Connection: "fakecollection",
+		Params: url.Values{
+			"id_field": {"id"},
+			"filename": {filename},
+		},
+	}
+
+	tk := &destination.Toolkit{}
+	d := New(env).(*Docstore)
+	if err := d.Init(tk); err != nil {
+		t.Fatalf("Docstore.Init() error = %v", err)
+	}
+
+	err := defaultCollection(t, d).Put(context.Background(), map[string]interface{}{
+		"id":   "user-1",
+		"name": "John",
+	})
+	if err != nil {
+		t.Fatalf("Collection.Put() error = %v", err)
+	}
+
+	// Shutting down the destination persists the collection into the file, so
+	// a new destination can load it back.
+	if err := d.Shutdown(tk); err != nil {
+		t.Fatalf("Docstore.Shutdown() error = %v", err)
+	}
+
+	d = New(env).(*Docstore)
+	if err := d.Init(tk); err != nil {
+		t.Fatalf("Docstore.Init() error = %v", err)
+	}
+
+	defer d.Shutdown(tk)
+	doc := map[string]interface{}{
+		"id": "user-1",
+	}
+
+	if err := defaultCollection(t, d).Get(context.Background(), doc); err != nil {
+		t.Fatalf("Collection.Get() error = %v", err)
+	}
+	if doc["name"] != "John" {
+		t.Errorf("Collection.Get() name = %v, want %v", doc["name"], "John")
+	}
+}
@@ -0,0 +1,121 @@
+package docstoredestination
+
+import (
+	"time"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+Expiry holds the options to make a document expire. The expiration time is
+written into the field set by 'ttl_field' in the params of the destination, so
+the document store deletes the document once expired given its own TTL feature:
+  - a TTL attribute for AWS DynamoDB;
+  - a TTL index for Azure CosmosDB and MongoDB;
+  - a TTL policy for Google Firestore.
+
+PostgreSQL has no TTL feature, so expired documents must be deleted by the user.
+
+Only one of TTL and At must be set.
+*/
+type Expiry struct {
+
+	// TTL is the duration after which the document expires. It is relative to
+	// the time the action is marshaled, so retrying the job does not extend the
+	// life of the document.
+	//
+	// Example: 24 * time.Hour
+	TTL time.Duration `json:"ttl,omitempty"`
+
+	// At is the time at which the document expires.
+	At *time.Time `json:"at,omitempty"`
+}
+
+/*
+validate ensures the expiry options are valid.
+*/
+func (e *Expiry) validate(action string) []errors.Validation {
+	validations := []errors.Validation{}
+
+	if (e.TTL == 0) == (e.At == nil) {
+		validations = append(validations, errors.Validation{
+			Message: "Exactly one of 'TTL' or 'At' must be set",
+			Path:    []string{action, "Expiry"},
+		})
+	}
+
+	if e.TTL < 0 {
+		validations = append(validations, errors.Validation{
+			Message: "TTL must not be negative",
+			Path:    []string{action, "Expiry", "TTL"},
+		})
+	}
+
+	return validations
+}
+
+/*
+expiresAt returns the expiration time, computing it from the given time if the
+expiry is relative.
+*/
+func (e *Expiry) expiresAt(from time.Time) time.Time {
+	if e.At != nil {
+		return *e.At
+	}
+
+	return from.Add(e.TTL)
+}
+
+/*
+absolute returns the expiry with an absolute expiration time, so it does not
+depend on the time the job is loaded.
+*/
+func (e *Expiry) absolute(from time.Time) *Expiry {
+	at := e.expiresAt(from)
+	return &Expiry{
+		At: &at,
+	}
+}
+
+/*
+validateExpiry ensures a document can expire, which requires the TTL field to be
+configured in the params of the destination.
+*/
+func (env *Options) validateExpiry(action string, expiry *Expiry) []errors.Validation {
+	validations := []errors.Validation{}
+	if expiry == nil {
+		return validations
+	}
+
+	validations = append(validations, expiry.validate(action)...)
+	if env.Params.Get("ttl_field") == "" {
+		validations = append(validations, errors.Validation{
+			Message: "'ttl_field' must be set in the params of the destination",
+			Path:    []string{action, "Expiry"},
+		})
+	}
+
+	return validations
+}
+
+/*
+expire writes the expiration time into the TTL field of the document, in the
+format expected by the driver. Relative expiries are computed from the given
+time.
+*/
+func (env *Options) expire(action string, document map[string]interface{}, expiry *Expiry, from time.Time) []errors.Validation {
+	validations := env.validateExpiry(action, expiry)
+	if expiry == nil || len(validations) > 0 {
+		return validations
+	}
+
+	at := expiry.expiresAt(from).UTC()
+	switch env.Driver {
+	case DriverAWSDynamoDB:
+		document[env.Params.Get("ttl_field")] = at.Unix()
+	default:
+		document[env.Params.Get("ttl_field")] = at
+	}
+
+	return validations
+}
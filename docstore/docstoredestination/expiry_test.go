@@ -0,0 +1,168 @@
+package docstoredestination
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/destination"
+)
+
+func TestPut_MarshalExpiry(t *testing.T) {
+	at := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		params  url.Values
+		expiry  *Expiry
+		wantErr bool
+	}{
+		{
+			name:    "WithTTL",
+			params:  url.Values{"ttl_field": {"expires_at"}},
+			expiry:  &Expiry{TTL: time.Hour},
+			wantErr: false,
+		},
+		{
+			name:    "WithAt",
+			params:  url.Values{"ttl_field": {"expires_at"}},
+			expiry:  &Expiry{At: &at},
+			wantErr: false,
+		},
+		{
+			name:    "WithTTLAndAt",
+			params:  url.Values{"ttl_field": {"expires_at"}},
+			expiry:  &Expiry{TTL: time.Hour, At: &at},
+			wantErr: true,
+		},
+		{
+			name:    "WithNegativeTTL",
+			params:  url.Values{"ttl_field": {"expires_at"}},
+			expiry:  &Expiry{TTL: -time.Hour},
+			wantErr: true,
+		},
+		{
+			name:    "WithNoTTLField",
+			params:  url.Values{},
+			expiry:  &Expiry{TTL: time.Hour},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setenv(t, map[string]string{
+				"MONGO_SERVER_URL": "mongodb://localhost:27017",
+			})
+
+			newOptions(t, &Options{
+				Driver:     DriverMongoDB,
+				Connection: "mydb/sessions",
+				Params:     tt.params,
+			})
+
+			a := Put{
+				Document: map[string]interface{}{"_id": "session-1"},
+				Expiry:   tt.expiry,
+			}
+
+			job, err := a.Marshal(&destination.Toolkit{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Put.Marshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var put Put
+			json.Unmarshal(job.Data, &put)
+			if put.Expiry.TTL != 0 || put.Expiry.At == nil {
+				t.Errorf("Put.Marshal() expiry = %+v, want absolute expiry", put.Expiry)
+			}
+		})
+	}
+}
+
+func TestOptions_expire(t *testing.T) {
+	at := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		driver Driver
+		want   interface{}
+	}{
+		{
+			name:   "WithAWSDynamoDB",
+			driver: DriverAWSDynamoDB,
+			want:   at.Unix(),
+		},
+		{
+			name:   "WithMongoDB",
+			driver: DriverMongoDB,
+			want:   at,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &Options{
+				Driver: tt.driver,
+				Params: url.Values{"ttl_field": {"expires_at"}},
+			}
+
+			document := map[string]interface{}{}
+			validations := env.expire("Put", document, &Expiry{TTL: time.Hour}, at.Add(-time.Hour))
+			if len(validations) > 0 {
+				t.Fatalf("Options.expire() validations = %v", validations)
+			}
+			if document["expires_at"] != tt.want {
+				t.Errorf("Options.expire() = %v, want %v", document["expires_at"], tt.want)
+			}
+		})
+	}
+}
+
+func TestOptions_driverParams(t *testing.T) {
+	env := &Options{
+		Params: url.Values{
+			"name_field": {"id"},
+			"ttl_field":  {"expires_at"},
+		},
+	}
+
+	params := env.driverParams()
+	if params.Get("name_field") != "id" || params.Get("ttl_field") != "" {
+		t.Errorf("Options.driverParams() = %v", params)
+	}
+}
+
+func TestUpdate_LoadExpiry(t *testing.T) {
+	ctx := context.Background()
+	d := newMemory(t, &Options{
+		Params: url.Values{
+			"ttl_field": {"expires_at"},
+		},
+	})
+
+	defaultCollection(t, d).Put(ctx, map[string]interface{}{"id": "session-1"})
+
+	got := load(d.Actions()["update"], []byte(`{"document":{"id":"session-1"},"expiry":{"at":"2021-01-01T00:00:00Z"}}`))
+	if got.Error != nil {
+		t.Fatalf("Update.Load() error = %v", got.Error)
+	}
+
+	doc := map[string]interface{}{"id": "session-1"}
+	defaultCollection(t, d).Get(ctx, doc)
+	if expiresAt, ok := doc["expires_at"].(time.Time); !ok || !expiresAt.Equal(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Collection.Get() expires_at = %v", doc["expires_at"])
+	}
+}
+
+func TestPut_LoadExpiryWithoutTTLField(t *testing.T) {
+	d := newMemory(t, &Options{})
+
+	got := load(d.Actions()["put"], []byte(`{"document":{"id":"session-1"},"expiry":{"ttl":3600000000000}}`))
+	if got.Error == nil || !got.ForceDiscard {
+		t.Errorf("Put.Load() error = %v, discard = %v, want discarded error", got.Error, got.ForceDiscard)
+	}
+}
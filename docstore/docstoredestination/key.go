@@ -0,0 +1,83 @@
+package docstoredestination
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+deriveKey sets the primary key field of a document using the key template, if
+any. The key is only derived when not already set in the document.
+*/
+func (env *Options) deriveKey(document map[string]interface{}) error {
+	fields := env.keyFields()
+	if env.keyTemplate == nil || len(fields) == 0 || document == nil || !isEmptyKey(document[fields[0]]) {
+		return nil
+	}
+
+	var key bytes.Buffer
+	if err := env.keyTemplate.Execute(&key, document); err != nil {
+		return err
+	}
+
+	document[fields[0]] = strings.TrimSpace(key.String())
+	return nil
+}
+
+/*
+keyDocument ensures the key fields of a document are set given the driver's
+params, after deriving the primary key from the key template if needed. It
+returns a validation error for every key field not set, meaning the document
+can not be written and retrying the job would not help.
+*/
+func (env *Options) keyDocument(action string, document map[string]interface{}) []errors.Validation {
+	validations := []errors.Validation{}
+
+	if err := env.deriveKey(document); err != nil {
+		validations = append(validations, errors.Validation{
+			Message: fmt.Sprintf("Failed to derive key from template: %s", err.Error()),
+			Path:    []string{action, "Document"},
+		})
+
+		return validations
+	}
+
+	for _, field := range env.keyFields() {
+		if document == nil || isEmptyKey(document[field]) {
+			validations = append(validations, errors.Validation{
+				Message: fmt.Sprintf("Key field '%s' must be set", field),
+				Path:    []string{action, "Document", field},
+			})
+		}
+	}
+
+	return validations
+}
+
+/*
+isEmptyKey indicates if the value of a key field is not set.
+*/
+func isEmptyKey(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+
+	if s, ok := value.(string); ok && strings.TrimSpace(s) == "" {
+		return true
+	}
+
+	return false
+}
+
+/*
+unkeyable returns the error to send when a document can not be keyed.
+*/
+func unkeyable(validations []errors.Validation) error {
+	return &errors.Error{
+		Message:     "docstore: Document can not be keyed",
+		Validations: validations,
+	}
+}
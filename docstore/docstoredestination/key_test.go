@@ -0,0 +1,112 @@
+package docstoredestination
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/destination"
+)
+
+func TestPut_MarshalKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      *Options
+		document map[string]interface{}
+		wantErr  bool
+		wantKey  interface{}
+	}{
+		{
+			name: "WithKey",
+			env: &Options{
+				Driver: DriverMemory,
+				Params: url.Values{"id_field": {"id"}},
+			},
+			document: map[string]interface{}{"id": "user-1"},
+			wantErr:  false,
+			wantKey:  "user-1",
+		},
+		{
+			name: "WithoutKey",
+			env: &Options{
+				Driver: DriverMemory,
+				Params: url.Values{"id_field": {"id"}},
+			},
+			document: map[string]interface{}{"email": "john@example.com"},
+			wantErr:  true,
+		},
+		{
+			name: "WithoutSortKeyForDynamoDB",
+			env: &Options{
+				Driver: DriverAWSDynamoDB,
+				Params: url.Values{"partition_key": {"tenant"}, "sort_key": {"email"}},
+			},
+			document: map[string]interface{}{"tenant": "acme"},
+			wantErr:  true,
+		},
+		{
+			name: "WithKeyTemplate",
+			env: &Options{
+				Driver:      DriverMemory,
+				KeyTemplate: "{{ .tenant }}-{{ .email }}",
+				Params:      url.Values{"id_field": {"id"}},
+			},
+			document: map[string]interface{}{"tenant": "acme", "email": "john@example.com"},
+			wantErr:  false,
+			wantKey:  "acme-john@example.com",
+		},
+		{
+			name: "WithKeyTemplateAndMissingField",
+			env: &Options{
+				Driver:      DriverMemory,
+				KeyTemplate: "{{ .tenant }}-{{ .email }}",
+				Params:      url.Values{"id_field": {"id"}},
+			},
+			document: map[string]interface{}{"tenant": "acme"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setenv(t, map[string]string{
+				"AWS_ACCESS_KEY_ID":     "fakekey",
+				"AWS_SECRET_ACCESS_KEY": "fakesecret",
+				"AWS_REGION":            "eu-west-1",
+			})
+
+			newOptions(t, tt.env)
+			a := Put{
+				Document: tt.document,
+			}
+
+			_, err := a.Marshal(&destination.Toolkit{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Put.Marshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantKey != nil && tt.document["id"] != tt.wantKey {
+				t.Errorf("Put.Marshal() key = %v, want %v", tt.document["id"], tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestPut_LoadKeyTemplate(t *testing.T) {
+	d := newMemory(t, &Options{
+		KeyTemplate: "{{ .tenant }}-{{ .email }}",
+	})
+
+	got := load(d.Actions()["put"], []byte(`{"document":{"tenant":"acme","email":"john@example.com"}}`))
+	if got.Error != nil {
+		t.Fatalf("Put.Load() error = %v", got.Error)
+	}
+
+	doc := map[string]interface{}{"id": "acme-john@example.com"}
+	if err := defaultCollection(t, d).Get(context.Background(), doc); err != nil {
+		t.Fatalf("Collection.Get() error = %v", err)
+	}
+
+	got = load(d.Actions()["put"], []byte(`{"document":{"tenant":"acme"}}`))
+	if got.Error == nil || !got.ForceDiscard {
+		t.Errorf("Put.Load() error = %v, discard = %v, want discarded error", got.Error, got.ForceDiscard)
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"sort"
 	"strings"
+	"text/template"
 
 	"github.com/nunchistudio/blacksmith/destination"
 	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
 )
 
 /*
@@ -51,6 +55,28 @@ Environment variables:
 */
 var DriverGoogleFirestore Driver = "google/firestore"
 
+/*
+DriverMemory is used to leverage an in-memory document store as the destination's
+driver. The documents can optionally be persisted into a local file when the
+destination is shut down, and loaded back when it is initialized. It is mainly
+designed for local development and testing.
+*/
+var DriverMemory Driver = "memory"
+
+/*
+DriverPostgres is used to leverage PostgreSQL as the destination's driver. The
+documents are stored as JSONB in a table with the following columns:
+  - id TEXT PRIMARY KEY, holding the value of the field set by 'id_field';
+  - document JSONB NOT NULL, holding the document;
+  - revision BIGINT NOT NULL, holding the revision of the document.
+
+Queries are not supported.
+
+Environment variables:
+  - POSTGRES_URL (required)
+*/
+var DriverPostgres Driver = "postgres"
+
 /*
 Options is the options the destination can take as an input to be configured.
 */
@@ -94,8 +120,18 @@ type Options struct {
 	// Format for AWS DynamoDB: "<table>"
 	// Format for Azure CosmosDB and MongoDB: "<db>/<collection>"
 	// Format for Google Firestore: "projects/<project>/databases/(default)/documents/<collection>"
+	// Format for in-memory: "<collection>"
+	// Format for PostgreSQL: "<table>" or "<schema>/<table>"
 	Connection string
 
+	// Collections is the list of additional collections the actions can load
+	// documents into, using their 'Collection' field. The collections are opened
+	// with the same connection string and params, except the collection name.
+	// The collection set in the connection string is always allowed.
+	//
+	// Example: []string{"users", "orders"}
+	Collections []string
+
 	// Params can be used to add specific configuration per driver.
 	//
 	// Supported fields for AWS DynamoDB:
@@ -103,18 +139,134 @@ type Options struct {
 	//     "region": {"<region>"}, // Required if environment variable 'AWS_REGION' is not set.
 	//     "partition_key": {"<key>"}, // Required. The path to the partition key of a table or an index.
 	//     "sort_key": {"<key>"}, // Optional. The path to the sort key of a table or an index.
+	//     "revision_field": {"<field>"}, // Optional. The field holding the revision of the documents.
+	//     "ttl_field": {"<field>"}, // Optional. The field holding the expiration time of the documents.
 	//   }
 	//
 	// Supported fields for Azure CosmosDB and MongoDB:
 	//   url.Values{
 	//     "id_field": {"<field>"}, // Optional. The field name to use for the "_id" field.
+	//     "revision_field": {"<field>"}, // Optional. The field holding the revision of the documents.
+	//     "ttl_field": {"<field>"}, // Optional. The field holding the expiration time of the documents.
 	//   }
 	//
 	// Supported fields for Google Firestore:
 	//   url.Values{
 	//     "name_field": {"<field>"}, // Required. The designated field for the primary key.
+	//     "revision_field": {"<field>"}, // Optional. The field holding the revision of the documents.
+	//     "ttl_field": {"<field>"}, // Optional. The field holding the expiration time of the documents.
+	//   }
+	//
+	// Supported fields for in-memory:
+	//   url.Values{
+	//     "id_field": {"<field>"}, // Required. The designated field for the primary key.
+	//     "filename": {"<path>"}, // Optional. The file to persist the collection into.
+	//     "revision_field": {"<field>"}, // Optional. The field holding the revision of the documents.
+	//     "ttl_field": {"<field>"}, // Optional. The field holding the expiration time of the documents.
+	//   }
+	//
+	// Supported fields for PostgreSQL:
+	//   url.Values{
+	//     "id_field": {"<field>"}, // Required. The designated field for the primary key.
+	//     "create_table": {"true"}, // Optional. Create the table if it does not exist.
+	//     "revision_field": {"<field>"}, // Optional. The field holding the revision of the documents.
+	//     "ttl_field": {"<field>"}, // Optional. The field holding the expiration time of the documents.
 	//   }
 	Params url.Values
+
+	// Batch indicates if the documents of a queue shall be written in batch with a
+	// single actions list instead of one-by-one. This is faster for large queues
+	// while still reporting the success or failure of each job.
+	//
+	// It is ignored when AuditCollection is set, since every change must be
+	// recorded one-by-one.
+	//
+	// Defaults to false.
+	Batch bool
+
+	// AuditCollection is the name of the collection to write the history of the
+	// changes into. When set, every document created, replaced, updated, or
+	// deleted by a job is read before and after the change, and a history entry
+	// is written with the job ID, the event ID, the event's source, trigger, and
+	// context, the time of the change, the document before and after, and the
+	// list of top-level fields changed. The collection is opened with the same
+	// connection string and params, and is keyed by job ID and revision of the
+	// document. Failing to write an entry does not fail the job since the change
+	// has already been made, and is logged instead.
+	//
+	// Example: "history"
+	AuditCollection string
+
+	// KeyTemplate is a Go template used to derive the primary key of documents
+	// not having one, using the other fields of the document. The primary key is
+	// the field set by 'partition_key' for AWS DynamoDB, 'id_field' for Azure
+	// CosmosDB, MongoDB, in-memory, and PostgreSQL, and 'name_field' for Google Firestore.
+	//
+	// Example: "{{ .tenant }}-{{ .email }}"
+	KeyTemplate string
+
+	// Schema is the JSON Schema the documents written into a collection must
+	// satisfy, by collection name. Only the collection set in the connection
+	// string and the ones set in Collections can have a schema. Documents not
+	// satisfying the schema of their collection are rejected when marshaling the
+	// actions Put, Create, and Replace, and discarded when loading them. Changes
+	// made by the action Update are not validated since only the fields to change
+	// are known, not the resulting document.
+	//
+	// Example: map[string]string{"users": `{"type": "object", "required": ["email"]}`}
+	Schema map[string]string
+
+	// OnLookup is called once documents have been read by the action Lookup. It
+	// receives the payload of the job along the data enriched with the documents,
+	// and returns the actions to run once the job has succeeded, such as a track
+	// event sent to an analytics destination.
+	OnLookup func(tk *destination.Toolkit, payload Lookup, data map[string]interface{}) []destination.Action
+
+	// EncryptFields is the list of field paths to encrypt before writing the
+	// documents. The encryption is deterministic so documents can still be
+	// looked up by an encrypted field, using Options.Encrypt. Use Options.Decrypt
+	// to decrypt the documents read. Field paths use dots to select fields of
+	// sub-documents, such as "contact.email". A path crossing an array selects
+	// the field of every element. A job is discarded if a path crosses a value
+	// that is neither a sub-document nor an array.
+	//
+	// Example: []string{"email", "contact.phone"}
+	EncryptFields []string
+
+	// HashFields is the list of field paths to hash before writing the
+	// documents. Hashed values can not be read back but can still be looked up,
+	// using Options.Hash.
+	//
+	// Example: []string{"ssn"}
+	HashFields []string
+
+	// RedactFields is the list of field paths to replace by Redacted before
+	// writing the documents.
+	//
+	// Example: []string{"password"}
+	RedactFields []string
+
+	// EncryptionKey is the key used to encrypt the fields set in EncryptFields
+	// and to hash the fields set in HashFields. It must be 16, 24, or 32 bytes
+	// long. A separate key is derived from it with HKDF-SHA256 for encrypting,
+	// deriving the nonces, and hashing. It should be loaded from a secret store
+	// or an environment variable.
+	//
+	// Required if EncryptFields or HashFields is set.
+	EncryptionKey []byte
+
+	// Merge is the function called when a document can not be written because
+	// its revision does not match the one stored, allowing to merge both
+	// documents and write the result. It is used by the actions "put" and
+	// "replace". When not set, the conflict is returned as an error and the job
+	// is retried later.
+	Merge Merge
+
+	// keyTemplate is the parsed KeyTemplate.
+	keyTemplate *template.Template
+
+	// schemas are the compiled Schema, by collection name.
+	schemas map[string]*jsonschema.Schema
 }
 
 /*
@@ -170,6 +322,69 @@ func (env *Options) validate() error {
 		})
 	}
 
+	for i, collection := range env.Collections {
+		if collection == "" || strings.Contains(collection, "/") {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: fmt.Sprintf("Collection name '%s' not valid", collection),
+				Path:    []string{"Options", "Destinations", name, "Collections", fmt.Sprintf("%d", i)},
+			})
+		}
+	}
+
+	if strings.Contains(env.AuditCollection, "/") || (env.AuditCollection != "" && env.AuditCollection == env.defaultCollection()) {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: fmt.Sprintf("Audit collection name '%s' not valid", env.AuditCollection),
+			Path:    []string{"Options", "Destinations", name, "AuditCollection"},
+		})
+	}
+
+	if env.KeyTemplate != "" {
+		tmpl, err := template.New("key").Option("missingkey=error").Parse(env.KeyTemplate)
+		if err != nil {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: fmt.Sprintf("Key template not valid: %s", err.Error()),
+				Path:    []string{"Options", "Destinations", name, "KeyTemplate"},
+			})
+		}
+
+		env.keyTemplate = tmpl
+	}
+
+	collections := []string{}
+	for collection := range env.Schema {
+		collections = append(collections, collection)
+	}
+
+	sort.Strings(collections)
+	for _, collection := range collections {
+		if collection == "" || len(env.allowCollection("Schema", collection)) > 0 {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: fmt.Sprintf("Collection '%s' is not allowed", collection),
+				Path:    []string{"Options", "Destinations", name, "Schema", collection},
+			})
+
+			continue
+		}
+
+		schema, err := compileSchema(env.Schema[collection])
+		if err != nil {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: fmt.Sprintf("Schema not valid: %s", err.Error()),
+				Path:    []string{"Options", "Destinations", name, "Schema", collection},
+			})
+
+			continue
+		}
+
+		if env.schemas == nil {
+			env.schemas = map[string]*jsonschema.Schema{}
+		}
+
+		env.schemas[collection] = schema
+	}
+
+	fail.Validations = append(fail.Validations, env.validateProtections(name)...)
+
 	switch env.Driver {
 	case DriverAWSDynamoDB:
 		fail.Validations = append(fail.Validations, env.validateDriverAWSDynamoDB(name)...)
@@ -179,6 +394,10 @@ func (env *Options) validate() error {
 		fail.Validations = append(fail.Validations, env.validateDriverGoogleFirestore(name)...)
 	case DriverMongoDB:
 		fail.Validations = append(fail.Validations, env.validateDriverMongoDB(name)...)
+	case DriverMemory:
+		fail.Validations = append(fail.Validations, env.validateDriverMemory(name)...)
+	case DriverPostgres:
+		fail.Validations = append(fail.Validations, env.validateDriverPostgres(name)...)
 	}
 
 	if len(fail.Validations) > 0 {
@@ -294,3 +513,55 @@ func (env *Options) validateDriverMongoDB(name string) []errors.Validation {
 
 	return validations
 }
+
+/*
+validateDriverMemory is part of the options' validation process and validate
+those for the in-memory driver.
+*/
+func (env *Options) validateDriverMemory(name string) []errors.Validation {
+	validations := []errors.Validation{}
+
+	// Add a validation error if the primary key field is not set.
+	if env.Params.Get("id_field") == "" {
+		validations = append(validations, errors.Validation{
+			Message: "'id_field' must be set",
+			Path:    []string{"Options", "Destinations", name, "Params"},
+		})
+	}
+
+	return validations
+}
+
+/*
+validateDriverPostgres is part of the options' validation process and validate
+those for the PostgreSQL driver.
+*/
+func (env *Options) validateDriverPostgres(name string) []errors.Validation {
+	validations := []errors.Validation{}
+
+	// Add a validation error if the PostgreSQL URL is not set.
+	if os.Getenv("POSTGRES_URL") == "" {
+		validations = append(validations, errors.Validation{
+			Message: "Environment variable 'POSTGRES_URL' not set",
+			Path:    []string{"Options", "Destinations", name},
+		})
+	}
+
+	// Add a validation error if the PostgreSQL connection string is not valid.
+	if len(strings.Split(env.Connection, "/")) > 2 {
+		validations = append(validations, errors.Validation{
+			Message: "Connection string not valid",
+			Path:    []string{"Options", "Destinations", name, "Connection"},
+		})
+	}
+
+	// Add a validation error if the primary key field is not set.
+	if env.Params.Get("id_field") == "" {
+		validations = append(validations, errors.Validation{
+			Message: "'id_field' must be set",
+			Path:    []string{"Options", "Destinations", name, "Params"},
+		})
+	}
+
+	return validations
+}
@@ -136,6 +136,160 @@ func TestOptions_validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "WithMemoryAndNoIDField",
+			fields: &Options{
+				Realtime:   false,
+				Interval:   "@every 1h",
+				MaxRetries: 10,
+				Name:       "fakename",
+				Driver:     DriverMemory,
+				Connection: "fakecollection",
+			},
+			wantErr: true,
+		},
+		{
+			name: "WithMemory",
+			fields: &Options{
+				Realtime:   false,
+				Interval:   "@every 1h",
+				MaxRetries: 10,
+				Name:       "fakename",
+				Driver:     DriverMemory,
+				Connection: "fakecollection",
+				Params: url.Values{
+					"id_field": {"id"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "WithPostgresAndNoIDField",
+			fields: &Options{
+				Realtime:   false,
+				Interval:   "@every 1h",
+				MaxRetries: 10,
+				Name:       "fakename",
+				Driver:     DriverPostgres,
+				Connection: "public/fakecollection",
+			},
+			wantErr: true,
+		},
+		{
+			name: "WithPostgresAndInvalidConnection",
+			fields: &Options{
+				Realtime:   false,
+				Interval:   "@every 1h",
+				MaxRetries: 10,
+				Name:       "fakename",
+				Driver:     DriverPostgres,
+				Connection: "mydb/public/fakecollection",
+				Params: url.Values{
+					"id_field": {"id"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "WithAuditCollectionSameAsConnection",
+			fields: &Options{
+				Realtime:        false,
+				Interval:        "@every 1h",
+				MaxRetries:      10,
+				Name:            "fakename",
+				Driver:          DriverMemory,
+				Connection:      "fakecollection",
+				AuditCollection: "fakecollection",
+				Params: url.Values{
+					"id_field": {"id"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "WithKeyTemplate",
+			fields: &Options{
+				Realtime:    false,
+				Interval:    "@every 1h",
+				MaxRetries:  10,
+				Name:        "fakename",
+				Driver:      DriverMemory,
+				Connection:  "fakecollection",
+				KeyTemplate: "{{ .tenant }}-{{ .email }}",
+				Params: url.Values{
+					"id_field": {"id"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "WithInvalidKeyTemplate",
+			fields: &Options{
+				Realtime:    false,
+				Interval:    "@every 1h",
+				MaxRetries:  10,
+				Name:        "fakename",
+				Driver:      DriverMemory,
+				Connection:  "fakecollection",
+				KeyTemplate: "{{ .tenant }",
+				Params: url.Values{
+					"id_field": {"id"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "WithInvalidSchema",
+			fields: &Options{
+				Realtime:   false,
+				Interval:   "@every 1h",
+				MaxRetries: 10,
+				Name:       "fakename",
+				Driver:     DriverMemory,
+				Connection: "fakecollection",
+				Schema: map[string]string{
+					"fakecollection": `{"type": 42}`,
+				},
+				Params: url.Values{
+					"id_field": {"id"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "WithSchemaForCollectionNotAllowed",
+			fields: &Options{
+				Realtime:   false,
+				Interval:   "@every 1h",
+				MaxRetries: 10,
+				Name:       "fakename",
+				Driver:     DriverMemory,
+				Connection: "fakecollection",
+				Schema: map[string]string{
+					"secrets": `{"type": "object"}`,
+				},
+				Params: url.Values{
+					"id_field": {"id"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "WithInvalidCollections",
+			fields: &Options{
+				Realtime:    false,
+				Interval:    "@every 1h",
+				MaxRetries:  10,
+				Name:        "fakename",
+				Driver:      DriverMemory,
+				Connection:  "fakecollection",
+				Collections: []string{"orders", "mydb/users"},
+				Params: url.Values{
+					"id_field": {"id"},
+				},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,50 @@
+package docstoredestination
+
+import (
+	"github.com/nunchistudio/blacksmith/destination"
+
+	"gocloud.dev/gcerrors"
+)
+
+/*
+Policy is a custom type allowing the user to define how a job shall be handled
+when the document it targets does not exist or already exists. Retrying such
+jobs would not help, so they are either discarded or considered as succeeded.
+*/
+type Policy string
+
+/*
+PolicyDiscard marks the job as discarded. This is the default policy.
+*/
+var PolicyDiscard Policy = "discard"
+
+/*
+PolicySucceed marks the job as succeeded, since there is nothing more to do.
+*/
+var PolicySucceed Policy = "succeed"
+
+/*
+thenWithPolicy returns the result of a job given the error returned by the
+document store. If the error has the given code, the policy is applied.
+Otherwise the error is returned as is so the job can be retried.
+*/
+func thenWithPolicy(jobID string, err error, code gcerrors.ErrorCode, policy Policy) destination.Then {
+	if err != nil && gcerrors.Code(err) == code {
+		if policy == PolicySucceed {
+			return destination.Then{
+				Jobs: []string{jobID},
+			}
+		}
+
+		return destination.Then{
+			Jobs:         []string{jobID},
+			Error:        err,
+			ForceDiscard: true,
+		}
+	}
+
+	return destination.Then{
+		Jobs:  []string{jobID},
+		Error: err,
+	}
+}
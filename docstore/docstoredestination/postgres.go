@@ -0,0 +1,545 @@
+package docstoredestination
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"gocloud.dev/docstore"
+	"gocloud.dev/docstore/driver"
+	"gocloud.dev/gcerrors"
+)
+
+/*
+pgCollection implements the gocloud driver.Collection interface for a PostgreSQL
+table. Documents are stored as JSONB in the 'document' column, keyed by the
+value of the id field in the 'id' column. The revision of a document is an
+integer incremented on every write, kept in the 'revision' column and returned
+in the revision field of the document when read.
+*/
+type pgCollection struct {
+	db       *sql.DB
+	table    string
+	idField  string
+	revField string
+}
+
+/*
+pgError is an error returned by the PostgreSQL driver along with its gocloud
+error code, so the docstore package can report it as expected.
+*/
+type pgError struct {
+	code    gcerrors.ErrorCode
+	message string
+}
+
+/*
+Error returns the message of the error.
+*/
+func (e *pgError) Error() string {
+	return "docstore/postgres: " + e.message
+}
+
+/*
+pgErrorf returns a new pgError with the given code.
+*/
+func pgErrorf(code gcerrors.ErrorCode, format string, args ...interface{}) error {
+	return &pgError{
+		code:    code,
+		message: fmt.Sprintf(format, args...),
+	}
+}
+
+/*
+pgUniqueViolation is the PostgreSQL error code returned when inserting a row
+whose primary key already exists.
+*/
+const pgUniqueViolation = "23505"
+
+/*
+openPostgresCollection returns a collection writing into the table set by the
+connection string, formatted as "<table>" or "<schema>/<table>". The table is
+created if the 'create_table' param is "true".
+*/
+func openPostgresCollection(ctx context.Context, db *sql.DB, env *Options, name string) (*docstore.Collection, error) {
+	c := &pgCollection{
+		db:       db,
+		table:    env.pgTable(name),
+		idField:  env.Params.Get("id_field"),
+		revField: env.revisionField(),
+	}
+
+	if env.Params.Get("create_table") == "true" {
+		_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+c.table+` (
+			id TEXT PRIMARY KEY,
+			document JSONB NOT NULL,
+			revision BIGINT NOT NULL
+		)`)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return docstore.NewCollection(c), nil
+}
+
+/*
+pgTable returns the quoted identifier of the table of the collection with the
+given name, to be used in SQL queries.
+*/
+func (env *Options) pgTable(name string) string {
+	identifiers := []string{}
+	for _, identifier := range strings.Split(env.connection(name), "/") {
+		identifiers = append(identifiers, pq.QuoteIdentifier(identifier))
+	}
+
+	return strings.Join(identifiers, ".")
+}
+
+/*
+Key returns the primary key of a document, which is the value of the id field.
+A nil key lets the docstore package generate one when creating the document.
+*/
+func (c *pgCollection) Key(doc driver.Document) (interface{}, error) {
+	key, _ := doc.GetField(c.idField)
+	if isEmptyKey(key) {
+		return nil, nil
+	}
+
+	return key, nil
+}
+
+/*
+RevisionField returns the name of the field holding the revision of the
+documents.
+*/
+func (c *pgCollection) RevisionField() string {
+	return c.revField
+}
+
+/*
+RunActions executes the actions one after the other, each one in its own
+statement or transaction. Errors are reported per action.
+*/
+func (c *pgCollection) RunActions(ctx context.Context, actions []*driver.Action, opts *driver.RunActionsOptions) driver.ActionListError {
+	if opts.BeforeDo != nil {
+		if err := opts.BeforeDo(func(interface{}) bool { return false }); err != nil {
+			errs := make([]error, len(actions))
+			for i := range errs {
+				errs[i] = err
+			}
+
+			return driver.NewActionListError(errs)
+		}
+	}
+
+	var alerr driver.ActionListError
+	for _, action := range actions {
+		if err := c.runAction(ctx, action); err != nil {
+			alerr = append(alerr, struct {
+				Index int
+				Err   error
+			}{action.Index, err})
+		}
+	}
+
+	return alerr
+}
+
+/*
+runAction executes a single action given its kind.
+*/
+func (c *pgCollection) runAction(ctx context.Context, action *driver.Action) error {
+	id := fmt.Sprint(action.Key)
+	switch action.Kind {
+	case driver.Get:
+		return c.get(ctx, id, action.Doc, action.FieldPaths)
+	case driver.Create:
+		if action.Key == nil {
+			action.Key = driver.UniqueString()
+			id = action.Key.(string)
+			if err := action.Doc.SetField(c.idField, id); err != nil {
+				return pgErrorf(gcerrors.InvalidArgument, "%s", err.Error())
+			}
+		}
+
+		return c.create(ctx, id, action.Doc)
+	case driver.Put:
+		return c.put(ctx, id, action.Doc)
+	case driver.Replace:
+		return c.replace(ctx, id, action.Doc)
+	case driver.Delete:
+		return c.delete(ctx, id, action.Doc)
+	case driver.Update:
+		return c.update(ctx, id, action.Doc, action.Mods)
+	}
+
+	return pgErrorf(gcerrors.Internal, "unknown action kind %v", action.Kind)
+}
+
+/*
+get reads a document, decoding only the given field paths if any. The revision
+is read from the 'revision' column and always set on the document, so documents
+written without a revision field still come back with their revision.
+*/
+func (c *pgCollection) get(ctx context.Context, id string, doc driver.Document, fps [][]string) error {
+	var data []byte
+	var revision int64
+	err := c.db.QueryRowContext(ctx, `SELECT document, revision FROM `+c.table+` WHERE id = $1`, id).Scan(&data, &revision)
+	if err == sql.ErrNoRows {
+		return pgErrorf(gcerrors.NotFound, "document %q not found", id)
+	} else if err != nil {
+		return err
+	}
+
+	stored, err := unmarshalDocument(data)
+	if err != nil {
+		return err
+	}
+
+	if err := decodeDocument(stored, doc, fps); err != nil {
+		return err
+	}
+
+	if _, isMap := doc.Origin.(map[string]interface{}); isMap || doc.HasField(c.revField) {
+		return doc.SetField(c.revField, revision)
+	}
+
+	return nil
+}
+
+/*
+create inserts a document, failing if a document with the same key exists.
+*/
+func (c *pgCollection) create(ctx context.Context, id string, doc driver.Document) error {
+	data, err := c.encode(doc, 1)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.db.ExecContext(ctx, `INSERT INTO `+c.table+` (id, document, revision) VALUES ($1, $2, 1)`, id, data)
+	if err != nil {
+		return err
+	}
+
+	return c.setRevision(doc, 1)
+}
+
+/*
+put inserts or replaces a document. A document with a revision is replaced only
+if it exists with the same revision. Otherwise, the revision is incremented by
+the database in a single statement, so concurrent puts of a new document can not
+end up with the same revision.
+*/
+func (c *pgCollection) put(ctx context.Context, id string, doc driver.Document) error {
+	if c.revision(doc) != nil {
+		return c.replace(ctx, id, doc)
+	}
+
+	data, err := c.encode(doc, 0)
+	if err != nil {
+		return err
+	}
+
+	var revision int64
+	err = c.db.QueryRowContext(ctx, `INSERT INTO `+c.table+` AS stored (id, document, revision) VALUES ($1, $2, 1)
+		ON CONFLICT (id) DO UPDATE SET document = EXCLUDED.document, revision = stored.revision + 1
+		RETURNING revision`, id, data).Scan(&revision)
+
+	if err != nil {
+		return err
+	}
+
+	return c.setRevision(doc, revision)
+}
+
+/*
+replace replaces a document, failing if it does not exist or if its revision
+does not match the one of the document passed.
+*/
+func (c *pgCollection) replace(ctx context.Context, id string, doc driver.Document) error {
+	var revision int64
+	err := c.transaction(ctx, func(tx *sql.Tx) error {
+		current, err := c.lock(ctx, tx, id, doc)
+		if err != nil {
+			return err
+		}
+
+		revision = current + 1
+		data, err := c.encode(doc, revision)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE `+c.table+` SET document = $2, revision = $3 WHERE id = $1`, id, data, revision)
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return c.setRevision(doc, revision)
+}
+
+/*
+delete deletes a document. Deleting a document not existing is not an error,
+unless a revision is passed.
+*/
+func (c *pgCollection) delete(ctx context.Context, id string, doc driver.Document) error {
+	if c.revision(doc) == nil {
+		_, err := c.db.ExecContext(ctx, `DELETE FROM `+c.table+` WHERE id = $1`, id)
+		return err
+	}
+
+	return c.transaction(ctx, func(tx *sql.Tx) error {
+		if _, err := c.lock(ctx, tx, id, doc); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, `DELETE FROM `+c.table+` WHERE id = $1`, id)
+		return err
+	})
+}
+
+/*
+update applies modifications to an existing document. All modifications are
+applied or none is.
+*/
+func (c *pgCollection) update(ctx context.Context, id string, doc driver.Document, mods []driver.Mod) error {
+	var revision int64
+	err := c.transaction(ctx, func(tx *sql.Tx) error {
+		var data []byte
+		err := tx.QueryRowContext(ctx, `SELECT document, revision FROM `+c.table+` WHERE id = $1 FOR UPDATE`, id).Scan(&data, &revision)
+		if err == sql.ErrNoRows {
+			return pgErrorf(gcerrors.NotFound, "document %q not found", id)
+		} else if err != nil {
+			return err
+		}
+
+		if err := c.checkRevision(doc, revision); err != nil {
+			return err
+		}
+
+		stored, err := unmarshalDocument(data)
+		if err != nil {
+			return err
+		}
+
+		if err := applyMods(stored, mods); err != nil {
+			return err
+		}
+
+		revision++
+		if _, exists := stored[c.revField]; exists {
+			stored[c.revField] = revision
+		}
+
+		data, err = marshalDocument(stored)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE `+c.table+` SET document = $2, revision = $3 WHERE id = $1`, id, data, revision)
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return c.setRevision(doc, revision)
+}
+
+/*
+lock locks the row of a document for the rest of the transaction and returns its
+current revision. It fails if the document does not exist or if its revision
+does not match the one of the document passed.
+*/
+func (c *pgCollection) lock(ctx context.Context, tx *sql.Tx, id string, doc driver.Document) (int64, error) {
+	var revision int64
+	err := tx.QueryRowContext(ctx, `SELECT revision FROM `+c.table+` WHERE id = $1 FOR UPDATE`, id).Scan(&revision)
+	if err == sql.ErrNoRows {
+		return 0, pgErrorf(gcerrors.NotFound, "document %q not found", id)
+	} else if err != nil {
+		return 0, err
+	}
+
+	return revision, c.checkRevision(doc, revision)
+}
+
+/*
+transaction runs the given function in a transaction, which is committed if the
+function succeeds and rolled back otherwise.
+*/
+func (c *pgCollection) transaction(ctx context.Context, fn func(*sql.Tx) error) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+/*
+encode encodes a document in JSON, setting its revision field to the given
+revision if the document has one. The revision field is left out when the
+revision is 0, meaning it is only known once written. The revision of a document
+read is always the one of the 'revision' column.
+*/
+func (c *pgCollection) encode(doc driver.Document, revision int64) ([]byte, error) {
+	stored, err := encodeDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if revision == 0 {
+		delete(stored, c.revField)
+	} else if doc.HasField(c.revField) {
+		stored[c.revField] = revision
+	}
+
+	return marshalDocument(stored)
+}
+
+/*
+revision returns the revision of a document, or nil if not set.
+*/
+func (c *pgCollection) revision(doc driver.Document) interface{} {
+	if !doc.HasField(c.revField) {
+		return nil
+	}
+
+	revision, _ := doc.GetField(c.revField)
+	return revision
+}
+
+/*
+checkRevision ensures the revision of a document, if set, matches the current
+one.
+*/
+func (c *pgCollection) checkRevision(doc driver.Document, current int64) error {
+	revision := c.revision(doc)
+	if revision == nil {
+		return nil
+	}
+
+	expected, ok := revision.(int64)
+	if !ok {
+		return pgErrorf(gcerrors.InvalidArgument, "revision field %s is not an int64", c.revField)
+	}
+
+	if expected != current {
+		return pgErrorf(gcerrors.FailedPrecondition, "mismatched revisions: want %d, current %d", expected, current)
+	}
+
+	return nil
+}
+
+/*
+setRevision sets the revision field of a document after a write, if the
+document has one.
+*/
+func (c *pgCollection) setRevision(doc driver.Document, revision int64) error {
+	if !doc.HasField(c.revField) {
+		return nil
+	}
+
+	return doc.SetField(c.revField, revision)
+}
+
+/*
+RunGetQuery is not supported by the PostgreSQL driver.
+*/
+func (c *pgCollection) RunGetQuery(ctx context.Context, q *driver.Query) (driver.DocumentIterator, error) {
+	return nil, pgErrorf(gcerrors.Unimplemented, "queries are not supported")
+}
+
+/*
+QueryPlan is not supported by the PostgreSQL driver.
+*/
+func (c *pgCollection) QueryPlan(q *driver.Query) (string, error) {
+	return "", pgErrorf(gcerrors.Unimplemented, "queries are not supported")
+}
+
+/*
+RevisionToBytes converts a revision to a byte slice.
+*/
+func (c *pgCollection) RevisionToBytes(revision interface{}) ([]byte, error) {
+	r, ok := revision.(int64)
+	if !ok {
+		return nil, pgErrorf(gcerrors.InvalidArgument, "revision %v of type %[1]T is not an int64", revision)
+	}
+
+	b := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutVarint(b, r)
+	return b[:n], nil
+}
+
+/*
+BytesToRevision converts a byte slice to a revision.
+*/
+func (c *pgCollection) BytesToRevision(b []byte) (interface{}, error) {
+	r, n := binary.Varint(b)
+	if n <= 0 || n != len(b) {
+		return nil, pgErrorf(gcerrors.InvalidArgument, "bad revision %v", b)
+	}
+
+	return r, nil
+}
+
+/*
+As exposes the underlying *sql.DB.
+*/
+func (c *pgCollection) As(i interface{}) bool {
+	p, ok := i.(**sql.DB)
+	if !ok {
+		return false
+	}
+
+	*p = c.db
+	return true
+}
+
+/*
+ErrorAs exposes the underlying *pq.Error.
+*/
+func (c *pgCollection) ErrorAs(err error, i interface{}) bool {
+	return errors.As(err, i)
+}
+
+/*
+ErrorCode returns the gocloud error code of an error.
+*/
+func (c *pgCollection) ErrorCode(err error) gcerrors.ErrorCode {
+	var pgerr *pgError
+	if errors.As(err, &pgerr) {
+		return pgerr.code
+	}
+
+	var pqerr *pq.Error
+	if errors.As(err, &pqerr) && pqerr.Code == pgUniqueViolation {
+		return gcerrors.AlreadyExists
+	}
+
+	return gcerrors.Unknown
+}
+
+/*
+Close does nothing since the connection pool is shared by every collection of
+the destination, and closed with them.
+*/
+func (c *pgCollection) Close() error {
+	return nil
+}
@@ -0,0 +1,529 @@
+package docstoredestination
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gocloud.dev/docstore/driver"
+	"gocloud.dev/gcerrors"
+)
+
+/*
+typeOfGoTime is the reflected type of time.Time, which is encoded and decoded in
+a special way.
+*/
+var typeOfGoTime = reflect.TypeOf(time.Time{})
+
+/*
+encodeDocument encodes a document as a map only holding JSON-compatible values,
+except integers kept as int64 and times kept as time.Time.
+*/
+func encodeDocument(doc driver.Document) (map[string]interface{}, error) {
+	var e pgEncoder
+	if err := doc.Encode(&e); err != nil {
+		return nil, err
+	}
+
+	return e.val.(map[string]interface{}), nil
+}
+
+/*
+encodeValue encodes a single value the same way documents are encoded.
+*/
+func encodeValue(v interface{}) (interface{}, error) {
+	var e pgEncoder
+	if err := driver.Encode(reflect.ValueOf(v), &e); err != nil {
+		return nil, err
+	}
+
+	return e.val, nil
+}
+
+/*
+marshalDocument marshals an encoded document in JSON, to be stored as JSONB.
+*/
+func marshalDocument(stored map[string]interface{}) ([]byte, error) {
+	return json.Marshal(stored)
+}
+
+/*
+unmarshalDocument unmarshals a document stored as JSONB. Numbers are decoded as
+int64 when they are integers and float64 otherwise, as expected by the decoder.
+*/
+func unmarshalDocument(data []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var stored map[string]interface{}
+	if err := decoder.Decode(&stored); err != nil {
+		return nil, err
+	}
+
+	return fromJSONNumbers(stored).(map[string]interface{}), nil
+}
+
+/*
+fromJSONNumbers converts every json.Number of a value to an int64 or a float64.
+*/
+func fromJSONNumbers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := value.Float64()
+		return f
+
+	case []interface{}:
+		for i := range value {
+			value[i] = fromJSONNumbers(value[i])
+		}
+
+	case map[string]interface{}:
+		for key := range value {
+			value[key] = fromJSONNumbers(value[key])
+		}
+	}
+
+	return v
+}
+
+/*
+decodeDocument decodes a stored document into doc. If field paths are given, only
+those fields are decoded.
+*/
+func decodeDocument(stored map[string]interface{}, doc driver.Document, fps [][]string) error {
+	if len(fps) > 0 {
+		partial := map[string]interface{}{}
+		for _, fp := range fps {
+			parent, err := parentMap(stored, fp, false)
+			if err != nil {
+				return err
+			}
+
+			if value, exists := parent[fp[len(fp)-1]]; exists {
+				p, err := parentMap(partial, fp, true)
+				if err != nil {
+					return err
+				}
+
+				p[fp[len(fp)-1]] = value
+			}
+		}
+
+		stored = partial
+	}
+
+	return doc.Decode(pgDecoder{stored})
+}
+
+/*
+applyMods applies modifications to a stored document. Every modification is
+checked before applying any of them, so the document is left untouched if one of
+them is not valid. A nil value deletes the field.
+*/
+func applyMods(stored map[string]interface{}, mods []driver.Mod) error {
+	sort.Slice(mods, func(i, j int) bool {
+		return strings.Join(mods[i].FieldPath, ".") < strings.Join(mods[j].FieldPath, ".")
+	})
+
+	type change struct {
+		parent map[string]interface{}
+		key    string
+		value  interface{}
+	}
+
+	changes := make([]change, len(mods))
+	for i, mod := range mods {
+		parent, err := parentMap(stored, mod.FieldPath, true)
+		if err != nil {
+			return err
+		}
+
+		changes[i].parent = parent
+		changes[i].key = mod.FieldPath[len(mod.FieldPath)-1]
+		if inc, ok := mod.Value.(driver.IncOp); ok {
+			amount, err := encodeValue(inc.Amount)
+			if err != nil {
+				return err
+			}
+
+			if changes[i].value, err = addNumbers(parent[changes[i].key], amount); err != nil {
+				return err
+			}
+		} else if mod.Value != nil {
+			if changes[i].value, err = encodeValue(mod.Value); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, c := range changes {
+		if c.value == nil {
+			delete(c.parent, c.key)
+		} else {
+			c.parent[c.key] = c.value
+		}
+	}
+
+	return nil
+}
+
+/*
+addNumbers adds two encoded numbers, which are either int64 or float64. Adding a
+float to an int produces a float.
+*/
+func addNumbers(x interface{}, y interface{}) (interface{}, error) {
+	if x == nil {
+		return y, nil
+	}
+
+	switch x := x.(type) {
+	case int64:
+		switch y := y.(type) {
+		case int64:
+			return x + y, nil
+		case float64:
+			return float64(x) + y, nil
+		}
+
+	case float64:
+		switch y := y.(type) {
+		case int64:
+			return x + float64(y), nil
+		case float64:
+			return x + y, nil
+		}
+
+	default:
+		return nil, pgErrorf(gcerrors.InvalidArgument, "value %v being incremented not int64 or float64", x)
+	}
+
+	return nil, pgErrorf(gcerrors.InvalidArgument, "increment amount %v not int64 or float64", y)
+}
+
+/*
+parentMap returns the map holding the last element of a field path. Missing
+intermediate maps are created if create is true, and an empty map is returned
+otherwise.
+*/
+func parentMap(m map[string]interface{}, fp []string, create bool) (map[string]interface{}, error) {
+	for _, key := range fp[:len(fp)-1] {
+		if m[key] == nil {
+			if !create {
+				return map[string]interface{}{}, nil
+			}
+
+			m[key] = map[string]interface{}{}
+		}
+
+		next, ok := m[key].(map[string]interface{})
+		if !ok {
+			return nil, pgErrorf(gcerrors.InvalidArgument, "invalid field path %q at %q", strings.Join(fp, "."), key)
+		}
+
+		m = next
+	}
+
+	return m, nil
+}
+
+/*
+pgEncoder implements the gocloud driver.Encoder interface, encoding documents as
+maps.
+*/
+type pgEncoder struct {
+	val interface{}
+}
+
+/*
+EncodeNil encodes a nil value.
+*/
+func (e *pgEncoder) EncodeNil() {
+	e.val = nil
+}
+
+/*
+EncodeBool encodes a boolean.
+*/
+func (e *pgEncoder) EncodeBool(x bool) {
+	e.val = x
+}
+
+/*
+EncodeInt encodes a signed integer as an int64.
+*/
+func (e *pgEncoder) EncodeInt(x int64) {
+	e.val = x
+}
+
+/*
+EncodeUint encodes an unsigned integer as an int64, since JSON numbers are
+decoded as int64.
+*/
+func (e *pgEncoder) EncodeUint(x uint64) {
+	e.val = int64(x)
+}
+
+/*
+EncodeBytes encodes a byte slice. It is stored as a base64 string once marshaled
+in JSON.
+*/
+func (e *pgEncoder) EncodeBytes(x []byte) {
+	e.val = x
+}
+
+/*
+EncodeFloat encodes a floating-point number.
+*/
+func (e *pgEncoder) EncodeFloat(x float64) {
+	e.val = x
+}
+
+/*
+EncodeString encodes a string.
+*/
+func (e *pgEncoder) EncodeString(x string) {
+	e.val = x
+}
+
+/*
+ListIndex is only called on the encoders returned by EncodeList.
+*/
+func (e *pgEncoder) ListIndex(int) {
+	panic("impossible")
+}
+
+/*
+MapKey is only called on the encoders returned by EncodeMap.
+*/
+func (e *pgEncoder) MapKey(string) {
+	panic("impossible")
+}
+
+/*
+EncodeSpecial encodes times as is, so they are marshaled as RFC 3339 strings. It
+returns false for every other type so they are encoded by the driver.
+*/
+func (e *pgEncoder) EncodeSpecial(v reflect.Value) (bool, error) {
+	if v.Type() == typeOfGoTime {
+		e.val = v.Interface()
+		return true, nil
+	}
+
+	return false, nil
+}
+
+/*
+EncodeList encodes a list of n elements. The returned encoder is used to encode
+every element, followed by a call to ListIndex.
+*/
+func (e *pgEncoder) EncodeList(n int) driver.Encoder {
+	s := make([]interface{}, n)
+	e.val = s
+	return &pgListEncoder{s: s}
+}
+
+/*
+EncodeMap encodes a map of n entries. The returned encoder is used to encode
+every value, followed by a call to MapKey.
+*/
+func (e *pgEncoder) EncodeMap(n int) driver.Encoder {
+	m := make(map[string]interface{}, n)
+	e.val = m
+	return &pgMapEncoder{m: m}
+}
+
+/*
+pgListEncoder encodes the elements of a list.
+*/
+type pgListEncoder struct {
+	s []interface{}
+	pgEncoder
+}
+
+/*
+ListIndex sets the last encoded value at the given index of the list.
+*/
+func (e *pgListEncoder) ListIndex(i int) {
+	e.s[i] = e.val
+}
+
+/*
+pgMapEncoder encodes the values of a map.
+*/
+type pgMapEncoder struct {
+	m map[string]interface{}
+	pgEncoder
+}
+
+/*
+MapKey sets the last encoded value at the given key of the map.
+*/
+func (e *pgMapEncoder) MapKey(k string) {
+	e.m[k] = e.val
+}
+
+/*
+pgDecoder implements the gocloud driver.Decoder interface, decoding documents
+unmarshaled from JSON. Since JSON has no type for them, bytes are decoded from
+base64 strings and times from RFC 3339 strings.
+*/
+type pgDecoder struct {
+	val interface{}
+}
+
+/*
+String returns the string representation of the value, used in error messages.
+*/
+func (d pgDecoder) String() string {
+	return fmt.Sprint(d.val)
+}
+
+/*
+AsNull reports whether the value is null.
+*/
+func (d pgDecoder) AsNull() bool {
+	return d.val == nil
+}
+
+/*
+AsBool returns the value as a boolean, if it is one.
+*/
+func (d pgDecoder) AsBool() (bool, bool) {
+	b, ok := d.val.(bool)
+	return b, ok
+}
+
+/*
+AsString returns the value as a string, if it is one.
+*/
+func (d pgDecoder) AsString() (string, bool) {
+	s, ok := d.val.(string)
+	return s, ok
+}
+
+/*
+AsInt returns the value as a signed integer, if it is an integer.
+*/
+func (d pgDecoder) AsInt() (int64, bool) {
+	i, ok := d.val.(int64)
+	return i, ok
+}
+
+/*
+AsUint returns the value as an unsigned integer, if it is an integer.
+*/
+func (d pgDecoder) AsUint() (uint64, bool) {
+	i, ok := d.val.(int64)
+	return uint64(i), ok
+}
+
+/*
+AsFloat returns the value as a floating-point number, if it is a number.
+*/
+func (d pgDecoder) AsFloat() (float64, bool) {
+	switch f := d.val.(type) {
+	case float64:
+		return f, true
+	case int64:
+		return float64(f), true
+	}
+
+	return 0, false
+}
+
+/*
+AsBytes returns the value as a byte slice, if it is one or if it is a base64
+string.
+*/
+func (d pgDecoder) AsBytes() ([]byte, bool) {
+	switch b := d.val.(type) {
+	case []byte:
+		return b, true
+	case string:
+		decoded, err := base64.StdEncoding.DecodeString(b)
+		return decoded, err == nil
+	}
+
+	return nil, false
+}
+
+/*
+AsInterface returns the value as is, to be decoded into an empty interface.
+*/
+func (d pgDecoder) AsInterface() (interface{}, error) {
+	return d.val, nil
+}
+
+/*
+ListLen returns the length of the value, if it is a list.
+*/
+func (d pgDecoder) ListLen() (int, bool) {
+	if s, ok := d.val.([]interface{}); ok {
+		return len(s), true
+	}
+
+	return 0, false
+}
+
+/*
+DecodeList calls f for every element of the list, until f returns false.
+*/
+func (d pgDecoder) DecodeList(f func(i int, d2 driver.Decoder) bool) {
+	for i, e := range d.val.([]interface{}) {
+		if !f(i, pgDecoder{e}) {
+			return
+		}
+	}
+}
+
+/*
+MapLen returns the number of entries of the value, if it is a map.
+*/
+func (d pgDecoder) MapLen() (int, bool) {
+	if m, ok := d.val.(map[string]interface{}); ok {
+		return len(m), true
+	}
+
+	return 0, false
+}
+
+/*
+DecodeMap calls f for every entry of the map, until f returns false. Keys are
+exact matches since they are the keys the document was encoded with.
+*/
+func (d pgDecoder) DecodeMap(f func(key string, d2 driver.Decoder, _ bool) bool) {
+	for k, v := range d.val.(map[string]interface{}) {
+		if !f(k, pgDecoder{v}, true) {
+			return
+		}
+	}
+}
+
+/*
+AsSpecial decodes times, either kept as is or unmarshaled as RFC 3339 strings.
+It returns false for every other type so they are decoded by the driver.
+*/
+func (d pgDecoder) AsSpecial(v reflect.Value) (bool, interface{}, error) {
+	if v.Type() != typeOfGoTime {
+		return false, nil, nil
+	}
+
+	switch t := d.val.(type) {
+	case time.Time:
+		return true, t, nil
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, t)
+		return true, parsed, err
+	}
+
+	return true, nil, fmt.Errorf("expected time, got %T", d.val)
+}
@@ -0,0 +1,585 @@
+package docstoredestination
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"gocloud.dev/docstore"
+	"gocloud.dev/docstore/driver"
+	"gocloud.dev/gcerrors"
+)
+
+func TestUnmarshalDocument(t *testing.T) {
+	got, err := unmarshalDocument([]byte(`{"id": "1", "visits": 3, "ratio": 0.5, "tags": [1, 2.5], "nested": {"count": 10}}`))
+	if err != nil {
+		t.Fatalf("unmarshalDocument() error = %v", err)
+	}
+
+	want := map[string]interface{}{
+		"id":     "1",
+		"visits": int64(3),
+		"ratio":  0.5,
+		"tags":   []interface{}{int64(1), 2.5},
+		"nested": map[string]interface{}{"count": int64(10)},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unmarshalDocument() = %#v, want %#v", got, want)
+	}
+}
+
+func TestEncodeDocument(t *testing.T) {
+	type contact struct {
+		Email string
+		Phone string
+	}
+
+	type customer struct {
+		ID       string
+		Visits   uint
+		Ratio    float64
+		Active   bool
+		Avatar   []byte
+		Tags     []string
+		Contact  contact
+		Metadata map[string]interface{}
+		JoinedAt time.Time
+	}
+
+	in := &customer{
+		ID:       "customer-1",
+		Visits:   3,
+		Ratio:    0.5,
+		Active:   true,
+		Avatar:   []byte("avatar"),
+		Tags:     []string{"premium", "gold"},
+		Contact:  contact{Email: "john@example.com"},
+		Metadata: map[string]interface{}{"source": "web", "score": 10},
+		JoinedAt: time.Date(2021, 1, 1, 12, 30, 0, 0, time.UTC),
+	}
+
+	doc, err := driver.NewDocument(in)
+	if err != nil {
+		t.Fatalf("driver.NewDocument() error = %v", err)
+	}
+
+	stored, err := encodeDocument(doc)
+	if err != nil {
+		t.Fatalf("encodeDocument() error = %v", err)
+	}
+
+	if stored["Visits"] != int64(3) || stored["JoinedAt"] != in.JoinedAt {
+		t.Errorf("encodeDocument() = %#v, want int64 and time.Time values", stored)
+	}
+
+	// Encoded documents are stored as JSONB, so they must survive a round trip
+	// in JSON before being decoded.
+	data, err := marshalDocument(stored)
+	if err != nil {
+		t.Fatalf("marshalDocument() error = %v", err)
+	}
+
+	stored, err = unmarshalDocument(data)
+	if err != nil {
+		t.Fatalf("unmarshalDocument() error = %v", err)
+	}
+
+	out := &customer{}
+	doc, _ = driver.NewDocument(out)
+	if err := decodeDocument(stored, doc, nil); err != nil {
+		t.Fatalf("decodeDocument() error = %v", err)
+	}
+
+	in.Metadata["score"] = int64(10)
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("decodeDocument() = %#v, want %#v", out, in)
+	}
+}
+
+func TestDecodeDocument(t *testing.T) {
+	stored := map[string]interface{}{
+		"id":      "customer-1",
+		"email":   "john@example.com",
+		"contact": map[string]interface{}{"phone": "0102030405", "city": "Paris"},
+	}
+
+	tests := []struct {
+		name string
+		fps  [][]string
+		want map[string]interface{}
+	}{
+		{
+			name: "WithoutFieldPaths",
+			fps:  nil,
+			want: stored,
+		},
+		{
+			name: "WithFieldPaths",
+			fps:  [][]string{{"id"}, {"contact", "phone"}},
+			want: map[string]interface{}{
+				"id":      "customer-1",
+				"contact": map[string]interface{}{"phone": "0102030405"},
+			},
+		},
+		{
+			name: "WithMissingFieldPaths",
+			fps:  [][]string{{"id"}, {"address", "zip"}},
+			want: map[string]interface{}{
+				"id": "customer-1",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]interface{}{}
+			doc, _ := driver.NewDocument(got)
+			if err := decodeDocument(stored, doc, tt.fps); err != nil {
+				t.Fatalf("decodeDocument() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeDocument() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPgDecoder_AsSpecial(t *testing.T) {
+	at := time.Date(2021, 1, 1, 12, 30, 0, 0, time.UTC)
+	v := reflect.ValueOf(time.Time{})
+
+	tests := []struct {
+		name    string
+		val     interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name: "WithTime",
+			val:  at,
+			want: at,
+		},
+		{
+			name: "WithRFC3339String",
+			val:  "2021-01-01T12:30:00Z",
+			want: at,
+		},
+		{
+			name:    "WithInvalidString",
+			val:     "yesterday",
+			wantErr: true,
+		},
+		{
+			name:    "WithNumber",
+			val:     int64(1609504200),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, got, err := pgDecoder{tt.val}.AsSpecial(v)
+			if !ok {
+				t.Fatalf("pgDecoder.AsSpecial() ok = false, want true")
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("pgDecoder.AsSpecial() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("pgDecoder.AsSpecial() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddNumbers(t *testing.T) {
+	tests := []struct {
+		name    string
+		x       interface{}
+		y       interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name: "WithMissingValue",
+			x:    nil,
+			y:    int64(2),
+			want: int64(2),
+		},
+		{
+			name: "WithInts",
+			x:    int64(3),
+			y:    int64(2),
+			want: int64(5),
+		},
+		{
+			name: "WithIntAndFloat",
+			x:    int64(3),
+			y:    0.5,
+			want: 3.5,
+		},
+		{
+			name: "WithFloatAndInt",
+			x:    0.5,
+			y:    int64(3),
+			want: 3.5,
+		},
+		{
+			name:    "WithString",
+			x:       "3",
+			y:       int64(2),
+			wantErr: true,
+		},
+		{
+			name:    "WithStringAmount",
+			x:       int64(3),
+			y:       "2",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := addNumbers(tt.x, tt.y)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("addNumbers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if code := (&pgCollection{}).ErrorCode(err); err != nil && code != gcerrors.InvalidArgument {
+				t.Errorf("addNumbers() code = %v, want %v", code, gcerrors.InvalidArgument)
+			}
+			if got != tt.want {
+				t.Errorf("addNumbers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptions_pgTable(t *testing.T) {
+	tests := []struct {
+		name       string
+		connection string
+		collection string
+		want       string
+	}{
+		{
+			name:       "WithTable",
+			connection: "users",
+			collection: "",
+			want:       `"users"`,
+		},
+		{
+			name:       "WithSchemaAndTable",
+			connection: "crm/users",
+			collection: "orders",
+			want:       `"crm"."orders"`,
+		},
+		{
+			name:       "WithQuotes",
+			connection: `crm/users"; DROP TABLE users; --`,
+			collection: "",
+			want:       `"crm"."users""; DROP TABLE users; --"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &Options{
+				Connection: tt.connection,
+			}
+
+			collection := tt.collection
+			if collection == "" {
+				collection = env.defaultCollection()
+			}
+
+			if got := env.pgTable(collection); got != tt.want {
+				t.Errorf("Options.pgTable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPgCollection_encode(t *testing.T) {
+	c := &pgCollection{
+		idField:  "id",
+		revField: "revision",
+	}
+
+	tests := []struct {
+		name     string
+		document map[string]interface{}
+		revision int64
+		want     string
+	}{
+		{
+			name:     "WithRevision",
+			document: map[string]interface{}{"id": "1", "revision": int64(1)},
+			revision: 2,
+			want:     `{"id":"1","revision":2}`,
+		},
+		{
+			name:     "WithoutRevision",
+			document: map[string]interface{}{"id": "1"},
+			revision: 2,
+			want:     `{"id":"1"}`,
+		},
+		{
+			name:     "WithUnknownRevision",
+			document: map[string]interface{}{"id": "1", "revision": nil},
+			revision: 0,
+			want:     `{"id":"1"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, _ := driver.NewDocument(tt.document)
+			got, err := c.encode(doc, tt.revision)
+			if err != nil {
+				t.Fatalf("pgCollection.encode() error = %v", err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("pgCollection.encode() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPgCollection_checkRevision(t *testing.T) {
+	c := &pgCollection{
+		revField: "revision",
+	}
+
+	tests := []struct {
+		name     string
+		document map[string]interface{}
+		want     gcerrors.ErrorCode
+	}{
+		{
+			name:     "WithoutRevision",
+			document: map[string]interface{}{"id": "1"},
+			want:     gcerrors.OK,
+		},
+		{
+			name:     "WithCurrentRevision",
+			document: map[string]interface{}{"id": "1", "revision": int64(3)},
+			want:     gcerrors.OK,
+		},
+		{
+			name:     "WithOutdatedRevision",
+			document: map[string]interface{}{"id": "1", "revision": int64(2)},
+			want:     gcerrors.FailedPrecondition,
+		},
+		{
+			name:     "WithInvalidRevision",
+			document: map[string]interface{}{"id": "1", "revision": "3"},
+			want:     gcerrors.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, _ := driver.NewDocument(tt.document)
+			got := gcerrors.OK
+			if err := c.checkRevision(doc, 3); err != nil {
+				got = c.ErrorCode(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("pgCollection.checkRevision() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyMods(t *testing.T) {
+	tests := []struct {
+		name    string
+		mods    []driver.Mod
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name: "WithSetAndDelete",
+			mods: []driver.Mod{
+				{FieldPath: []string{"name"}, Value: "Jane"},
+				{FieldPath: []string{"address", "city"}, Value: "Paris"},
+				{FieldPath: []string{"email"}, Value: nil},
+			},
+			want: map[string]interface{}{
+				"id":      "1",
+				"name":    "Jane",
+				"visits":  int64(3),
+				"address": map[string]interface{}{"city": "Paris"},
+			},
+		},
+		{
+			name: "WithIncrement",
+			mods: []driver.Mod{
+				{FieldPath: []string{"visits"}, Value: driver.IncOp{Amount: 2}},
+				{FieldPath: []string{"score"}, Value: driver.IncOp{Amount: 1.5}},
+			},
+			want: map[string]interface{}{
+				"id":     "1",
+				"name":   "John",
+				"email":  "john@example.com",
+				"visits": int64(5),
+				"score":  1.5,
+			},
+		},
+		{
+			name: "WithIncrementOnString",
+			mods: []driver.Mod{
+				{FieldPath: []string{"visits"}, Value: driver.IncOp{Amount: 2}},
+				{FieldPath: []string{"name"}, Value: driver.IncOp{Amount: 1}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := map[string]interface{}{
+				"id":     "1",
+				"name":   "John",
+				"email":  "john@example.com",
+				"visits": int64(3),
+			}
+
+			err := applyMods(stored, tt.mods)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyMods() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if stored["visits"] != int64(3) {
+					t.Errorf("applyMods() modified the document on error: %v", stored)
+				}
+
+				return
+			}
+
+			if !reflect.DeepEqual(stored, tt.want) {
+				t.Errorf("applyMods() = %#v, want %#v", stored, tt.want)
+			}
+		})
+	}
+}
+
+func TestPgCollection_revisionBytes(t *testing.T) {
+	c := &pgCollection{}
+	b, err := c.RevisionToBytes(int64(42))
+	if err != nil {
+		t.Fatalf("RevisionToBytes() error = %v", err)
+	}
+
+	revision, err := c.BytesToRevision(b)
+	if err != nil || revision != int64(42) {
+		t.Errorf("BytesToRevision() = %v, %v, want 42", revision, err)
+	}
+}
+
+/*
+TestPostgres runs the actions against a real PostgreSQL database. It is skipped
+when the environment variable 'POSTGRES_URL' is not set.
+*/
+func TestPostgres(t *testing.T) {
+	if os.Getenv("POSTGRES_URL") == "" {
+		t.Skip("Environment variable 'POSTGRES_URL' not set")
+	}
+
+	ctx := context.Background()
+	env := &Options{
+		Name:       "fakename",
+		Driver:     DriverPostgres,
+		Connection: "docstore_test",
+		Params: url.Values{
+			"id_field":     {"id"},
+			"create_table": {"true"},
+		},
+	}
+
+	if err := env.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	collections := newCollections(ctx, env)
+	defer collections.close()
+
+	collection, err := collections.get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collections.db.ExecContext(ctx, `TRUNCATE docstore_test`)
+
+	if err := collection.Create(ctx, map[string]interface{}{"id": "1", "name": "John"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	doc := map[string]interface{}{"id": "1"}
+	if err := collection.Get(ctx, doc); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	if doc["DocstoreRevision"] != int64(1) {
+		t.Errorf("Get() revision = %v, want 1", doc["DocstoreRevision"])
+	}
+
+	if err := collection.Create(ctx, map[string]interface{}{"id": "1"}); gcerrors.Code(err) != gcerrors.AlreadyExists {
+		t.Errorf("Create() error = %v, want AlreadyExists", err)
+	}
+
+	stale := map[string]interface{}{"id": "1", "name": "Jane", "DocstoreRevision": doc["DocstoreRevision"]}
+	if err := collection.Put(ctx, map[string]interface{}{"id": "1", "name": "Jack"}); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	if err := collection.Replace(ctx, stale); gcerrors.Code(err) != gcerrors.FailedPrecondition {
+		t.Errorf("Replace() error = %v, want FailedPrecondition", err)
+	}
+
+	if err := collection.Replace(ctx, map[string]interface{}{"id": "2"}); gcerrors.Code(err) != gcerrors.NotFound {
+		t.Errorf("Replace() error = %v, want NotFound", err)
+	}
+
+	if err := collection.Update(ctx, map[string]interface{}{"id": "1"}, docstore.Mods{"visits": docstore.Increment(2)}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	got := map[string]interface{}{"id": "1"}
+	if err := collection.Get(ctx, got); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	if got["name"] != "Jack" || got["visits"] != int64(2) || got["DocstoreRevision"] != int64(3) {
+		t.Errorf("Get() = %v", got)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			collection.Put(ctx, map[string]interface{}{"id": "2"})
+		}()
+	}
+
+	wg.Wait()
+	got = map[string]interface{}{"id": "2"}
+	if err := collection.Get(ctx, got); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	if got["DocstoreRevision"] != int64(2) {
+		t.Errorf("Get() revision = %v, want 2 after concurrent puts", got["DocstoreRevision"])
+	}
+
+	if err := collection.Delete(ctx, map[string]interface{}{"id": "1"}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if err := collection.Delete(ctx, map[string]interface{}{"id": "1"}); err != nil {
+		t.Errorf("Delete() error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,122 @@
+package docstoredestination
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/destination"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+write holds the document of a job as passed to prepare, along the details needed
+to validate and transform it the same way for every action.
+*/
+type write struct {
+	action     string
+	collection string
+	document   map[string]interface{}
+	expiry     *Expiry
+
+	// generatedKey indicates the document store generates the key of the
+	// document if not set, as for the action "create". The key is then derived
+	// from the key template if possible, but not required.
+	generatedKey bool
+
+	// partial indicates the document only holds the key fields of the document
+	// to change, as for the actions "update", "delete" and "lookup". It is
+	// therefore not validated against the schema of the collection, and its
+	// expiration time is written into the fields to set.
+	partial bool
+
+	// hashed indicates the hashed fields of the document are already hashed,
+	// as for documents returned by Merge. They are therefore not hashed again.
+	hashed bool
+
+	// set and increment are the modifications of the action "update".
+	set       map[string]interface{}
+	increment map[string]interface{}
+}
+
+/*
+decodeJob decodes the data of a job into the action given. The job is discarded
+if its data can not be decoded, since retrying it would not help.
+*/
+func decodeJob(job *store.Job, action interface{}) *destination.Then {
+	if err := json.Unmarshal(job.Data, action); err != nil {
+		return &destination.Then{
+			Jobs:         []string{job.ID},
+			Error:        err,
+			ForceDiscard: true,
+		}
+	}
+
+	return nil
+}
+
+/*
+prepare validates and transforms the document of a job before it is loaded:
+  - the key of the document is derived from the key template, and must be set
+    unless the document store generates it;
+  - the document must satisfy the schema of its collection, unless partial;
+  - the protected fields of the document and of the modifications are protected;
+  - the expiration time is written into the TTL field.
+
+The job is discarded if the document can not be prepared, so bad or sensitive
+data never reaches the store since retrying it would not help.
+*/
+func (env *Options) prepare(job *store.Job, w *write) *destination.Then {
+	discard := func(err error) *destination.Then {
+		return &destination.Then{
+			Jobs:         []string{job.ID},
+			Error:        err,
+			ForceDiscard: true,
+		}
+	}
+
+	if w.generatedKey {
+		if err := env.deriveKey(w.document); err != nil {
+			return discard(unkeyable([]errors.Validation{
+				{
+					Message: fmt.Sprintf("Failed to derive key from template: %s", err.Error()),
+					Path:    []string{w.action, "Document"},
+				},
+			}))
+		}
+	} else if validations := env.keyDocument(w.action, w.document); len(validations) > 0 {
+		return discard(unkeyable(validations))
+	}
+
+	if !w.partial {
+		if validations := env.validateSchema(w.action, w.collection, w.document); len(validations) > 0 {
+			return discard(invalidDocument(validations))
+		}
+	}
+
+	validations := env.protect(w.action, w.document, w.hashed)
+	validations = append(validations, env.protectSet(w.action, w.set, w.increment)...)
+	if len(validations) > 0 {
+		return discard(unprotectable(validations))
+	}
+
+	// The expiration time of a partial document is set along the other fields
+	// to set.
+	target := w.document
+	if w.partial && w.expiry != nil {
+		if w.set == nil {
+			w.set = map[string]interface{}{}
+		}
+
+		target = w.set
+	}
+
+	if validations := env.expire(w.action, target, w.expiry, job.CreatedAt); len(validations) > 0 {
+		return discard(&errors.Error{
+			Message:     "docstore: Document can not expire",
+			Validations: validations,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package docstoredestination
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+)
+
+func TestOptions_prepare(t *testing.T) {
+	tests := []struct {
+		name        string
+		write       *write
+		wantDiscard bool
+		wantSet     bool
+	}{
+		{
+			name: "WithValidDocument",
+			write: &write{
+				action:   "Put",
+				document: map[string]interface{}{"id": "user-1", "email": "john@example.com"},
+			},
+			wantDiscard: false,
+		},
+		{
+			name: "WithoutKey",
+			write: &write{
+				action:   "Put",
+				document: map[string]interface{}{"email": "john@example.com"},
+			},
+			wantDiscard: true,
+		},
+		{
+			name: "WithoutKeyAndGeneratedKey",
+			write: &write{
+				action:       "Create",
+				collection:   "orders",
+				document:     map[string]interface{}{"email": "john@example.com"},
+				generatedKey: true,
+			},
+			wantDiscard: false,
+		},
+		{
+			name: "WithInvalidDocument",
+			write: &write{
+				action:   "Replace",
+				document: map[string]interface{}{"id": "user-1"},
+			},
+			wantDiscard: true,
+		},
+		{
+			name: "WithPartialDocumentAndExpiry",
+			write: &write{
+				action:   "Update",
+				document: map[string]interface{}{"id": "user-1"},
+				expiry:   &Expiry{TTL: time.Hour},
+				partial:  true,
+			},
+			wantDiscard: false,
+			wantSet:     true,
+		},
+		{
+			name: "WithProtectedFieldIncremented",
+			write: &write{
+				action:    "Update",
+				document:  map[string]interface{}{"id": "user-1"},
+				increment: map[string]interface{}{"pin": 1.0},
+				partial:   true,
+			},
+			wantDiscard: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newOptions(t, &Options{
+				Driver: DriverMemory,
+				Schema: map[string]string{
+					"fakecollection": testSchema,
+				},
+				HashFields:    []string{"pin"},
+				EncryptionKey: testEncryptionKey,
+				Params: url.Values{
+					"id_field":  {"id"},
+					"ttl_field": {"expires_at"},
+				},
+			})
+
+			job := &store.Job{
+				ID:        "job-1",
+				CreatedAt: time.Now(),
+			}
+
+			failed := env.prepare(job, tt.write)
+			if (failed != nil) != tt.wantDiscard {
+				t.Fatalf("Options.prepare() = %+v, wantDiscard %v", failed, tt.wantDiscard)
+			}
+			if failed != nil && !failed.ForceDiscard {
+				t.Errorf("Options.prepare() discard = false, want true")
+			}
+			if _, exists := tt.write.set["expires_at"]; exists != tt.wantSet {
+				t.Errorf("Options.prepare() set = %v, want expiration time %v", tt.write.set, tt.wantSet)
+			}
+		})
+	}
+}
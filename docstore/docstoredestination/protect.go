@@ -0,0 +1,449 @@
+package docstoredestination
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+Redacted is the value replacing the fields set in 'RedactFields'.
+*/
+const Redacted = "[REDACTED]"
+
+/*
+encryptedPrefix is the prefix of encrypted values, allowing to recognize them
+when decrypting.
+*/
+const encryptedPrefix = "enc:"
+
+/*
+Info strings used to derive a key per use from the encryption key, so the same
+key is never used for different purposes.
+*/
+const (
+	keyInfoEncryption = "blacksmith/docstore encryption"
+	keyInfoNonce      = "blacksmith/docstore nonce"
+	keyInfoHash       = "blacksmith/docstore hash"
+)
+
+/*
+Encrypt encrypts a value the same way the fields set in 'EncryptFields' are
+encrypted. The encryption is deterministic: the same value always gives the
+same result given the same key. This allows to look up documents by an
+encrypted field by encrypting the value to look for.
+
+The value is encrypted with AES-GCM, using a nonce derived from the value with
+HMAC-SHA256. Both use their own key derived from the encryption key. The result
+is a string prefixed by "enc:".
+*/
+func (env *Options) Encrypt(value interface{}) (string, error) {
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := env.aead()
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, env.subkey(keyInfoNonce, sha256.Size))
+	mac.Write(plaintext)
+	nonce := mac.Sum(nil)[:aead.NonceSize()]
+
+	sealed := aead.Seal(nonce, nonce, plaintext, nil)
+	return encryptedPrefix + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+/*
+Decrypt decrypts the fields set in 'EncryptFields' of a document read from the
+collection, replacing them by their original value. Fields not encrypted are
+left untouched. Since the values are decoded from JSON, numbers are float64.
+*/
+func (env *Options) Decrypt(document map[string]interface{}) error {
+	for _, field := range env.EncryptFields {
+		_, err := transformAt(document, strings.Split(field, "."), env.decryptValue)
+		if err != nil {
+			return fmt.Errorf("docstore: Failed to decrypt field '%s': %s", field, err.Error())
+		}
+	}
+
+	return nil
+}
+
+/*
+Hash hashes a value the same way the fields set in 'HashFields' are hashed. It
+uses HMAC-SHA256 with a key derived from the encryption key, which must be set.
+Strings are hashed as is while other values are hashed from their JSON encoding.
+The result is encoded in hexadecimal.
+*/
+func (env *Options) Hash(value interface{}) (string, error) {
+	if len(env.EncryptionKey) == 0 {
+		return "", fmt.Errorf("encryption key must be set")
+	}
+
+	data, ok := value.(string)
+	if !ok {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+
+		data = string(encoded)
+	}
+
+	mac := hmac.New(sha256.New, env.subkey(keyInfoHash, sha256.Size))
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+/*
+subkey derives a key of the given length from the encryption key for the use
+described by info, with HKDF-SHA256 as defined in RFC 5869.
+*/
+func (env *Options) subkey(info string, length int) []byte {
+	extract := hmac.New(sha256.New, nil)
+	extract.Write(env.EncryptionKey)
+	prk := extract.Sum(nil)
+
+	key := []byte{}
+	block := []byte{}
+	for i := byte(1); len(key) < length; i++ {
+		expand := hmac.New(sha256.New, prk)
+		expand.Write(block)
+		expand.Write([]byte(info))
+		expand.Write([]byte{i})
+		block = expand.Sum(nil)
+		key = append(key, block...)
+	}
+
+	return key[:length]
+}
+
+/*
+aead returns the AES-GCM cipher using a key derived from the encryption key, of
+the same length.
+*/
+func (env *Options) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(env.subkey(keyInfoEncryption, len(env.EncryptionKey)))
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+/*
+encryptValue encrypts a value, returning it as a string.
+*/
+func (env *Options) encryptValue(value interface{}) (interface{}, error) {
+	return env.Encrypt(value)
+}
+
+/*
+decryptValue decrypts a value encrypted by Encrypt. Values not encrypted are
+returned as is.
+*/
+func (env *Options) decryptValue(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok || !strings.HasPrefix(s, encryptedPrefix) {
+		return value, nil
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, encryptedPrefix))
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := env.aead()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var decrypted interface{}
+	err = json.Unmarshal(plaintext, &decrypted)
+	return decrypted, err
+}
+
+/*
+hashValue hashes a value, returning it as a string.
+*/
+func (env *Options) hashValue(value interface{}) (interface{}, error) {
+	return env.Hash(value)
+}
+
+/*
+redactValue replaces a value by Redacted.
+*/
+func (env *Options) redactValue(value interface{}) (interface{}, error) {
+	return Redacted, nil
+}
+
+/*
+protection is the function to apply to a protected field.
+*/
+type protection struct {
+	path []string
+	fn   func(interface{}) (interface{}, error)
+	hash bool
+}
+
+/*
+protections returns the protections to apply, deepest fields first so a field
+is protected before its parent.
+*/
+func (env *Options) protections() []protection {
+	protections := []protection{}
+	for _, field := range env.EncryptFields {
+		protections = append(protections, protection{strings.Split(field, "."), env.encryptValue, false})
+	}
+
+	for _, field := range env.HashFields {
+		protections = append(protections, protection{strings.Split(field, "."), env.hashValue, true})
+	}
+
+	for _, field := range env.RedactFields {
+		protections = append(protections, protection{strings.Split(field, "."), env.redactValue, false})
+	}
+
+	sort.SliceStable(protections, func(i, j int) bool {
+		return len(protections[i].path) > len(protections[j].path)
+	})
+
+	return protections
+}
+
+/*
+protect encrypts, hashes, or redacts the protected fields of a document before
+it is written. Fields not present in the document are ignored. When hashed is
+true, the hashed fields are considered already hashed and are left untouched. It
+returns a validation error for every field that can not be protected.
+*/
+func (env *Options) protect(action string, document map[string]interface{}, hashed bool) []errors.Validation {
+	validations := []errors.Validation{}
+	for _, p := range env.protections() {
+		if hashed && p.hash {
+			continue
+		}
+
+		if _, err := transformAt(document, p.path, p.fn); err != nil {
+			validations = append(validations, errors.Validation{
+				Message: fmt.Sprintf("Failed to protect field: %s", err.Error()),
+				Path:    append([]string{action, "Document"}, p.path...),
+			})
+		}
+	}
+
+	return validations
+}
+
+/*
+protectValue protects a single value given the path of its field, so it can be
+compared with the values stored. Values of fields not protected are returned as
+is.
+*/
+func (env *Options) protectValue(field string, value interface{}) (interface{}, error) {
+	for _, p := range env.protections() {
+		if strings.Join(p.path, ".") == field {
+			return p.fn(value)
+		}
+	}
+
+	return value, nil
+}
+
+/*
+protectSet protects the fields of the modifications of the action "update". The
+keys of the modifications are field paths, which can either be a protected field
+or one of its parents. Fields nested in a protected field can not be set on
+their own, and protected fields can not be incremented.
+*/
+func (env *Options) protectSet(action string, set map[string]interface{}, increment map[string]interface{}) []errors.Validation {
+	validations := []errors.Validation{}
+	for _, p := range env.protections() {
+		for key, value := range set {
+			parent := strings.Split(key, ".")
+			if len(parent) > len(p.path) && hasPathPrefix(parent, p.path) {
+				validations = append(validations, errors.Validation{
+					Message: fmt.Sprintf("Field '%s' is protected and can only be set as a whole", strings.Join(p.path, ".")),
+					Path:    []string{action, "Set", key},
+				})
+
+				continue
+			}
+
+			if !hasPathPrefix(p.path, parent) {
+				continue
+			}
+
+			protected, err := transformAt(value, p.path[len(parent):], p.fn)
+			if err != nil {
+				validations = append(validations, errors.Validation{
+					Message: fmt.Sprintf("Failed to protect field: %s", err.Error()),
+					Path:    []string{action, "Set", key},
+				})
+
+				continue
+			}
+
+			set[key] = protected
+		}
+
+		for key := range increment {
+			if hasPathPrefix(p.path, strings.Split(key, ".")) || hasPathPrefix(strings.Split(key, "."), p.path) {
+				validations = append(validations, errors.Validation{
+					Message: fmt.Sprintf("Field '%s' is protected and can not be incremented", strings.Join(p.path, ".")),
+					Path:    []string{action, "Increment", key},
+				})
+			}
+		}
+	}
+
+	return validations
+}
+
+/*
+hasPathPrefix indicates if a field path starts with the given prefix.
+*/
+func hasPathPrefix(path []string, prefix []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+transformAt replaces the value at the given path within a value by the result of
+the function, and returns the value updated. Nil values and missing fields are
+left untouched. Arrays crossed by the path are walked into, so the function is
+applied to the value of every element. A path crossing any other value returns
+an error, since the field can not be found and therefore not be protected.
+*/
+func transformAt(value interface{}, path []string, fn func(interface{}) (interface{}, error)) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	if len(path) == 0 {
+		return fn(value)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		child, exists := v[path[0]]
+		if !exists {
+			return value, nil
+		}
+
+		transformed, err := transformAt(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+
+		v[path[0]] = transformed
+		return value, nil
+
+	case []interface{}:
+		for i, element := range v {
+			transformed, err := transformAt(element, path, fn)
+			if err != nil {
+				return nil, err
+			}
+
+			v[i] = transformed
+		}
+
+		return value, nil
+	}
+
+	return nil, fmt.Errorf("field '%s' is not an object or an array of objects", path[0])
+}
+
+/*
+unprotectable returns the error to send when the fields of a document can not be
+protected.
+*/
+func unprotectable(validations []errors.Validation) error {
+	return &errors.Error{
+		Message:     "docstore: Document can not be protected",
+		Validations: validations,
+	}
+}
+
+/*
+validateProtections ensures the protected fields are valid. A field can only be
+protected one way, and encrypting or hashing requires a valid AES key.
+*/
+func (env *Options) validateProtections(name string) []errors.Validation {
+	validations := []errors.Validation{}
+
+	seen := map[string]bool{}
+	options := []struct {
+		name   string
+		fields []string
+	}{
+		{"EncryptFields", env.EncryptFields},
+		{"HashFields", env.HashFields},
+		{"RedactFields", env.RedactFields},
+	}
+
+	for _, option := range options {
+		for i, field := range option.fields {
+			path := []string{"Options", "Destinations", name, option.name, fmt.Sprintf("%d", i)}
+			if field == "" || strings.HasPrefix(field, ".") || strings.HasSuffix(field, ".") || strings.Contains(field, "..") {
+				validations = append(validations, errors.Validation{
+					Message: fmt.Sprintf("Field path '%s' not valid", field),
+					Path:    path,
+				})
+			}
+
+			if seen[field] {
+				validations = append(validations, errors.Validation{
+					Message: fmt.Sprintf("Field '%s' must be protected only once", field),
+					Path:    path,
+				})
+			}
+
+			seen[field] = true
+		}
+	}
+
+	if len(env.EncryptFields) > 0 || len(env.HashFields) > 0 {
+		switch len(env.EncryptionKey) {
+		case 16, 24, 32:
+		default:
+			validations = append(validations, errors.Validation{
+				Message: "Encryption key must be 16, 24, or 32 bytes long",
+				Path:    []string{"Options", "Destinations", name, "EncryptionKey"},
+			})
+		}
+	}
+
+	return validations
+}
@@ -0,0 +1,317 @@
+package docstoredestination
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testEncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestOptions_Encrypt(t *testing.T) {
+	env := &Options{
+		EncryptFields: []string{"email", "contact.phone"},
+		EncryptionKey: testEncryptionKey,
+	}
+
+	first, err := env.Encrypt("john@example.com")
+	if err != nil {
+		t.Fatalf("Options.Encrypt() error = %v", err)
+	}
+
+	second, _ := env.Encrypt("john@example.com")
+	if first != second || !strings.HasPrefix(first, "enc:") {
+		t.Errorf("Options.Encrypt() = %q and %q, want same encrypted values", first, second)
+	}
+
+	other, _ := env.Encrypt("jane@example.com")
+	if other == first {
+		t.Errorf("Options.Encrypt() = %q for different values", other)
+	}
+
+	phone, _ := env.Encrypt("+33100000000")
+	document := map[string]interface{}{
+		"email":   first,
+		"contact": map[string]interface{}{"phone": phone},
+		"name":    "John",
+	}
+
+	if err := env.Decrypt(document); err != nil {
+		t.Fatalf("Options.Decrypt() error = %v", err)
+	}
+
+	want := map[string]interface{}{
+		"email":   "john@example.com",
+		"contact": map[string]interface{}{"phone": "+33100000000"},
+		"name":    "John",
+	}
+
+	if !reflect.DeepEqual(document, want) {
+		t.Errorf("Options.Decrypt() = %v, want %v", document, want)
+	}
+}
+
+func TestOptions_Hash(t *testing.T) {
+	env := &Options{
+		HashFields:    []string{"ssn"},
+		EncryptionKey: testEncryptionKey,
+	}
+
+	first, err := env.Hash("123-45-6789")
+	if err != nil {
+		t.Fatalf("Options.Hash() error = %v", err)
+	}
+
+	second, _ := env.Hash("123-45-6789")
+	if first != second {
+		t.Errorf("Options.Hash() = %q and %q, want same hashed values", first, second)
+	}
+
+	other, _ := (&Options{EncryptionKey: []byte("fedcba9876543210fedcba9876543210")}).Hash("123-45-6789")
+	if other == first {
+		t.Errorf("Options.Hash() = %q with different keys", other)
+	}
+
+	if _, err := (&Options{}).Hash("123-45-6789"); err == nil {
+		t.Errorf("Options.Hash() error = nil without encryption key, want error")
+	}
+}
+
+func TestOptions_subkey(t *testing.T) {
+
+	// Test case 3 of RFC 5869, with no salt and no info.
+	env := &Options{
+		EncryptionKey: bytes.Repeat([]byte{0x0b}, 22),
+	}
+
+	want := "8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8"
+	if got := hex.EncodeToString(env.subkey("", 42)); got != want {
+		t.Errorf("Options.subkey() = %s, want %s", got, want)
+	}
+
+	env = &Options{
+		EncryptionKey: testEncryptionKey,
+	}
+
+	keys := map[string]bool{
+		string(env.EncryptionKey): true,
+	}
+
+	for _, info := range []string{keyInfoEncryption, keyInfoNonce, keyInfoHash} {
+		key := string(env.subkey(info, len(env.EncryptionKey)))
+		if keys[key] {
+			t.Errorf("Options.subkey() = %x for %q, want a distinct key", key, info)
+		}
+
+		keys[key] = true
+	}
+}
+
+func TestOptions_protect(t *testing.T) {
+	env := &Options{
+		EncryptFields: []string{"email"},
+		HashFields:    []string{"contact.ssn"},
+		RedactFields:  []string{"password", "contact"},
+		EncryptionKey: testEncryptionKey,
+	}
+
+	document := map[string]interface{}{
+		"id":       "1",
+		"email":    "john@example.com",
+		"password": "secret",
+		"contact":  map[string]interface{}{"ssn": "123-45-6789"},
+		"phone":    nil,
+	}
+
+	if validations := env.protect("Put", document, false); len(validations) > 0 {
+		t.Fatalf("Options.protect() validations = %v", validations)
+	}
+
+	email, _ := env.Encrypt("john@example.com")
+	want := map[string]interface{}{
+		"id":       "1",
+		"email":    email,
+		"password": Redacted,
+		"contact":  Redacted,
+		"phone":    nil,
+	}
+
+	if !reflect.DeepEqual(document, want) {
+		t.Errorf("Options.protect() = %v, want %v", document, want)
+	}
+}
+
+func TestOptions_protectArray(t *testing.T) {
+	env := &Options{
+		EncryptFields: []string{"contacts.email"},
+		EncryptionKey: testEncryptionKey,
+	}
+
+	document := map[string]interface{}{
+		"contacts": []interface{}{
+			map[string]interface{}{"email": "john@example.com"},
+			map[string]interface{}{"email": "jane@example.com"},
+		},
+	}
+
+	if validations := env.protect("Put", document, false); len(validations) > 0 {
+		t.Fatalf("Options.protect() validations = %v", validations)
+	}
+
+	john, _ := env.Encrypt("john@example.com")
+	jane, _ := env.Encrypt("jane@example.com")
+	want := map[string]interface{}{
+		"contacts": []interface{}{
+			map[string]interface{}{"email": john},
+			map[string]interface{}{"email": jane},
+		},
+	}
+
+	if !reflect.DeepEqual(document, want) {
+		t.Errorf("Options.protect() = %v, want %v", document, want)
+	}
+
+	if err := env.Decrypt(document); err != nil {
+		t.Fatalf("Options.Decrypt() error = %v", err)
+	}
+
+	email := document["contacts"].([]interface{})[1].(map[string]interface{})["email"]
+	if email != "jane@example.com" {
+		t.Errorf("Options.Decrypt() email = %v, want %v", email, "jane@example.com")
+	}
+
+	document = map[string]interface{}{
+		"contacts": "john@example.com",
+	}
+
+	if validations := env.protect("Put", document, false); len(validations) != 1 {
+		t.Errorf("Options.protect() validations = %v, want 1", validations)
+	}
+}
+
+func TestOptions_protectSet(t *testing.T) {
+	env := &Options{
+		HashFields:    []string{"contact.ssn", "pin"},
+		EncryptionKey: testEncryptionKey,
+	}
+
+	ssn, _ := env.Hash("123-45-6789")
+	set := map[string]interface{}{
+		"contact":     map[string]interface{}{"ssn": "123-45-6789"},
+		"contact.ssn": "123-45-6789",
+		"plan":        "premium",
+	}
+
+	if validations := env.protectSet("Update", set, nil); len(validations) > 0 {
+		t.Fatalf("Options.protectSet() validations = %v", validations)
+	}
+
+	want := map[string]interface{}{
+		"contact":     map[string]interface{}{"ssn": ssn},
+		"contact.ssn": ssn,
+		"plan":        "premium",
+	}
+
+	if !reflect.DeepEqual(set, want) {
+		t.Errorf("Options.protectSet() = %v, want %v", set, want)
+	}
+
+	if validations := env.protectSet("Update", nil, map[string]interface{}{"pin": 1.0}); len(validations) != 1 {
+		t.Errorf("Options.protectSet() validations = %v, want 1", validations)
+	}
+
+	env = &Options{
+		EncryptFields: []string{"contact"},
+		EncryptionKey: testEncryptionKey,
+	}
+
+	set = map[string]interface{}{
+		"contact.email": "jane@example.com",
+	}
+
+	if validations := env.protectSet("Update", set, nil); len(validations) != 1 {
+		t.Errorf("Options.protectSet() validations = %v, want 1", validations)
+	}
+}
+
+func TestOptions_validateProtections(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     *Options
+		wantErr bool
+	}{
+		{
+			name: "WithValidOptions",
+			env: &Options{
+				EncryptFields: []string{"email"},
+				HashFields:    []string{"contact.ssn"},
+				EncryptionKey: testEncryptionKey,
+			},
+			wantErr: false,
+		},
+		{
+			name: "WithNoEncryptionKey",
+			env: &Options{
+				EncryptFields: []string{"email"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "WithHashFieldsAndNoEncryptionKey",
+			env: &Options{
+				HashFields: []string{"ssn"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "WithFieldProtectedTwice",
+			env: &Options{
+				HashFields:   []string{"email"},
+				RedactFields: []string{"email"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "WithInvalidFieldPath",
+			env: &Options{
+				RedactFields: []string{"contact..phone"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if validations := tt.env.validateProtections("docstore(fakename)"); (len(validations) > 0) != tt.wantErr {
+				t.Errorf("Options.validateProtections() = %v, wantErr %v", validations, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPut_LoadProtected(t *testing.T) {
+	ctx := context.Background()
+	d := newMemory(t, &Options{
+		EncryptFields: []string{"email"},
+		RedactFields:  []string{"password"},
+		EncryptionKey: testEncryptionKey,
+	})
+
+	got := load(d.Actions()["put"], []byte(`{"document":{"id":"1","email":"john@example.com","password":"secret"}}`))
+	if got.Error != nil {
+		t.Fatalf("Put.Load() error = %v", got.Error)
+	}
+
+	doc := map[string]interface{}{"id": "1"}
+	defaultCollection(t, d).Get(ctx, doc)
+	if doc["email"] == "john@example.com" || doc["password"] != Redacted {
+		t.Errorf("Collection.Get() = %v, want protected fields", doc)
+	}
+
+	d.env.Decrypt(doc)
+	if doc["email"] != "john@example.com" {
+		t.Errorf("Options.Decrypt() email = %v", doc["email"])
+	}
+}
@@ -0,0 +1,69 @@
+package docstoredestination
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+registry holds the options of every docstore destination created with New, by
+name. It allows actions built by users to find the options of their destination
+when marshaled, so they can be validated before being saved.
+*/
+var registry = struct {
+	sync.RWMutex
+	destinations map[string]*Options
+}{
+	destinations: map[string]*Options{},
+}
+
+/*
+register adds the options of a destination to the registry. A destination
+created again with the same name replaces the previous one.
+*/
+func register(env *Options) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	registry.destinations[env.Name] = env
+}
+
+/*
+lookup returns the options of the destination an action is loaded into. The
+options are the ones of the action if it has been returned by the destination.
+Otherwise, they are found in the registry given the name of the destination, or
+are the ones of the single docstore destination if the name is not set. It
+returns nil options if the destination can not be determined, in which case the
+action is only validated when loaded.
+*/
+func lookup(env *Options, name string, action string) (*Options, []errors.Validation) {
+	if env != nil {
+		return env, nil
+	}
+
+	registry.RLock()
+	defer registry.RUnlock()
+
+	if name != "" {
+		if env, exists := registry.destinations[name]; exists {
+			return env, nil
+		}
+
+		return nil, []errors.Validation{
+			{
+				Message: fmt.Sprintf("Destination '%s' does not exist", name),
+				Path:    []string{action, "Destination"},
+			},
+		}
+	}
+
+	if len(registry.destinations) == 1 {
+		for _, env := range registry.destinations {
+			return env, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,85 @@
+package docstoredestination
+
+import (
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	users := &Options{Name: "users"}
+	orders := &Options{Name: "orders"}
+
+	tests := []struct {
+		name         string
+		destinations []*Options
+		env          *Options
+		destination  string
+		want         *Options
+		wantErr      bool
+	}{
+		{
+			name:         "WithActionOptions",
+			destinations: []*Options{users, orders},
+			env:          orders,
+			want:         orders,
+		},
+		{
+			name:         "WithDestination",
+			destinations: []*Options{users, orders},
+			destination:  "orders",
+			want:         orders,
+		},
+		{
+			name:         "WithUnknownDestination",
+			destinations: []*Options{users, orders},
+			destination:  "payments",
+			wantErr:      true,
+		},
+		{
+			name:         "WithSingleDestination",
+			destinations: []*Options{users},
+			want:         users,
+		},
+		{
+			name:         "WithManyDestinations",
+			destinations: []*Options{users, orders},
+			want:         nil,
+		},
+		{
+			name: "WithNoDestination",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetRegistry(t)
+			for _, env := range tt.destinations {
+				register(env)
+			}
+
+			got, validations := lookup(tt.env, tt.destination, "Put")
+			if (len(validations) > 0) != tt.wantErr {
+				t.Fatalf("lookup() validations = %v, wantErr %v", validations, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("lookup() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+/*
+resetRegistry empties the registry of destinations for the duration of the test,
+and restores it once the test is done.
+*/
+func resetRegistry(t *testing.T) {
+	registry.Lock()
+	previous := registry.destinations
+	registry.destinations = map[string]*Options{}
+	registry.Unlock()
+
+	t.Cleanup(func() {
+		registry.Lock()
+		registry.destinations = previous
+		registry.Unlock()
+	})
+}
@@ -0,0 +1,203 @@
+package docstoredestination
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/destination"
+
+	tspb "github.com/golang/protobuf/ptypes/timestamp"
+
+	"gocloud.dev/docstore"
+	"gocloud.dev/gcerrors"
+)
+
+/*
+maxMergeAttempts is the maximum number of times a document is merged and written
+again when its revision conflicts with the one stored. When the limit is reached
+the conflict is returned so the job can be retried later.
+*/
+const maxMergeAttempts = 3
+
+/*
+Merge is the function called when a document can not be written because its
+revision does not match the one stored. It receives the document currently
+stored and the one of the job, and returns the document to write instead. The
+revision of the returned document is always set to the current one. Returning a
+nil document keeps the conflict, so the job is retried later.
+
+Both documents are passed with their encrypted fields decrypted, while hashed
+fields hold their hash and redacted fields hold Redacted, since they can not be
+read back. The document returned is validated and protected again before being
+written, as the document of the job is, but its hashed fields are not hashed
+again. The job is discarded if it is not valid.
+*/
+type Merge func(tk *destination.Toolkit, current map[string]interface{}, incoming map[string]interface{}) (map[string]interface{}, error)
+
+/*
+revisionField returns the name of the field holding the revision of the
+documents.
+*/
+func (env *Options) revisionField() string {
+	if field := env.Params.Get("revision_field"); field != "" {
+		return field
+	}
+
+	return docstore.DefaultRevisionField
+}
+
+/*
+keyFields returns the name of the fields forming the key of the documents for
+the driver used.
+*/
+func (env *Options) keyFields() []string {
+	switch env.Driver {
+	case DriverAWSDynamoDB:
+		fields := []string{env.Params.Get("partition_key")}
+		if sort := env.Params.Get("sort_key"); sort != "" {
+			fields = append(fields, sort)
+		}
+
+		return fields
+	case DriverAzureCosmosDB, DriverMongoDB:
+		if field := env.Params.Get("id_field"); field != "" {
+			return []string{field}
+		}
+
+		return []string{"_id"}
+	case DriverGoogleFirestore:
+		return []string{env.Params.Get("name_field")}
+	case DriverMemory, DriverPostgres:
+		return []string{env.Params.Get("id_field")}
+	}
+
+	return nil
+}
+
+/*
+normalizeRevision converts the revision of a document back to the type expected
+by the driver, since its original type is lost once the document is marshaled
+in JSON. Documents without revision are left untouched.
+*/
+func (env *Options) normalizeRevision(document map[string]interface{}) {
+	field := env.revisionField()
+	revision, exists := document[field]
+	if !exists || revision == nil {
+		return
+	}
+
+	switch env.Driver {
+	case DriverMemory, DriverPostgres:
+		if number, ok := revision.(float64); ok && number == math.Trunc(number) {
+			document[field] = int64(number)
+		}
+
+	case DriverGoogleFirestore:
+		switch value := revision.(type) {
+		case string:
+			if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+				document[field] = &tspb.Timestamp{
+					Seconds: t.Unix(),
+					Nanos:   int32(t.Nanosecond()),
+				}
+			}
+
+		case map[string]interface{}:
+			seconds, _ := value["seconds"].(float64)
+			nanos, _ := value["nanos"].(float64)
+			document[field] = &tspb.Timestamp{
+				Seconds: int64(seconds),
+				Nanos:   int32(nanos),
+			}
+		}
+	}
+}
+
+/*
+resolveConflict is called with the error returned when writing a document. If
+the error is a revision conflict and the Merge option is set, the document
+currently stored is read and merged with the one of the job. The merged document
+is prepared again as described in prepare, and is then written using the write
+function with the current revision. Any other error is returned as is.
+
+The job is discarded if the merged document can not be prepared, since retrying
+it would not help.
+*/
+func resolveConflict(ctx context.Context, tk *destination.Toolkit, env *Options, collection *docstore.Collection, job *store.Job, w *write, write func(map[string]interface{}) error, err error) (*destination.Then, error) {
+	for attempt := 0; attempt < maxMergeAttempts; attempt++ {
+		if env.Merge == nil || gcerrors.Code(err) != gcerrors.FailedPrecondition {
+			return nil, err
+		}
+
+		current := map[string]interface{}{}
+		for _, field := range env.keyFields() {
+			current[field] = w.document[field]
+		}
+
+		if e := collection.Get(ctx, current); e != nil {
+			return nil, e
+		}
+
+		// Merge the documents with their encrypted fields decrypted, so they can
+		// be encrypted again once merged.
+		incoming := copyValue(w.document).(map[string]interface{})
+		if e := env.Decrypt(incoming); e != nil {
+			return nil, e
+		}
+
+		if e := env.Decrypt(current); e != nil {
+			return nil, e
+		}
+
+		merged, e := env.Merge(tk, current, incoming)
+		if e != nil {
+			return nil, e
+		}
+
+		if merged == nil {
+			return nil, err
+		}
+
+		// Hashed fields can not be read back, so both documents hold the hashes
+		// which must not be hashed again.
+		prepared := *w
+		prepared.document = merged
+		prepared.hashed = true
+		if failed := env.prepare(job, &prepared); failed != nil {
+			return failed, nil
+		}
+
+		merged[env.revisionField()] = current[env.revisionField()]
+		err = write(merged)
+	}
+
+	return nil, err
+}
+
+/*
+copyValue returns a deep copy of a value decoded from JSON, so the sub-documents
+and arrays of a document can be changed without changing the original ones.
+*/
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			copied[key] = copyValue(child)
+		}
+
+		return copied
+
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, child := range v {
+			copied[i] = copyValue(child)
+		}
+
+		return copied
+	}
+
+	return value
+}
@@ -0,0 +1,245 @@
+package docstoredestination
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/destination"
+
+	tspb "github.com/golang/protobuf/ptypes/timestamp"
+)
+
+func TestOptions_normalizeRevision(t *testing.T) {
+	tests := []struct {
+		name     string
+		driver   Driver
+		revision interface{}
+		want     interface{}
+	}{
+		{
+			name:     "WithMemoryRevision",
+			driver:   DriverMemory,
+			revision: float64(3),
+			want:     int64(3),
+		},
+		{
+			name:     "WithPostgresRevision",
+			driver:   DriverPostgres,
+			revision: float64(7),
+			want:     int64(7),
+		},
+		{
+			name:     "WithFirestoreTimestamp",
+			driver:   DriverGoogleFirestore,
+			revision: map[string]interface{}{"seconds": float64(1609459200), "nanos": float64(42)},
+			want:     &tspb.Timestamp{Seconds: 1609459200, Nanos: 42},
+		},
+		{
+			name:     "WithFirestoreString",
+			driver:   DriverGoogleFirestore,
+			revision: "2021-01-01T00:00:00.000000042Z",
+			want:     &tspb.Timestamp{Seconds: 1609459200, Nanos: 42},
+		},
+		{
+			name:     "WithDynamoDBRevision",
+			driver:   DriverAWSDynamoDB,
+			revision: "f81d4fae-7dec-11d0-a765-00a0c91e6bf6",
+			want:     "f81d4fae-7dec-11d0-a765-00a0c91e6bf6",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &Options{
+				Driver: tt.driver,
+				Params: url.Values{},
+			}
+
+			document := map[string]interface{}{
+				"DocstoreRevision": tt.revision,
+			}
+
+			env.normalizeRevision(document)
+			if !reflect.DeepEqual(document["DocstoreRevision"], tt.want) {
+				t.Errorf("Options.normalizeRevision() = %#v, want %#v", document["DocstoreRevision"], tt.want)
+			}
+		})
+	}
+}
+
+func TestPut_LoadRevision(t *testing.T) {
+	merge := func(tk *destination.Toolkit, current map[string]interface{}, incoming map[string]interface{}) (map[string]interface{}, error) {
+		current["visits"] = current["visits"].(float64) + incoming["visits"].(float64)
+		return current, nil
+	}
+
+	tests := []struct {
+		name       string
+		merge      Merge
+		batch      bool
+		revision   int64
+		wantErr    bool
+		wantVisits float64
+	}{
+		{
+			name:       "WithMatchingRevision",
+			revision:   1,
+			wantErr:    false,
+			wantVisits: 1,
+		},
+		{
+			name:       "WithConflict",
+			revision:   5,
+			wantErr:    true,
+			wantVisits: 2,
+		},
+		{
+			name:       "WithConflictAndMerge",
+			merge:      merge,
+			revision:   5,
+			wantErr:    false,
+			wantVisits: 3,
+		},
+		{
+			name: "WithConflictAndNilMerge",
+			merge: func(tk *destination.Toolkit, current map[string]interface{}, incoming map[string]interface{}) (map[string]interface{}, error) {
+				return nil, nil
+			},
+			revision:   5,
+			wantErr:    true,
+			wantVisits: 2,
+		},
+		{
+			name:       "WithConflictAndMergeInBatch",
+			merge:      merge,
+			batch:      true,
+			revision:   5,
+			wantErr:    false,
+			wantVisits: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			d := newMemory(t, &Options{
+				Batch: tt.batch,
+				Merge: tt.merge,
+				Params: url.Values{
+					"revision_field": {"rev"},
+				},
+			})
+
+			// The first write sets the revision to 1.
+			defaultCollection(t, d).Put(ctx, map[string]interface{}{"id": "user-1", "visits": float64(2), "rev": nil})
+
+			data := []byte(fmt.Sprintf(`{"document":{"id":"user-1","visits":1,"rev":%d}}`, tt.revision))
+			got := load(d.Actions()["put"], data)
+			if (got.Error != nil) != tt.wantErr {
+				t.Fatalf("Put.Load() error = %v, wantErr %v", got.Error, tt.wantErr)
+			}
+			if got.ForceDiscard {
+				t.Errorf("Put.Load() discard = %v, want %v", got.ForceDiscard, false)
+			}
+
+			doc := map[string]interface{}{"id": "user-1"}
+			defaultCollection(t, d).Get(ctx, doc)
+			if doc["visits"] != tt.wantVisits {
+				t.Errorf("Collection.Get() visits = %v, want %v", doc["visits"], tt.wantVisits)
+			}
+		})
+	}
+}
+
+func TestUpdate_LoadRevision(t *testing.T) {
+	ctx := context.Background()
+	d := newMemory(t, &Options{
+		Params: url.Values{
+			"revision_field": {"rev"},
+		},
+	})
+
+	defaultCollection(t, d).Put(ctx, map[string]interface{}{"id": "user-1", "plan": "free", "rev": nil})
+
+	got := load(d.Actions()["update"], []byte(`{"document":{"id":"user-1","rev":5},"set":{"plan":"premium"}}`))
+	if got.Error == nil || got.ForceDiscard {
+		t.Fatalf("Update.Load() error = %v, discard = %v, want retriable error", got.Error, got.ForceDiscard)
+	}
+
+	got = load(d.Actions()["update"], []byte(`{"document":{"id":"user-1","rev":1},"set":{"plan":"premium"}}`))
+	if got.Error != nil {
+		t.Fatalf("Update.Load() error = %v", got.Error)
+	}
+}
+
+func TestPut_LoadRevisionPrepare(t *testing.T) {
+	tests := []struct {
+		name        string
+		merge       Merge
+		wantDiscard bool
+	}{
+		{
+			name: "WithProtectedFields",
+			merge: func(tk *destination.Toolkit, current map[string]interface{}, incoming map[string]interface{}) (map[string]interface{}, error) {
+				if current["email"] != "john@example.com" || incoming["email"] != "jane@example.com" {
+					return nil, fmt.Errorf("emails not decrypted: %v, %v", current["email"], incoming["email"])
+				}
+
+				incoming["ssn"] = current["ssn"]
+				return incoming, nil
+			},
+			wantDiscard: false,
+		},
+		{
+			name: "WithInvalidDocument",
+			merge: func(tk *destination.Toolkit, current map[string]interface{}, incoming map[string]interface{}) (map[string]interface{}, error) {
+				delete(incoming, "email")
+				return incoming, nil
+			},
+			wantDiscard: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			d := newMemory(t, &Options{
+				Merge:         tt.merge,
+				EncryptFields: []string{"email"},
+				HashFields:    []string{"ssn"},
+				EncryptionKey: testEncryptionKey,
+				Schema: map[string]string{
+					"fakecollection": testSchema,
+				},
+				Params: url.Values{
+					"revision_field": {"rev"},
+				},
+			})
+
+			got := load(d.Actions()["put"], []byte(`{"document":{"id":"user-1","email":"john@example.com","ssn":"123-45-6789","rev":null}}`))
+			if got.Error != nil {
+				t.Fatalf("Put.Load() error = %v", got.Error)
+			}
+
+			got = load(d.Actions()["put"], []byte(`{"document":{"id":"user-1","email":"jane@example.com","ssn":"987-65-4321","rev":5}}`))
+			if got.ForceDiscard != tt.wantDiscard {
+				t.Fatalf("Put.Load() error = %v, discard = %v, want %v", got.Error, got.ForceDiscard, tt.wantDiscard)
+			}
+			if !tt.wantDiscard && got.Error != nil {
+				t.Fatalf("Put.Load() error = %v", got.Error)
+			}
+
+			email, _ := d.env.Encrypt("john@example.com")
+			if !tt.wantDiscard {
+				email, _ = d.env.Encrypt("jane@example.com")
+			}
+
+			ssn, _ := d.env.Hash("123-45-6789")
+			doc := map[string]interface{}{"id": "user-1"}
+			defaultCollection(t, d).Get(ctx, doc)
+			if doc["email"] != email || doc["ssn"] != ssn {
+				t.Errorf("Collection.Get() = %v, want email %v and ssn %v", doc, email, ssn)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package docstoredestination
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+/*
+compileSchema compiles a JSON Schema passed as a string.
+*/
+func compileSchema(schema string) (*jsonschema.Schema, error) {
+	return jsonschema.CompileString("schema.json", schema)
+}
+
+/*
+validateSchema validates a document against the JSON Schema of the collection,
+if any. An empty collection name is the one set in the connection string. It
+returns a validation error for every constraint the document does not satisfy,
+with the path of the invalid field.
+*/
+func (env *Options) validateSchema(action string, collection string, document map[string]interface{}) []errors.Validation {
+	validations := []errors.Validation{}
+	if collection == "" {
+		collection = env.defaultCollection()
+	}
+
+	schema, exists := env.schemas[collection]
+	if !exists {
+		return validations
+	}
+
+	// The document is encoded and decoded back so it only holds JSON values, as
+	// expected by the validator.
+	var instance interface{}
+	data, err := json.Marshal(document)
+	if err == nil {
+		err = json.Unmarshal(data, &instance)
+	}
+
+	if err != nil {
+		validations = append(validations, errors.Validation{
+			Message: err.Error(),
+			Path:    []string{action, "Document"},
+		})
+
+		return validations
+	}
+
+	err = schema.Validate(instance)
+	if err == nil {
+		return validations
+	}
+
+	verr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		validations = append(validations, errors.Validation{
+			Message: err.Error(),
+			Path:    []string{action, "Document"},
+		})
+
+		return validations
+	}
+
+	for _, leaf := range schemaLeaves(verr) {
+		path := []string{action, "Document"}
+		for _, segment := range strings.Split(leaf.InstanceLocation, "/") {
+			if segment != "" {
+				path = append(path, unescapePointer(segment))
+			}
+		}
+
+		validations = append(validations, errors.Validation{
+			Message: leaf.Message,
+			Path:    path,
+		})
+	}
+
+	return validations
+}
+
+/*
+schemaLeaves returns the validation errors without causes, which are the ones
+describing the constraints not satisfied.
+*/
+func schemaLeaves(verr *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(verr.Causes) == 0 {
+		return []*jsonschema.ValidationError{verr}
+	}
+
+	leaves := []*jsonschema.ValidationError{}
+	for _, cause := range verr.Causes {
+		leaves = append(leaves, schemaLeaves(cause)...)
+	}
+
+	return leaves
+}
+
+/*
+unescapePointer unescapes a segment of a JSON Pointer.
+*/
+func unescapePointer(segment string) string {
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(segment)
+}
+
+/*
+invalidDocument returns the error to send when a document does not satisfy the
+JSON Schema of the collection.
+*/
+func invalidDocument(validations []errors.Validation) error {
+	return &errors.Error{
+		Message:     "docstore: Document does not satisfy the schema",
+		Validations: validations,
+	}
+}
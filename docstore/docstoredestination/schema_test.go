@@ -0,0 +1,180 @@
+package docstoredestination
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/destination"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+var testSchema = `{
+  "type": "object",
+  "required": ["id", "email"],
+  "properties": {
+    "email": {"type": "string"},
+    "address": {
+      "type": "object",
+      "properties": {
+        "zip": {"type": "string"}
+      }
+    }
+  }
+}`
+
+func TestPut_MarshalSchema(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection string
+		document   map[string]interface{}
+		wantPaths  [][]string
+	}{
+		{
+			name: "WithValidDocument",
+			document: map[string]interface{}{
+				"id":    "user-1",
+				"email": "john@example.com",
+			},
+			wantPaths: nil,
+		},
+		{
+			name: "WithMissingField",
+			document: map[string]interface{}{
+				"id": "user-1",
+			},
+			wantPaths: [][]string{
+				{"Put", "Document"},
+			},
+		},
+		{
+			name: "WithInvalidNestedField",
+			document: map[string]interface{}{
+				"id":    "user-1",
+				"email": "john@example.com",
+				"address": map[string]interface{}{
+					"zip": 75001,
+				},
+			},
+			wantPaths: [][]string{
+				{"Put", "Document", "address", "zip"},
+			},
+		},
+		{
+			name:       "WithDefaultCollectionByName",
+			collection: "fakecollection",
+			document: map[string]interface{}{
+				"id": "user-1",
+			},
+			wantPaths: [][]string{
+				{"Put", "Document"},
+			},
+		},
+		{
+			name:       "WithCollectionWithoutSchema",
+			collection: "orders",
+			document: map[string]interface{}{
+				"id": "order-1",
+			},
+			wantPaths: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newOptions(t, &Options{
+				Driver:      DriverMemory,
+				Collections: []string{"orders"},
+				Schema: map[string]string{
+					"fakecollection": testSchema,
+				},
+				Params: url.Values{
+					"id_field": {"id"},
+				},
+			})
+
+			a := Put{
+				Collection: tt.collection,
+				Document:   tt.document,
+			}
+
+			_, err := a.Marshal(&destination.Toolkit{})
+			if (err != nil) != (tt.wantPaths != nil) {
+				t.Fatalf("Put.Marshal() error = %v, want paths %v", err, tt.wantPaths)
+			}
+			if err == nil {
+				return
+			}
+
+			var paths [][]string
+			for _, validation := range err.(*errors.Error).Validations {
+				paths = append(paths, validation.Path)
+			}
+
+			if !reflect.DeepEqual(paths, tt.wantPaths) {
+				t.Errorf("Put.Marshal() paths = %v, want %v", paths, tt.wantPaths)
+			}
+		})
+	}
+}
+
+func TestMarshalSchema(t *testing.T) {
+	invalid := map[string]interface{}{"id": "user-1"}
+	tests := []struct {
+		name   string
+		action destination.Action
+	}{
+		{
+			name:   "WithPut",
+			action: Put{Document: invalid},
+		},
+		{
+			name:   "WithCreate",
+			action: Create{Document: invalid},
+		},
+		{
+			name:   "WithReplace",
+			action: Replace{Document: invalid},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newOptions(t, &Options{
+				Driver: DriverMemory,
+				Schema: map[string]string{
+					"fakecollection": testSchema,
+				},
+				Params: url.Values{
+					"id_field": {"id"},
+				},
+			})
+
+			if _, err := tt.action.Marshal(&destination.Toolkit{}); err == nil {
+				t.Errorf("%s.Marshal() error = nil, want error", tt.action.String())
+			}
+		})
+	}
+}
+
+func TestPut_LoadSchema(t *testing.T) {
+	d := newMemory(t, &Options{
+		Collections: []string{"orders"},
+		Schema: map[string]string{
+			"orders": testSchema,
+		},
+	})
+
+	got := load(d.Actions()["put"], []byte(`{"document":{"id":"user-1","email":"john@example.com"},"collection":"orders"}`))
+	if got.Error != nil {
+		t.Fatalf("Put.Load() error = %v", got.Error)
+	}
+
+	got = load(d.Actions()["put"], []byte(`{"document":{"id":"user-2","email":42}}`))
+	if got.Error != nil {
+		t.Fatalf("Put.Load() error = %v", got.Error)
+	}
+
+	got = load(d.Actions()["put"], []byte(`{"document":{"id":"user-2","email":42},"collection":"orders"}`))
+	if got.Error == nil || !got.ForceDiscard {
+		t.Errorf("Put.Load() error = %v, discard = %v, want discarded error", got.Error, got.ForceDiscard)
+	}
+}
@@ -3,7 +3,10 @@ module github.com/nunchistudio/blacksmith-modules/docstore
 go 1.16
 
 require (
+	github.com/golang/protobuf v1.5.2
+	github.com/lib/pq v1.10.2
 	github.com/nunchistudio/blacksmith v0.18.0
+	github.com/santhosh-tekuri/jsonschema/v5 v5.0.0
 	github.com/sirupsen/logrus v1.8.1
 	gocloud.dev v0.23.0
 	gocloud.dev/docstore/mongodocstore v0.23.0
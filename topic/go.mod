@@ -3,12 +3,15 @@ module github.com/nunchistudio/blacksmith-modules/topic
 go 1.16
 
 require (
+	github.com/Azure/azure-service-bus-go v0.10.11
+	github.com/aws/aws-sdk-go v1.38.35
 	github.com/nunchistudio/blacksmith v0.18.0
 	github.com/sirupsen/logrus v1.8.1
 	gocloud.dev v0.23.0
 	gocloud.dev/pubsub/kafkapubsub v0.23.0
 	gocloud.dev/pubsub/natspubsub v0.23.0
 	gocloud.dev/pubsub/rabbitpubsub v0.23.0
+	google.golang.org/genproto v0.0.0-20210506142907-4a47615972c2
 )
 
 replace golang.org/x/net => golang.org/x/net v0.0.0-20201202161906-c7110b5ffcbb
@@ -3,6 +3,7 @@ package topicdestination
 import (
 	"context"
 	"encoding/json"
+	"sync"
 
 	"github.com/nunchistudio/blacksmith/adapter/store"
 	"github.com/nunchistudio/blacksmith/destination"
@@ -21,6 +22,10 @@ type Publish struct {
 	ctx   context.Context
 
 	Message Message `json:"message"`
+
+	// CloudEvent allows to wrap the message in a CloudEvents envelope. The
+	// message is published as is when nil.
+	CloudEvent *CloudEvent `json:"cloudevent,omitempty"`
 }
 
 /*
@@ -45,6 +50,18 @@ saving it in the store adapter.
 */
 func (a Publish) Marshal(tk *destination.Toolkit) (*destination.Job, error) {
 
+	// Ensure the CloudEvents envelope is valid. Required attributes can be
+	// derived from the event and job, so they are validated when loading.
+	if a.CloudEvent != nil {
+		if validations := a.CloudEvent.validate(false); len(validations) > 0 {
+			return nil, &errors.Error{
+				StatusCode:  400,
+				Message:     "Bad Request",
+				Validations: validations,
+			}
+		}
+	}
+
 	// Try to marshal the data passed directly to the receiver.
 	data, err := json.Marshal(&a)
 	if err != nil {
@@ -70,38 +87,115 @@ the destination. It is in charge of the "L" in the ETL process.
 */
 func (a Publish) Load(tk *destination.Toolkit, queue *store.Queue, then chan<- destination.Then) {
 
+	// Start the workers in charge of publishing the messages. There are as many
+	// workers as the concurrency allowed by the destination's options. Each
+	// job is handled by a single worker, which sends exactly one result for it.
+	// Messages sent concurrently are batched together by the driver when
+	// supported.
+	workers := a.env.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	pending := make(chan publishJob)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range pending {
+				then <- a.load(p.event, p.job)
+			}
+		}()
+	}
+
 	// We can go through every events received from the queue and their
 	// related jobs. The queue can contain one or many events. The jobs
 	// present in the events are specific to this action only.
 	//
-	// This allows to parse everything needed and make a request to the
-	// destination for each event / job.
+	// Once the destination is shutting down, the remaining jobs are not
+	// distributed to the workers anymore and are marked as failed so they
+	// can be retried later.
 	for _, event := range queue.Events {
 		for _, job := range event.Jobs {
-			var pub Publish
-			err := json.Unmarshal(job.Data, &pub)
-			if err != nil {
+			if err := a.ctx.Err(); err != nil {
 				then <- destination.Then{
-					Jobs:         []string{job.ID},
-					Error:        err,
-					ForceDiscard: true,
+					Jobs:  []string{job.ID},
+					Error: err,
 				}
 
 				continue
 			}
 
-			// Format the message.
-			msg := &pubsub.Message{
-				Body:     pub.Message.Body,
-				Metadata: pub.Message.Metadata,
+			select {
+			case pending <- publishJob{event, job}:
+			case <-a.ctx.Done():
+				then <- destination.Then{
+					Jobs:  []string{job.ID},
+					Error: a.ctx.Err(),
+				}
+			}
+		}
+	}
+
+	close(pending)
+	wg.Wait()
+}
+
+/*
+publishJob is a job to publish along with its event.
+*/
+type publishJob struct {
+	event *store.Event
+	job   *store.Job
+}
+
+/*
+load publishes the message of a single job and returns its result.
+*/
+func (a Publish) load(event *store.Event, job *store.Job) destination.Then {
+	var pub Publish
+	err := json.Unmarshal(job.Data, &pub)
+	if err != nil {
+		return destination.Then{
+			Jobs:         []string{job.ID},
+			Error:        err,
+			ForceDiscard: true,
+		}
+	}
+
+	// Wrap the message in the CloudEvents envelope if set. Discard the job if
+	// the envelope is not valid, since retrying it would not help.
+	if pub.CloudEvent != nil {
+		ce := pub.CloudEvent.derive(event, job, pub.Message.Body)
+		if validations := ce.validate(true); len(validations) > 0 {
+			return destination.Then{
+				Jobs: []string{job.ID},
+				Error: &errors.Error{
+					Message:     "topic: CloudEvent not valid",
+					Validations: validations,
+				},
+				ForceDiscard: true,
 			}
+		}
 
-			// Publish the message to the message broker.
-			err = a.topic.Send(a.ctx, msg)
-			then <- destination.Then{
-				Jobs:  []string{job.ID},
-				Error: err,
+		pub.Message, err = ce.wrap(pub.Message)
+		if err != nil {
+			return destination.Then{
+				Jobs:         []string{job.ID},
+				Error:        err,
+				ForceDiscard: true,
 			}
 		}
 	}
+
+	// Format the message, with its keys set given the driver.
+	msg := a.env.message(pub.Message)
+
+	// Publish the message to the message broker.
+	err = a.topic.Send(a.ctx, msg)
+	return destination.Then{
+		Jobs:  []string{job.ID},
+		Error: err,
+	}
 }
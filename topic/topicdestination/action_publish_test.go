@@ -1,7 +1,129 @@
 package topicdestination
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
 	"github.com/nunchistudio/blacksmith/destination"
 )
 
 var _ destination.Action = Publish{}
+
+func TestPublish_Load(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		ordered     bool
+	}{
+		{
+			name:        "WithDefaultConcurrency",
+			concurrency: 0,
+			ordered:     true,
+		},
+		{
+			name:        "WithConcurrency",
+			concurrency: 4,
+			ordered:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "messages.ndjson")
+			d := newTopic(t, &Options{
+				Driver:      DriverFile,
+				Connection:  filename,
+				Concurrency: tt.concurrency,
+			})
+
+			data := [][]byte{}
+			want := []string{}
+			for i := 0; i < 20; i++ {
+				data = append(data, []byte(fmt.Sprintf(`{"message":{"meta":{"index":"%02d"}}}`, i)))
+				want = append(want, fmt.Sprintf("%02d", i))
+			}
+
+			// Every job must have exactly one result.
+			jobs := map[string]bool{}
+			for _, result := range load(d.Actions()["publish"], data...) {
+				if result.Error != nil {
+					t.Fatalf("Publish.Load() error = %v", result.Error)
+				}
+
+				for _, job := range result.Jobs {
+					if jobs[job] {
+						t.Fatalf("Publish.Load() job %s has many results", job)
+					}
+
+					jobs[job] = true
+				}
+			}
+
+			if len(jobs) != len(data) {
+				t.Fatalf("Publish.Load() results = %d, want %d", len(jobs), len(data))
+			}
+
+			// The local file driver writes the messages in the order they are sent.
+			file, err := os.Open(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer file.Close()
+			got := []string{}
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				var msg Message
+				if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+					t.Fatalf("json.Unmarshal() error = %v", err)
+				}
+
+				got = append(got, msg.Metadata["index"])
+			}
+
+			if !tt.ordered {
+				sort.Strings(got)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("messages = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPublish_LoadCloudEvent(t *testing.T) {
+	d := newTopic(t, &Options{
+		Driver:     DriverMemory,
+		Connection: "faketopic",
+	})
+
+	// The event of the queue has no source nor trigger, so the type of the
+	// CloudEvent can not be derived and the job must be discarded.
+	results := load(d.Actions()["publish"], []byte(`{"message":{"body":"e30="},"cloudevent":{}}`))
+	if results[0].Error == nil || !results[0].ForceDiscard {
+		t.Fatalf("Publish.Load() = %+v, want discarded job", results[0])
+	}
+
+	results = load(d.Actions()["publish"], []byte(`{"message":{"body":"e30="},"cloudevent":{"mode":"binary","source":"crm","type":"crm.identify"}}`))
+	if results[0].Error != nil {
+		t.Fatalf("Publish.Load() error = %v", results[0].Error)
+	}
+
+	msg, err := d.Subscription().Receive(context.Background())
+	if err != nil {
+		t.Fatalf("Subscription.Receive() error = %v", err)
+	}
+
+	msg.Ack()
+	if msg.Metadata["ce-id"] != "job-0" || msg.Metadata["ce-type"] != "crm.identify" || string(msg.Body) != "{}" {
+		t.Errorf("Subscription.Receive() = %q %v", msg.Body, msg.Metadata)
+	}
+}
@@ -0,0 +1,288 @@
+package topicdestination
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+CloudEventsSpecVersion is the version of the CloudEvents specification the
+envelopes conform to.
+*/
+const CloudEventsSpecVersion = "1.0"
+
+/*
+CloudEventsMode is a custom type allowing the user to only pass supported modes
+of CloudEvents envelopes.
+*/
+type CloudEventsMode string
+
+/*
+CloudEventsStructured is used to wrap the message body in a CloudEvents JSON
+envelope. The metadata key "content-type" is set to
+"application/cloudevents+json".
+*/
+var CloudEventsStructured CloudEventsMode = "structured"
+
+/*
+CloudEventsBinary is used to keep the message body as is and to set the
+attributes of the event in the metadata of the message, with keys prefixed by
+"ce-". The metadata key "content-type" is set to the content type of the data.
+*/
+var CloudEventsBinary CloudEventsMode = "binary"
+
+/*
+validCloudEventsExtension is the pattern of valid names of extension attributes.
+*/
+var validCloudEventsExtension = regexp.MustCompile(`^[a-z0-9]{1,20}$`)
+
+/*
+reservedCloudEventsAttributes is the list of attributes defined by the
+specification, which can not be used as extension attributes.
+*/
+var reservedCloudEventsAttributes = map[string]bool{
+	"specversion":     true,
+	"id":              true,
+	"source":          true,
+	"type":            true,
+	"time":            true,
+	"subject":         true,
+	"datacontenttype": true,
+	"dataschema":      true,
+	"data":            true,
+	"data_base64":     true,
+}
+
+/*
+CloudEvent allows to wrap the body of a message in a CloudEvents 1.0 envelope.
+Attributes not set are derived from the Blacksmith event and job.
+*/
+type CloudEvent struct {
+
+	// Mode is the content mode of the envelope.
+	//
+	// Defaults to CloudEventsStructured.
+	Mode CloudEventsMode `json:"mode,omitempty"`
+
+	// ID identifies the event. Since it is the same when a job is retried,
+	// consumers can use it to detect duplicates.
+	//
+	// Defaults to the job ID.
+	ID string `json:"id,omitempty"`
+
+	// Source identifies the context in which the event happened.
+	//
+	// Defaults to the name of the source of the event.
+	Source string `json:"source,omitempty"`
+
+	// Type is the type of the event.
+	//
+	// Example: "com.example.user.identified"
+	// Defaults to "<source>.<trigger>".
+	Type string `json:"type,omitempty"`
+
+	// Subject is the subject of the event in the context of its source.
+	Subject string `json:"subject,omitempty"`
+
+	// Time is the time at which the event happened.
+	//
+	// Defaults to the time the event was received by Blacksmith.
+	Time *time.Time `json:"time,omitempty"`
+
+	// DataContentType is the content type of the message body.
+	//
+	// Defaults to "application/json" if the message body is valid JSON, and is
+	// not set otherwise.
+	DataContentType string `json:"datacontenttype,omitempty"`
+
+	// DataSchema is the URI of the schema the message body adheres to.
+	DataSchema string `json:"dataschema,omitempty"`
+
+	// Extensions is the list of extension attributes of the event. Names must
+	// only contain lowercase letters and digits, up to 20 characters.
+	Extensions map[string]string `json:"extensions,omitempty"`
+}
+
+/*
+derive returns the envelope with the attributes not set derived from the event,
+job, and message body.
+*/
+func (ce CloudEvent) derive(event *store.Event, job *store.Job, body []byte) CloudEvent {
+	if ce.Mode == "" {
+		ce.Mode = CloudEventsStructured
+	}
+
+	if ce.ID == "" {
+		ce.ID = job.ID
+	}
+
+	if ce.Source == "" {
+		ce.Source = event.Source
+	}
+
+	if ce.Type == "" && event.Source != "" && event.Trigger != "" {
+		ce.Type = event.Source + "." + event.Trigger
+	}
+
+	if ce.Time == nil {
+		t := event.ReceivedAt
+		if t.IsZero() {
+			t = job.CreatedAt
+		}
+
+		if !t.IsZero() {
+			t = t.UTC()
+			ce.Time = &t
+		}
+	}
+
+	if ce.DataContentType == "" && json.Valid(body) {
+		ce.DataContentType = "application/json"
+	}
+
+	return ce
+}
+
+/*
+validate ensures the envelope is valid. When derived is true, the required
+attributes must be set.
+*/
+func (ce CloudEvent) validate(derived bool) []errors.Validation {
+	validations := []errors.Validation{}
+
+	if ce.Mode != "" && ce.Mode != CloudEventsStructured && ce.Mode != CloudEventsBinary {
+		validations = append(validations, errors.Validation{
+			Message: fmt.Sprintf("Mode '%s' not valid", ce.Mode),
+			Path:    []string{"Publish", "CloudEvent", "Mode"},
+		})
+	}
+
+	if derived {
+		required := []struct {
+			name  string
+			value string
+		}{
+			{"ID", ce.ID},
+			{"Source", ce.Source},
+			{"Type", ce.Type},
+		}
+
+		for _, attr := range required {
+			if attr.value == "" {
+				validations = append(validations, errors.Validation{
+					Message: fmt.Sprintf("Attribute '%s' must be set", strings.ToLower(attr.name)),
+					Path:    []string{"Publish", "CloudEvent", attr.name},
+				})
+			}
+		}
+	}
+
+	for name := range ce.Extensions {
+		if !validCloudEventsExtension.MatchString(name) || reservedCloudEventsAttributes[name] {
+			validations = append(validations, errors.Validation{
+				Message: fmt.Sprintf("Extension attribute '%s' not valid", name),
+				Path:    []string{"Publish", "CloudEvent", "Extensions", name},
+			})
+		}
+	}
+
+	return validations
+}
+
+/*
+wrap returns the message wrapped in the envelope, given its mode. The envelope
+must be derived and valid.
+*/
+func (ce CloudEvent) wrap(m Message) (Message, error) {
+	metadata := map[string]string{}
+	for k, v := range m.Metadata {
+		metadata[k] = v
+	}
+
+	m.Metadata = metadata
+	if ce.Mode == CloudEventsBinary {
+		if ce.DataContentType != "" {
+			metadata["content-type"] = ce.DataContentType
+		}
+
+		for name, value := range ce.attributes() {
+			if name != "datacontenttype" {
+				metadata["ce-"+name] = value
+			}
+		}
+
+		return m, nil
+	}
+
+	envelope := map[string]interface{}{}
+	for name, value := range ce.attributes() {
+		envelope[name] = value
+	}
+
+	// JSON data is embedded as is in the envelope. Any other data is encoded in
+	// base64.
+	if isJSONContentType(ce.DataContentType) && json.Valid(m.Body) {
+		envelope["data"] = json.RawMessage(m.Body)
+	} else if m.Body != nil {
+		envelope["data_base64"] = m.Body
+	}
+
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		return m, err
+	}
+
+	metadata["content-type"] = "application/cloudevents+json"
+	m.Body = body
+	return m, nil
+}
+
+/*
+attributes returns the attributes of the envelope set, including the extension
+attributes.
+*/
+func (ce CloudEvent) attributes() map[string]string {
+	attributes := map[string]string{
+		"specversion": CloudEventsSpecVersion,
+		"id":          ce.ID,
+		"source":      ce.Source,
+		"type":        ce.Type,
+	}
+
+	if ce.DataContentType != "" {
+		attributes["datacontenttype"] = ce.DataContentType
+	}
+
+	if ce.Time != nil {
+		attributes["time"] = ce.Time.Format(time.RFC3339Nano)
+	}
+
+	if ce.Subject != "" {
+		attributes["subject"] = ce.Subject
+	}
+
+	if ce.DataSchema != "" {
+		attributes["dataschema"] = ce.DataSchema
+	}
+
+	for name, value := range ce.Extensions {
+		attributes[name] = value
+	}
+
+	return attributes
+}
+
+/*
+isJSONContentType indicates if a content type is JSON, such as
+"application/json" or "application/vnd.api+json".
+*/
+func isJSONContentType(contentType string) bool {
+	mediaType := strings.TrimSpace(strings.Split(contentType, ";")[0])
+	return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
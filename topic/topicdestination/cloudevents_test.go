@@ -0,0 +1,236 @@
+package topicdestination
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+)
+
+func TestCloudEvent_derive(t *testing.T) {
+	received := time.Date(2021, 5, 10, 12, 0, 0, 0, time.UTC)
+	event := &store.Event{
+		ID:         "event-1",
+		Source:     "crm",
+		Trigger:    "identify",
+		ReceivedAt: received,
+	}
+
+	job := &store.Job{
+		ID: "job-1",
+	}
+
+	got := CloudEvent{}.derive(event, job, []byte(`{"user_id":"123"}`))
+	want := CloudEvent{
+		Mode:            CloudEventsStructured,
+		ID:              "job-1",
+		Source:          "crm",
+		Type:            "crm.identify",
+		Time:            &received,
+		DataContentType: "application/json",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CloudEvent.derive() = %+v, want %+v", got, want)
+	}
+
+	got = CloudEvent{ID: "custom", Type: "com.example.identified"}.derive(event, job, nil)
+	if got.ID != "custom" || got.Type != "com.example.identified" {
+		t.Errorf("CloudEvent.derive() overrode attributes = %+v", got)
+	}
+
+	// The content type is only defaulted when the body is valid JSON.
+	for _, body := range [][]byte{nil, []byte("hello"), {0xff, 0xd8}} {
+		if got = (CloudEvent{}).derive(event, job, body); got.DataContentType != "" {
+			t.Errorf("CloudEvent.derive() content type = %q for body %q, want none", got.DataContentType, body)
+		}
+	}
+
+	got = CloudEvent{DataContentType: "text/plain"}.derive(event, job, []byte(`"hello"`))
+	if got.DataContentType != "text/plain" {
+		t.Errorf("CloudEvent.derive() overrode content type = %q", got.DataContentType)
+	}
+}
+
+func TestCloudEvent_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		ce      CloudEvent
+		derived bool
+		wantErr bool
+	}{
+		{
+			name:    "WithDefaults",
+			ce:      CloudEvent{},
+			derived: false,
+			wantErr: false,
+		},
+		{
+			name:    "WithMissingAttributes",
+			ce:      CloudEvent{ID: "job-1", Source: "crm"},
+			derived: true,
+			wantErr: true,
+		},
+		{
+			name:    "WithRequiredAttributes",
+			ce:      CloudEvent{ID: "job-1", Source: "crm", Type: "crm.identify"},
+			derived: true,
+			wantErr: false,
+		},
+		{
+			name:    "WithBadMode",
+			ce:      CloudEvent{Mode: "batch"},
+			derived: false,
+			wantErr: true,
+		},
+		{
+			name:    "WithBadExtension",
+			ce:      CloudEvent{Extensions: map[string]string{"Trace-ID": "abc"}},
+			derived: false,
+			wantErr: true,
+		},
+		{
+			name:    "WithReservedExtension",
+			ce:      CloudEvent{Extensions: map[string]string{"subject": "abc"}},
+			derived: false,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if validations := tt.ce.validate(tt.derived); (len(validations) > 0) != tt.wantErr {
+				t.Errorf("CloudEvent.validate() = %v, wantErr %v", validations, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCloudEvent_wrap(t *testing.T) {
+	now := time.Date(2021, 5, 10, 12, 0, 0, 0, time.UTC)
+	ce := CloudEvent{
+		Mode:            CloudEventsStructured,
+		ID:              "job-1",
+		Source:          "crm",
+		Type:            "crm.identify",
+		Time:            &now,
+		DataContentType: "application/json",
+		Extensions:      map[string]string{"traceid": "abc"},
+	}
+
+	t.Run("Structured", func(t *testing.T) {
+		msg, err := ce.wrap(Message{
+			Body:     []byte(`{"user_id":"123"}`),
+			Metadata: map[string]string{"kind": "greeting"},
+		})
+
+		if err != nil {
+			t.Fatalf("CloudEvent.wrap() error = %v", err)
+		}
+
+		var got map[string]interface{}
+		if err := json.Unmarshal(msg.Body, &got); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+
+		want := map[string]interface{}{
+			"specversion":     "1.0",
+			"id":              "job-1",
+			"source":          "crm",
+			"type":            "crm.identify",
+			"time":            "2021-05-10T12:00:00Z",
+			"datacontenttype": "application/json",
+			"traceid":         "abc",
+			"data":            map[string]interface{}{"user_id": "123"},
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("CloudEvent.wrap() body = %v, want %v", got, want)
+		}
+
+		if msg.Metadata["content-type"] != "application/cloudevents+json" || msg.Metadata["kind"] != "greeting" {
+			t.Errorf("CloudEvent.wrap() metadata = %v", msg.Metadata)
+		}
+	})
+
+	t.Run("StructuredWithBinaryData", func(t *testing.T) {
+		binary := ce
+		binary.DataContentType = "application/octet-stream"
+		msg, err := binary.wrap(Message{
+			Body: []byte("hello"),
+		})
+
+		if err != nil {
+			t.Fatalf("CloudEvent.wrap() error = %v", err)
+		}
+
+		var got map[string]interface{}
+		if err := json.Unmarshal(msg.Body, &got); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+
+		if got["data_base64"] != "aGVsbG8=" || got["data"] != nil {
+			t.Errorf("CloudEvent.wrap() body = %v", got)
+		}
+	})
+
+	t.Run("StructuredWithoutContentType", func(t *testing.T) {
+		untyped := ce
+		untyped.DataContentType = ""
+		msg, err := untyped.wrap(Message{
+			Body: []byte("hello"),
+		})
+
+		if err != nil {
+			t.Fatalf("CloudEvent.wrap() error = %v", err)
+		}
+
+		var got map[string]interface{}
+		if err := json.Unmarshal(msg.Body, &got); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+
+		if _, exists := got["datacontenttype"]; exists || got["data_base64"] != "aGVsbG8=" {
+			t.Errorf("CloudEvent.wrap() body = %v", got)
+		}
+	})
+
+	t.Run("Binary", func(t *testing.T) {
+		binary := ce
+		binary.Mode = CloudEventsBinary
+		metadata := map[string]string{"kind": "greeting"}
+		msg, err := binary.wrap(Message{
+			Body:     []byte(`{"user_id":"123"}`),
+			Metadata: metadata,
+		})
+
+		if err != nil {
+			t.Fatalf("CloudEvent.wrap() error = %v", err)
+		}
+
+		want := map[string]string{
+			"kind":           "greeting",
+			"content-type":   "application/json",
+			"ce-specversion": "1.0",
+			"ce-id":          "job-1",
+			"ce-source":      "crm",
+			"ce-type":        "crm.identify",
+			"ce-time":        "2021-05-10T12:00:00Z",
+			"ce-traceid":     "abc",
+		}
+
+		if !reflect.DeepEqual(msg.Metadata, want) {
+			t.Errorf("CloudEvent.wrap() metadata = %v, want %v", msg.Metadata, want)
+		}
+
+		if string(msg.Body) != `{"user_id":"123"}` {
+			t.Errorf("CloudEvent.wrap() body = %s", msg.Body)
+		}
+
+		if len(metadata) != 1 {
+			t.Errorf("CloudEvent.wrap() changed metadata = %v", metadata)
+		}
+	})
+}
@@ -3,7 +3,9 @@ package topicdestination
 import (
 	"context"
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/nunchistudio/blacksmith/destination"
 	"github.com/nunchistudio/blacksmith/helper/errors"
@@ -13,7 +15,8 @@ import (
 	_ "gocloud.dev/pubsub/awssnssqs"
 	_ "gocloud.dev/pubsub/azuresb"
 	_ "gocloud.dev/pubsub/gcppubsub"
-	_ "gocloud.dev/pubsub/kafkapubsub"
+	"gocloud.dev/pubsub/kafkapubsub"
+	"gocloud.dev/pubsub/mempubsub"
 	_ "gocloud.dev/pubsub/natspubsub"
 	_ "gocloud.dev/pubsub/rabbitpubsub"
 )
@@ -23,10 +26,12 @@ Topic implements the Blacksmith destination.Destination interface for working
 with message brokers.
 */
 type Topic struct {
-	options *destination.Options
-	env     *Options
-	ctx     context.Context
-	topic   *pubsub.Topic
+	options      *destination.Options
+	env          *Options
+	ctx          context.Context
+	cancel       context.CancelFunc
+	topic        *pubsub.Topic
+	subscription *pubsub.Subscription
 }
 
 /*
@@ -82,11 +87,16 @@ func (d *Topic) Init(tk *destination.Toolkit) error {
 	case DriverGooglePubSub:
 		topic, err = pubsub.OpenTopic(d.ctx, "gcppubsub://"+url)
 	case DriverKafka:
-		topic, err = pubsub.OpenTopic(d.ctx, "kafka://"+url)
+		topic, err = d.openKafkaTopic()
 	case DriverNATS:
 		topic, err = pubsub.OpenTopic(d.ctx, "nats://"+url)
 	case DriverRabbitMQ:
 		topic, err = pubsub.OpenTopic(d.ctx, "rabbit://"+url)
+	case DriverMemory:
+		topic = mempubsub.NewTopic()
+		d.subscription = mempubsub.NewSubscription(topic, time.Minute)
+	case DriverFile:
+		topic, err = openFileTopic(d.env.Connection)
 	default:
 		return &errors.Error{
 			Message: fmt.Sprintf("%s: Driver not supported", d.String()),
@@ -99,18 +109,50 @@ func (d *Topic) Init(tk *destination.Toolkit) error {
 		}
 	}
 
+	// Create a context canceled when shutting down the destination, so jobs not
+	// published yet are marked as failed and can be retried later.
+	d.ctx, d.cancel = context.WithCancel(d.ctx)
+
 	d.topic = topic
 	return nil
 }
 
+/*
+openKafkaTopic opens the Apache Kafka topic. It is opened directly rather than
+from a URL so the key of the messages can be set with the metadata key
+kafkaKeyName.
+*/
+func (d *Topic) openKafkaTopic() (*pubsub.Topic, error) {
+	brokers := strings.Split(os.Getenv("KAFKA_BROKERS"), ",")
+	for i, broker := range brokers {
+		brokers[i] = strings.TrimSpace(broker)
+	}
+
+	return kafkapubsub.OpenTopic(brokers, kafkapubsub.MinimalConfig(), d.env.Connection, &kafkapubsub.TopicOptions{
+		KeyName: kafkaKeyName,
+	})
+}
+
 /*
 Shutdown is part of the destination.WithHooks interface. It allows to properly
 close the connection with the message broker. It is called when shutting down the
 scheduler service.
 */
 func (d *Topic) Shutdown(tk *destination.Toolkit) error {
+	if d.cancel != nil {
+		d.cancel()
+	}
+
+	// The context of the destination is canceled at this point, so the topic and
+	// subscription are shut down with a new one to let them flush the messages
+	// already sent.
+	ctx := context.Background()
+	if d.subscription != nil {
+		d.subscription.Shutdown(ctx)
+	}
+
 	if d.topic != nil {
-		err := d.topic.Shutdown(d.ctx)
+		err := d.topic.Shutdown(ctx)
 		if err != nil {
 			return &errors.Error{
 				Message: fmt.Sprintf("%s: Failed to properly close connection with topic", d.String()),
@@ -121,6 +163,16 @@ func (d *Topic) Shutdown(tk *destination.Toolkit) error {
 	return nil
 }
 
+/*
+Subscription returns the subscription receiving the messages published when using
+the in-memory driver, so they can be asserted in tests. It is created when the
+destination is initialized, and is nil for other drivers. Messages published
+must be acknowledged.
+*/
+func (d *Topic) Subscription() *pubsub.Subscription {
+	return d.subscription
+}
+
 /*
 Options returns common destination options for a blob storage. They will be
 shared across every actions of this destination, except when overridden.
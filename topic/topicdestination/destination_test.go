@@ -1,11 +1,17 @@
 package topicdestination
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
+	"github.com/nunchistudio/blacksmith/adapter/store"
 	"github.com/nunchistudio/blacksmith/destination"
 	"github.com/nunchistudio/blacksmith/helper/logger"
 
@@ -14,6 +20,59 @@ import (
 
 var _ destination.Destination = &Topic{}
 
+/*
+newTopic returns an initialized Topic destination using the given driver and
+connection.
+*/
+func newTopic(t *testing.T, env *Options) *Topic {
+	env.Name = "fakename"
+
+	d := New(env).(*Topic)
+	if err := d.Init(&destination.Toolkit{}); err != nil {
+		t.Fatalf("Topic.Init() error = %v", err)
+	}
+
+	t.Cleanup(func() {
+		d.Shutdown(&destination.Toolkit{})
+	})
+
+	return d
+}
+
+/*
+load runs the action against a queue containing one job per data given, and
+returns the results sent by the action.
+*/
+func load(a destination.Action, data ...[]byte) []destination.Then {
+	queue := &store.Queue{
+		Events: []*store.Event{
+			{
+				ID: "event",
+			},
+		},
+	}
+
+	for i, d := range data {
+		queue.Events[0].Jobs = append(queue.Events[0].Jobs, &store.Job{
+			ID:   fmt.Sprintf("job-%d", i),
+			Data: d,
+		})
+	}
+
+	then := make(chan destination.Then, len(data))
+	a.Load(&destination.Toolkit{
+		Logger: logger.Default,
+	}, queue, then)
+
+	close(then)
+	results := []destination.Then{}
+	for result := range then {
+		results = append(results, result)
+	}
+
+	return results
+}
+
 func TestNew(t *testing.T) {
 	var fatal bool
 	logger.Default.Level = logrus.PanicLevel
@@ -228,3 +287,93 @@ func TestNew(t *testing.T) {
 		})
 	}
 }
+
+func TestTopic_InitMemory(t *testing.T) {
+	ctx := context.Background()
+	d := newTopic(t, &Options{
+		Driver:     DriverMemory,
+		Connection: "faketopic",
+	})
+
+	results := load(d.Actions()["publish"], []byte(`{"message":{"body":"aGVsbG8=","meta":{"kind":"greeting"}}}`))
+	if results[0].Error != nil {
+		t.Fatalf("Publish.Load() error = %v", results[0].Error)
+	}
+
+	msg, err := d.Subscription().Receive(ctx)
+	if err != nil {
+		t.Fatalf("Subscription.Receive() error = %v", err)
+	}
+
+	msg.Ack()
+	if string(msg.Body) != "hello" || msg.Metadata["kind"] != "greeting" {
+		t.Errorf("Subscription.Receive() = %q %v", msg.Body, msg.Metadata)
+	}
+}
+
+func TestTopic_Shutdown(t *testing.T) {
+	d := newTopic(t, &Options{
+		Driver:      DriverMemory,
+		Connection:  "faketopic",
+		Concurrency: 2,
+	})
+
+	// The action is retrieved before shutting down the destination, as if its
+	// jobs were still pending.
+	publish := d.Actions()["publish"]
+	if err := d.Shutdown(&destination.Toolkit{}); err != nil {
+		t.Fatalf("Topic.Shutdown() error = %v", err)
+	}
+
+	results := load(publish, []byte(`{"message":{"body":"aGVsbG8="}}`), []byte(`{"message":{"body":"d29ybGQ="}}`))
+	if len(results) != 2 {
+		t.Fatalf("Publish.Load() results = %d, want 2", len(results))
+	}
+
+	for _, result := range results {
+		if result.Error != context.Canceled {
+			t.Errorf("Publish.Load() error = %v, want %v", result.Error, context.Canceled)
+		}
+	}
+}
+
+func TestTopic_InitFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "messages.ndjson")
+	env := &Options{
+		Driver:     DriverFile,
+		Connection: filename,
+	}
+
+	// The messages are appended into the file, even after the destination is
+	// initialized again.
+	for _, body := range []string{"aGVsbG8=", "d29ybGQ="} {
+		d := newTopic(t, env)
+		results := load(d.Actions()["publish"], []byte(`{"message":{"body":"`+body+`"}}`))
+		if results[0].Error != nil {
+			t.Fatalf("Publish.Load() error = %v", results[0].Error)
+		}
+
+		d.Shutdown(&destination.Toolkit{})
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+	bodies := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var msg Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+
+		bodies = append(bodies, string(msg.Body))
+	}
+
+	if !reflect.DeepEqual(bodies, []string{"hello", "world"}) {
+		t.Errorf("messages = %v, want %v", bodies, []string{"hello", "world"})
+	}
+}
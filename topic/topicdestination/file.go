@@ -0,0 +1,132 @@
+package topicdestination
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"gocloud.dev/gcerrors"
+	"gocloud.dev/pubsub"
+	"gocloud.dev/pubsub/driver"
+)
+
+/*
+fileTopic implements the gocloud driver.Topic interface for appending messages
+into a local file. Every message is written on its own line as a JSON object
+with the same structure as Message, so the file can be read line by line.
+*/
+type fileTopic struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+/*
+openFileTopic returns a topic appending messages into the file at the given
+path. The file is created if it does not exist.
+*/
+func openFileTopic(path string) (*pubsub.Topic, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return pubsub.NewTopic(&fileTopic{
+		file: file,
+	}, nil), nil
+}
+
+/*
+SendBatch writes the messages into the file. The messages of a batch are written
+at once so lines of concurrent batches are never mixed up.
+*/
+func (t *fileTopic) SendBatch(ctx context.Context, msgs []*driver.Message) error {
+	var lines []byte
+	for _, msg := range msgs {
+		if msg.BeforeSend != nil {
+			if err := msg.BeforeSend(func(interface{}) bool { return false }); err != nil {
+				return err
+			}
+		}
+
+		line, err := json.Marshal(Message{
+			Body:     msg.Body,
+			Metadata: msg.Metadata,
+		})
+		if err != nil {
+			return err
+		}
+
+		lines = append(lines, line...)
+		lines = append(lines, '\n')
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if _, err := t.file.Write(lines); err != nil {
+		return err
+	}
+
+	for _, msg := range msgs {
+		if msg.AfterSend != nil {
+			if err := msg.AfterSend(func(interface{}) bool { return false }); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+IsRetryable indicates no error can be retried by the driver itself.
+*/
+func (t *fileTopic) IsRetryable(error) bool {
+	return false
+}
+
+/*
+As exposes the underlying *os.File.
+*/
+func (t *fileTopic) As(i interface{}) bool {
+	p, ok := i.(**os.File)
+	if !ok {
+		return false
+	}
+
+	*p = t.file
+	return true
+}
+
+/*
+ErrorAs does not expose any error.
+*/
+func (t *fileTopic) ErrorAs(error, interface{}) bool {
+	return false
+}
+
+/*
+ErrorCode returns the gocloud error code of an error.
+*/
+func (t *fileTopic) ErrorCode(err error) gcerrors.ErrorCode {
+	if os.IsNotExist(err) {
+		return gcerrors.NotFound
+	}
+
+	if os.IsPermission(err) {
+		return gcerrors.PermissionDenied
+	}
+
+	return gcerrors.Unknown
+}
+
+/*
+Close closes the file.
+*/
+func (t *fileTopic) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.file.Close()
+}
@@ -0,0 +1,108 @@
+package topicdestination
+
+import (
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	pb "google.golang.org/genproto/googleapis/pubsub/v1"
+
+	"gocloud.dev/pubsub"
+)
+
+/*
+kafkaKeyName is the metadata key holding the key of a message when using Apache
+Kafka. The driver uses its value as the message key instead of sending it as a
+header.
+*/
+const kafkaKeyName = "blacksmith-kafka-key"
+
+/*
+message returns the message to send to the message broker. The keys of the
+message are set given the driver of the destination.
+*/
+func (env *Options) message(m Message) *pubsub.Message {
+	msg := &pubsub.Message{
+		Body:     m.Body,
+		Metadata: m.Metadata,
+	}
+
+	switch env.Driver {
+	case DriverKafka:
+		key := m.Key
+		if key == "" {
+			key = m.OrderingKey
+		}
+
+		if key != "" {
+			msg.Metadata = map[string]string{}
+			for k, v := range m.Metadata {
+				msg.Metadata[k] = v
+			}
+
+			msg.Metadata[kafkaKeyName] = key
+		}
+
+	case DriverAWSSNS, DriverAWSSQS, DriverAzureServiceBus, DriverGooglePubSub:
+		if m.OrderingKey != "" || m.DeduplicationID != "" {
+			msg.BeforeSend = beforeSend(m)
+		}
+	}
+
+	return msg
+}
+
+/*
+beforeSend returns the function setting the ordering key and deduplication ID
+of a message on the driver's specific message right before it is sent.
+*/
+func beforeSend(m Message) func(func(interface{}) bool) error {
+	return func(as func(interface{}) bool) error {
+		var snsInput *sns.PublishInput
+		if as(&snsInput) {
+			if m.OrderingKey != "" {
+				snsInput.MessageGroupId = aws.String(m.OrderingKey)
+			}
+
+			if m.DeduplicationID != "" {
+				snsInput.MessageDeduplicationId = aws.String(m.DeduplicationID)
+			}
+
+			return nil
+		}
+
+		var sqsEntry *sqs.SendMessageBatchRequestEntry
+		if as(&sqsEntry) {
+			if m.OrderingKey != "" {
+				sqsEntry.MessageGroupId = aws.String(m.OrderingKey)
+			}
+
+			if m.DeduplicationID != "" {
+				sqsEntry.MessageDeduplicationId = aws.String(m.DeduplicationID)
+			}
+
+			return nil
+		}
+
+		var sbMessage *servicebus.Message
+		if as(&sbMessage) {
+			if m.OrderingKey != "" {
+				sbMessage.SessionID = &m.OrderingKey
+			}
+
+			if m.DeduplicationID != "" {
+				sbMessage.ID = m.DeduplicationID
+			}
+
+			return nil
+		}
+
+		var psMessage *pb.PubsubMessage
+		if as(&psMessage) {
+			psMessage.OrderingKey = m.OrderingKey
+		}
+
+		return nil
+	}
+}
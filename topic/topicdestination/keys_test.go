@@ -0,0 +1,146 @@
+package topicdestination
+
+import (
+	"reflect"
+	"testing"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	pb "google.golang.org/genproto/googleapis/pubsub/v1"
+)
+
+func TestOptions_messageKafka(t *testing.T) {
+	env := &Options{
+		Driver: DriverKafka,
+	}
+
+	tests := []struct {
+		name    string
+		message Message
+		want    map[string]string
+	}{
+		{
+			name: "WithKey",
+			message: Message{
+				Metadata:    map[string]string{"kind": "greeting"},
+				Key:         "user-1",
+				OrderingKey: "user-2",
+			},
+			want: map[string]string{"kind": "greeting", kafkaKeyName: "user-1"},
+		},
+		{
+			name: "WithOrderingKey",
+			message: Message{
+				OrderingKey: "user-2",
+			},
+			want: map[string]string{kafkaKeyName: "user-2"},
+		},
+		{
+			name: "WithNoKey",
+			message: Message{
+				Metadata: map[string]string{"kind": "greeting"},
+			},
+			want: map[string]string{"kind": "greeting"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := map[string]string{}
+			for k, v := range tt.message.Metadata {
+				metadata[k] = v
+			}
+
+			msg := env.message(tt.message)
+			if !reflect.DeepEqual(msg.Metadata, tt.want) {
+				t.Errorf("Options.message() metadata = %v, want %v", msg.Metadata, tt.want)
+			}
+
+			if tt.message.Metadata != nil && !reflect.DeepEqual(tt.message.Metadata, metadata) {
+				t.Errorf("Options.message() changed metadata = %v", tt.message.Metadata)
+			}
+		})
+	}
+}
+
+func TestOptions_messageBeforeSend(t *testing.T) {
+	m := Message{
+		OrderingKey:     "user-1",
+		DeduplicationID: "job-1",
+	}
+
+	snsInput := &sns.PublishInput{}
+	sqsEntry := &sqs.SendMessageBatchRequestEntry{}
+	sbMessage := &servicebus.Message{}
+	psMessage := &pb.PubsubMessage{}
+
+	tests := []struct {
+		driver Driver
+		target interface{}
+		check  func() bool
+	}{
+		{
+			driver: DriverAWSSNS,
+			target: snsInput,
+			check: func() bool {
+				return aws.StringValue(snsInput.MessageGroupId) == "user-1" && aws.StringValue(snsInput.MessageDeduplicationId) == "job-1"
+			},
+		},
+		{
+			driver: DriverAWSSQS,
+			target: sqsEntry,
+			check: func() bool {
+				return aws.StringValue(sqsEntry.MessageGroupId) == "user-1" && aws.StringValue(sqsEntry.MessageDeduplicationId) == "job-1"
+			},
+		},
+		{
+			driver: DriverAzureServiceBus,
+			target: sbMessage,
+			check: func() bool {
+				return sbMessage.SessionID != nil && *sbMessage.SessionID == "user-1" && sbMessage.ID == "job-1"
+			},
+		},
+		{
+			driver: DriverGooglePubSub,
+			target: psMessage,
+			check: func() bool {
+				return psMessage.OrderingKey == "user-1"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.driver), func(t *testing.T) {
+			env := &Options{
+				Driver: tt.driver,
+			}
+
+			msg := env.message(m)
+			if msg.BeforeSend == nil {
+				t.Fatalf("Options.message() BeforeSend not set")
+			}
+
+			// Expose the driver's specific message the same way the driver does.
+			err := msg.BeforeSend(func(i interface{}) bool {
+				target := reflect.ValueOf(i)
+				if target.Kind() != reflect.Ptr || target.Elem().Type() != reflect.TypeOf(tt.target) {
+					return false
+				}
+
+				target.Elem().Set(reflect.ValueOf(tt.target))
+				return true
+			})
+
+			if err != nil {
+				t.Fatalf("Message.BeforeSend() error = %v", err)
+			}
+
+			if !tt.check() {
+				t.Errorf("Message.BeforeSend() keys not set on %#v", tt.target)
+			}
+		})
+	}
+}
@@ -7,4 +7,33 @@ broker.
 type Message struct {
 	Body     []byte            `json:"body"`
 	Metadata map[string]string `json:"meta"`
+
+	// Key is the key of the message used by Apache Kafka to choose the partition
+	// the message is written to. Messages with the same key are written to the
+	// same partition, and are therefore received in the order they are written.
+	// It is ignored by the other drivers.
+	//
+	// Defaults to OrderingKey.
+	Key string `json:"key,omitempty"`
+
+	// OrderingKey is the key of the message used by the message broker to keep
+	// the order of messages sharing the same key. It is used as:
+	//   - the message group ID for AWS SNS and AWS SQS FIFO topics / queues;
+	//   - the session ID for Azure Service Bus;
+	//   - the ordering key for Google Pub / Sub, where message ordering must be
+	//     enabled on the subscription;
+	//   - the message key for Apache Kafka, if Key is not set.
+	// The message broker can only keep the order in which messages are sent, so
+	// the Concurrency of the destination must be 1 for the order of the queue to
+	// be kept.
+	OrderingKey string `json:"ordering_key,omitempty"`
+
+	// DeduplicationID is the ID of the message used by the message broker to
+	// detect duplicates. It is used as:
+	//   - the message deduplication ID for AWS SNS and AWS SQS FIFO topics /
+	//     queues, required unless content-based deduplication is enabled;
+	//   - the message ID for Azure Service Bus, used when duplicate detection is
+	//     enabled.
+	// It is ignored by the other drivers.
+	DeduplicationID string `json:"deduplication_id,omitempty"`
 }
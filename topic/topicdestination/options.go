@@ -80,6 +80,21 @@ Environment variables:
 */
 var DriverRabbitMQ Driver = "rabbitmq"
 
+/*
+DriverMemory is used to leverage an in-memory topic as the destination's driver.
+The messages published can be received with the subscription returned by
+Topic.Subscription. It is mainly designed for local development and testing.
+*/
+var DriverMemory Driver = "memory"
+
+/*
+DriverFile is used to leverage a local file as the destination's driver. The
+messages published are appended into the file, one JSON object per line with the
+same structure as Message. It is mainly designed for local development and
+testing.
+*/
+var DriverFile Driver = "file"
+
 /*
 Options is the options the destination can take as an input to be configured.
 */
@@ -127,6 +142,8 @@ type Options struct {
 	// Format for Apache Kafka: "<topic>"
 	// Format for NATS: "<subject>"
 	// Format for RabbitMQ: "<exchange>"
+	// Format for in-memory: "<topic>"
+	// Format for local file: "<path>"
 	Connection string
 
 	// Params can be used to add specific configuration per driver.
@@ -136,6 +153,28 @@ type Options struct {
 	//     "region": {"<region>"}, // Required if environment variable 'AWS_REGION' is not set.
 	//   }
 	Params url.Values
+
+	// Concurrency is the maximum number of messages the action Publish sends in
+	// parallel when loading a queue of jobs. Messages sent in parallel are
+	// batched together by the driver when supported. Every job still has its
+	// own result.
+	//
+	// Workers take the jobs in any order, so messages sent in parallel can be
+	// received in any order, even when they share an ordering key. Set it to 1
+	// when the order matters: the messages of a queue are then sent one after
+	// the other, in the order of the queue, and the message broker keeps this
+	// order within the limits of its own guarantees:
+	//   - AWS SNS and AWS SQS standard queues never guarantee the order;
+	//   - AWS SQS FIFO queues keep the order within a message group;
+	//   - Azure Service Bus keeps the order within a session;
+	//   - Google Pub / Sub keeps the order within an ordering key;
+	//   - Apache Kafka keeps the order within a partition;
+	//   - NATS and RabbitMQ keep the order in which messages are sent;
+	//   - the in-memory driver never guarantees the order;
+	//   - the local file driver keeps the order in which messages are sent.
+	//
+	// Defaults to 1.
+	Concurrency int
 }
 
 /*
@@ -191,6 +230,13 @@ func (env *Options) validate() error {
 		})
 	}
 
+	if env.Concurrency < 0 {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: "Concurrency must not be negative",
+			Path:    []string{"Options", "Destinations", name, "Concurrency"},
+		})
+	}
+
 	switch env.Driver {
 	case DriverAWSSNS, DriverAWSSQS:
 		fail.Validations = append(fail.Validations, env.validateDriverAWSSNSSQS(name)...)
@@ -106,6 +106,19 @@ func TestOptions_validate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "WithNegativeConcurrency",
+			fields: &Options{
+				Realtime:    false,
+				Interval:    "@every 1h",
+				MaxRetries:  10,
+				Name:        "fakename",
+				Driver:      DriverTest,
+				Connection:  "conn://fakeurl",
+				Concurrency: -1,
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {